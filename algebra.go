@@ -0,0 +1,67 @@
+package haxmap
+
+// Union returns a new map of the keys which are in either map
+// the values of keys present in both maps are combined with merge, given the value of this map first
+func (m *Map[K, V]) Union(other *Map[K, V], merge func(key K, value, otherValue V) V) *Map[K, V] {
+	result := m.empty(m.Len() + other.Len())
+	m.ForEach(func(key K, value V) bool {
+		result.Set(key, value)
+		return true
+	})
+	other.ForEach(func(key K, otherValue V) bool {
+		if value, ok := result.Get(key); ok {
+			otherValue = merge(key, value, otherValue)
+		}
+		result.Set(key, otherValue)
+		return true
+	})
+	return result
+}
+
+// Intersect returns a new map of the keys which are in both maps, with their values in this map
+func (m *Map[K, V]) Intersect(other *Map[K, V]) *Map[K, V] {
+	result := m.empty(m.Len())
+	m.ForEach(func(key K, value V) bool {
+		if _, ok := other.Get(key); ok {
+			result.Set(key, value)
+		}
+		return true
+	})
+	return result
+}
+
+// Difference returns a new map of the key-value pairs of this map whose keys are not in the other one
+func (m *Map[K, V]) Difference(other *Map[K, V]) *Map[K, V] {
+	result := m.empty(m.Len())
+	m.ForEach(func(key K, value V) bool {
+		if _, ok := other.Get(key); !ok {
+			result.Set(key, value)
+		}
+		return true
+	})
+	return result
+}
+
+// empty returns a new map hashing and comparing keys like this one, with an index sized for the given number of keys
+func (m *Map[K, V]) empty(hint uintptr) *Map[K, V] {
+	result := &Map[K, V]{}
+	result.configureLike(m, hint)
+	return result
+}
+
+// configureLike sets up a zero map hashing and comparing keys like src, including its hash seed and key normalization
+// only the index is sized for hint keys, the elements are allocated as they are added
+// the other options of src like expiration, bounds, hooks and snapshots are not carried over
+func (m *Map[K, V]) configureLike(src *Map[K, V], hint uintptr) {
+	src.init()
+	m.storage = storageOf(typeOf[V]())
+	m.listHead = newListHead[K, V](m.storage)
+	m.gen.Store(m.newGeneration())
+	m.hasher, m.equal, m.deterministic = src.hasher, src.equal, src.deterministic
+	m.defaultSize, m.maxFillRate, m.growthFactor = src.defaultSize, src.maxFillRate, src.growthFactor
+	size := m.defaultSize
+	if needed := hint * 100 / m.maxFillRate; needed >= size {
+		size = needed + 1
+	}
+	m.allocate(size)
+}
@@ -0,0 +1,79 @@
+package haxmap
+
+import "unsafe"
+
+// number of elements in each slab allocated by a map using an arena
+const arenaChunk = 256
+
+// nodeSlab is a block of preallocated list elements handed out by bumping an index
+// the whole block stays in memory as long as any of its elements is referenced
+type nodeSlab[K comparable, V any] struct {
+	nodes unsafe.Pointer // first element of the block, elements have the layout of the storage of the map
+	size  uintptr        // size of an element
+	len   uintptr        // number of elements in the block
+	next  atomicUintptr
+}
+
+// newSlab allocates a block of n elements with the layout of the given storage
+func newSlab[K comparable, V any](storage valueStorage, n int) *nodeSlab[K, V] {
+	slab := &nodeSlab[K, V]{size: elementSize[K, V](storage), len: uintptr(n)}
+	switch storage {
+	case inlineValues:
+		slab.nodes = unsafe.Pointer(&make([]inlineElement[K, V], n)[0])
+	case versionedValues:
+		slab.nodes = unsafe.Pointer(&make([]versionedElement[K, V], n)[0])
+	case noValues:
+		slab.nodes = unsafe.Pointer(&make([]element[K, V], n)[0])
+	default:
+		slab.nodes = unsafe.Pointer(&make([]pointerElement[K, V], n)[0])
+	}
+	return slab
+}
+
+// at returns the i-th element of the block
+func (s *nodeSlab[K, V]) at(i uintptr) *element[K, V] {
+	return (*element[K, V])(unsafe.Pointer(uintptr(s.nodes) + i*s.size))
+}
+
+// Reserve prepares the map for holding n more elements
+// the index is grown so that inserting them does not trigger any resize and storage for n elements is preallocated in a single block
+// bulk loading a large number of elements is considerably faster after a Reserve call
+func (m *Map[K, V]) Reserve(n int) {
+	m.init()
+	if n <= 0 {
+		return
+	}
+	m.slab.Store(newSlab[K, V](m.storage, n))
+
+	needed := (m.Len() + uintptr(n)) * 100 / m.maxFillRate
+	for uintptr(len(m.metadata.Load().index)) <= needed {
+		m.Grow(needed + 1)
+	}
+}
+
+// newElement returns a zeroed list element, reusing a recycled one if available or taken from the preallocated slab while it has spare capacity
+// maps using an arena allocate a new slab once the current one is exhausted
+func (m *Map[K, V]) newElement() *element[K, V] {
+	if m.reclaimer != nil {
+		if elem := m.reclaimer.get(); elem != nil {
+			return elem
+		}
+	}
+	for {
+		if slab := m.slab.Load(); slab != nil {
+			if i := slab.next.Add(1) - 1; i < slab.len {
+				return slab.at(i)
+			}
+			m.slab.CompareAndSwap(slab, nil) // slab is exhausted, release it for garbage collection once its elements are gone
+		}
+		if !m.arena {
+			return newElement[K, V](m.storage)
+		}
+		// carve the element out of a new slab, a concurrent allocation may have installed one first
+		slab := newSlab[K, V](m.storage, arenaChunk)
+		slab.next.Store(1)
+		if m.slab.CompareAndSwap(nil, slab) {
+			return slab.at(0)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package haxmap
+
+// number of keys hashed and looked up together in batch operations
+const batchBlock = 8
+
+// BatchGet retrieves the values of multiple keys at once
+// values[i] and found[i] are the result of Get(keys[i]), both slices are allocated if they are not large enough
+// keys are hashed in blocks and the index entries of a whole block are loaded before any list is searched,
+// so the memory accesses of independent keys overlap instead of waiting on each other
+func (m *Map[K, V]) BatchGet(keys []K, values []V, found []bool) ([]V, []bool) {
+	m.init()
+	if cap(values) < len(keys) {
+		values = make([]V, len(keys))
+	}
+	if cap(found) < len(keys) {
+		found = make([]bool, len(keys))
+	}
+	values, found = values[:len(keys)], found[:len(keys)]
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+
+	var (
+		hashes [batchBlock]uintptr
+		starts [batchBlock]*element[K, V]
+	)
+	for base := 0; base < len(keys); base += batchBlock {
+		block := keys[base:]
+		if len(block) > batchBlock {
+			block = block[:batchBlock]
+		}
+		m.hashBlock(block, &hashes)
+		data := m.metadata.Load()
+		for i := range block {
+			starts[i] = data.indexElement(hashes[i])
+		}
+		for i, key := range block {
+			h := hashes[i]
+			if m.sketch != nil {
+				m.sketch.increment(h)
+			}
+			elem := starts[i]
+			if elem == nil || elem.keyHash > h {
+				elem = m.listHead.nextPtr.Load()
+			}
+			values[base+i], found[base+i] = *new(V), false
+			for ; elem != nil && elem.keyHash <= h; elem = elem.nextPtr.Load() {
+				if elem.keyHash == h && keyEquals(m.equal, elem.key, key) && !elem.isDeleted() {
+					values[base+i], found[base+i] = elem.load(m.storage), true
+					if m.expireIfDue(elem) {
+						values[base+i], found[base+i] = *new(V), false
+					} else if m.capacity != 0 {
+						elem.touch()
+					}
+					break
+				}
+			}
+			if m.metrics != nil {
+				m.metrics.Get(found[base+i])
+			}
+		}
+	}
+	return values, found
+}
+
+// BatchSet stores the values of multiple keys at once, values[i] is stored for keys[i]
+// it panics if the slices differ in length
+func (m *Map[K, V]) BatchSet(keys []K, values []V) {
+	m.init()
+	if len(keys) != len(values) {
+		panic("haxmap: BatchSet called with a different number of keys and values")
+	}
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+
+	var (
+		hashes [batchBlock]uintptr
+		starts [batchBlock]*element[K, V]
+	)
+	for base := 0; base < len(keys); base += batchBlock {
+		block := keys[base:]
+		if len(block) > batchBlock {
+			block = block[:batchBlock]
+		}
+		m.hashBlock(block, &hashes)
+		data := m.metadata.Load()
+		for i := range block {
+			starts[i] = data.indexElement(hashes[i])
+		}
+		for i, key := range block {
+			// reload the metadata, an insertion of the block may have grown the index
+			if current := m.metadata.Load(); current != data {
+				data = current
+				starts[i] = data.indexElement(hashes[i])
+			}
+			m.insert(hashes[i], key, values[base+i], data, starts[i], true)
+		}
+	}
+}
+
+// hashBlock hashes up to batchBlock keys, the unrolled loop lets the hashes of independent keys be computed in parallel
+func (m *Map[K, V]) hashBlock(keys []K, hashes *[batchBlock]uintptr) {
+	if len(keys) == batchBlock {
+		hashes[0], hashes[1], hashes[2], hashes[3] = m.hasher(keys[0]), m.hasher(keys[1]), m.hasher(keys[2]), m.hasher(keys[3])
+		hashes[4], hashes[5], hashes[6], hashes[7] = m.hasher(keys[4]), m.hasher(keys[5]), m.hasher(keys[6]), m.hasher(keys[7])
+		return
+	}
+	for i := range keys {
+		hashes[i] = m.hasher(keys[i])
+	}
+}
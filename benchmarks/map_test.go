@@ -87,6 +87,44 @@ func BenchmarkHaxMapReadsWithWrites(b *testing.B) {
 	})
 }
 
+func BenchmarkHaxMapBatchReadsOnly(b *testing.B) {
+	m := setupHaxMap()
+	keys := make([]uintptr, epochs)
+	for i := range keys {
+		keys[i] = uintptr(i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var (
+			values []uintptr
+			found  []bool
+		)
+		for pb.Next() {
+			values, found = m.BatchGet(keys, values, found)
+			for i, j := range values {
+				if j != keys[i] {
+					b.Fail()
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkHaxMapFrozenReadsOnly(b *testing.B) {
+	m := setupHaxMap().Freeze()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for i := uintptr(0); i < epochs; i++ {
+				j, _ := m.Get(i)
+				if j != i {
+					b.Fail()
+				}
+			}
+		}
+	})
+}
+
 func BenchmarkGoSyncMapReadsOnly(b *testing.B) {
 	m := setupGoSyncMap()
 	b.ResetTimer()
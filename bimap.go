@@ -0,0 +1,197 @@
+package haxmap
+
+import "sync"
+
+// states of a key-value pair of a BiMap
+const (
+	pairPending uint32 = iota // published in both directions but not committed yet, the pairs it replaces are still visible
+	pairLive
+	pairDead
+)
+
+type (
+	// BiMap is a concurrent one-to-one map which can be looked up by key as well as by value
+	// both directions share a single record per pair which becomes visible and invisible in both of them at once,
+	// so a lookup in one direction never disagrees with a lookup in the other one
+	// writers are serialized by a mutex while lookups are lock-free
+	// the zero value is an empty map ready to use with the default settings
+	BiMap[K comparable, V comparable] struct {
+		forward Map[K, *biPair[K, V]]
+		inverse Map[V, *biPair[K, V]]
+		mu      sync.Mutex // serializes writers
+		count   atomicUintptr
+	}
+
+	// biPair is a key-value pair referenced from both directions of a BiMap
+	biPair[K comparable, V comparable] struct {
+		key   K
+		value V
+		state atomicUint32
+		// pair replacing this one, this pair turns invisible once its successor is committed
+		next atomicPointer[biPair[K, V]]
+		// pairs replaced by this one while it is pending, cleared once it is committed
+		prev atomicPointer[[2]*biPair[K, V]]
+	}
+)
+
+// NewBiMap returns a new bidirectional map with an optional specific initialization size of both directions
+func NewBiMap[K comparable, V comparable](size ...uintptr) *BiMap[K, V] {
+	var cfg config
+	if len(size) > 0 {
+		cfg.size = size[0]
+	}
+	b := &BiMap[K, V]{}
+	if err := b.forward.configure(&cfg); err != nil {
+		panic(err)
+	}
+	if err := b.inverse.configure(&cfg); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Get returns the value of the key
+func (b *BiMap[K, V]) Get(key K) (value V, ok bool) {
+	if p, found := b.forward.Get(key); found {
+		if p = p.current(func(q *biPair[K, V]) bool { return q.key == key }); p != nil {
+			return p.value, true
+		}
+	}
+	return
+}
+
+// GetKey returns the key of the value
+func (b *BiMap[K, V]) GetKey(value V) (key K, ok bool) {
+	if p, found := b.inverse.Get(value); found {
+		if p = p.current(func(q *biPair[K, V]) bool { return q.value == value }); p != nil {
+			return p.key, true
+		}
+	}
+	return
+}
+
+// Put binds the key and the value to each other
+// a previous value of the key and a previous key of the value are unbound in the same step
+func (b *BiMap[K, V]) Put(key K, value V) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	byKey, byValue := b.byKey(key), b.byValue(value)
+	if byKey != nil && byKey == byValue {
+		return // already bound
+	}
+	p := &biPair[K, V]{key: key, value: value}
+	p.prev.Store(&[2]*biPair[K, V]{byKey, byValue})
+	for _, q := range [2]*biPair[K, V]{byKey, byValue} {
+		if q != nil {
+			q.next.Store(p)
+		}
+	}
+	b.forward.Set(key, p)
+	b.inverse.Set(value, p)
+	p.state.Store(pairLive) // commit point, the replaced pairs disappear from both directions
+	p.prev.Store(nil)
+	b.count.Add(1)
+
+	// drop the entries of the replaced pairs which are not overwritten by the new one
+	if byKey != nil {
+		b.inverse.Del(byKey.value)
+		b.count.Add(^uintptr(0))
+	}
+	if byValue != nil {
+		b.forward.Del(byValue.key)
+		b.count.Add(^uintptr(0))
+	}
+}
+
+// Del unbinds the key from its value and reports whether it was bound
+func (b *BiMap[K, V]) Del(key K) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.byKey(key)
+	if p == nil {
+		return false
+	}
+	b.remove(p)
+	return true
+}
+
+// DelValue unbinds the value from its key and reports whether it was bound
+func (b *BiMap[K, V]) DelValue(value V) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.byValue(value)
+	if p == nil {
+		return false
+	}
+	b.remove(p)
+	return true
+}
+
+// Len returns the number of key-value pairs
+func (b *BiMap[K, V]) Len() uintptr {
+	return b.count.Load()
+}
+
+// ForEach iterates over the key-value pairs
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (b *BiMap[K, V]) ForEach(lambda func(K, V) bool) {
+	b.forward.ForEach(func(key K, p *biPair[K, V]) bool {
+		if p = p.current(func(q *biPair[K, V]) bool { return q.key == key }); p != nil {
+			return lambda(p.key, p.value)
+		}
+		return true
+	})
+}
+
+// byKey returns the visible pair of the key, the caller must hold the mutex
+// no pair is pending while the mutex is held, so the entries of both directions point to committed pairs
+func (b *BiMap[K, V]) byKey(key K) *biPair[K, V] {
+	if p, ok := b.forward.Get(key); ok && p.visible() {
+		return p
+	}
+	return nil
+}
+
+// byValue returns the visible pair of the value, the caller must hold the mutex
+func (b *BiMap[K, V]) byValue(value V) *biPair[K, V] {
+	if p, ok := b.inverse.Get(value); ok && p.visible() {
+		return p
+	}
+	return nil
+}
+
+// remove unbinds a pair, the caller must hold the mutex
+func (b *BiMap[K, V]) remove(p *biPair[K, V]) {
+	p.state.Store(pairDead) // removes the pair from both directions at once
+	b.forward.Del(p.key)
+	b.inverse.Del(p.value)
+	b.count.Add(^uintptr(0))
+}
+
+// current resolves the pair visible through an entry pointing to this one, match selects the replaced pair of the looked up side
+func (p *biPair[K, V]) current(match func(*biPair[K, V]) bool) *biPair[K, V] {
+	prev := p.prev.Load() // loaded before the state, it is only cleared after the commit
+	if p.state.Load() != pairPending {
+		if p.visible() {
+			return p
+		}
+		return nil
+	}
+	if prev != nil {
+		for _, q := range prev {
+			if q != nil && match(q) && q.visible() {
+				return q
+			}
+		}
+	}
+	return nil
+}
+
+// visible reports whether the pair is committed and not replaced by a committed successor
+func (p *biPair[K, V]) visible() bool {
+	if p.state.Load() != pairLive {
+		return false
+	}
+	next := p.next.Load()
+	return next == nil || next.state.Load() == pairPending
+}
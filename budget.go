@@ -0,0 +1,41 @@
+package haxmap
+
+import "sync/atomic"
+
+// byteBudget tracks the approximate size of the elements of a map bounded with WithMaxBytes
+type byteBudget[K comparable, V any] struct {
+	used   int64 // first field for 64 bit alignment of the atomic operations on 32 bit platforms
+	limit  int64
+	sizeOf func(K, V) int
+}
+
+// WithMaxBytes bounds the approximate total size of the map to n bytes, the size of every pair is estimated with sizeOf
+// once an insertion pushes the total above n, elements which were not accessed recently are evicted like in a map created with NewLRU,
+// so a single value larger than n is evicted right away, which rejects it
+// the size is updated on every modification but only enforced by insertions, Set included, concurrent insertions may briefly exceed it
+// the bound can be combined with WithMaxEntries, whose onEvict is then also notified of the elements evicted for size
+// values modified through GetRef keep the size they had when they were stored
+func WithMaxBytes[K comparable, V any](n int64, sizeOf func(K, V) int) Option {
+	return func(c *config) {
+		c.maxBytes, c.sizeOf = n, sizeOf
+	}
+}
+
+// Bytes returns the approximate total size of the map bounded with WithMaxBytes, 0 for other maps
+func (m *Map[K, V]) Bytes() int64 {
+	m.init()
+	if b := m.budget; b != nil {
+		return atomic.LoadInt64(&b.used)
+	}
+	return 0
+}
+
+// add adjusts the tracked size by delta bytes
+func (b *byteBudget[K, V]) add(delta int) {
+	atomic.AddInt64(&b.used, int64(delta))
+}
+
+// exceeded reports whether the tracked size is above the limit
+func (b *byteBudget[K, V]) exceeded() bool {
+	return atomic.LoadInt64(&b.used) > b.limit
+}
@@ -0,0 +1,103 @@
+package haxmap
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// BytesMap implements the concurrent hashmap for byte slice keys
+// keys are hashed and compared by their contents
+// the contents of a key are copied only when a new element is inserted, lookups and deletions work on the caller's slice directly
+type BytesMap[V any] struct {
+	m *Map[string, V]
+}
+
+// NewBytes returns a new BytesMap instance with an optional specific initialization size
+func NewBytes[V any](size ...uintptr) *BytesMap[V] {
+	return &BytesMap[V]{m: New[string, V](size...)}
+}
+
+// Get retrieves an element from the map
+// returns `false“ if element is absent
+func (b *BytesMap[V]) Get(key []byte) (value V, ok bool) {
+	return b.m.Get(bytesView(key))
+}
+
+// Set tries to update an element if key is present else it inserts a new element
+func (b *BytesMap[V]) Set(key []byte, value V) {
+	if _, swapped := b.m.Swap(bytesView(key), value); !swapped {
+		b.m.Set(string(key), value)
+	}
+}
+
+// GetOrSet returns the existing value for the key if present
+// Otherwise, it stores and returns the given value
+// The loaded result is true if the value was loaded, false if stored
+func (b *BytesMap[V]) GetOrSet(key []byte, value V) (actual V, loaded bool) {
+	if actual, loaded = b.m.Get(bytesView(key)); loaded {
+		return
+	}
+	return b.m.GetOrSet(string(key), value)
+}
+
+// GetOrCompute is similar to GetOrSet but the value to be set is obtained from a constructor
+// the value constructor is called only once
+func (b *BytesMap[V]) GetOrCompute(key []byte, valueFn func() V) (actual V, loaded bool) {
+	if actual, loaded = b.m.Get(bytesView(key)); loaded {
+		return
+	}
+	return b.m.GetOrCompute(string(key), valueFn)
+}
+
+// GetAndDel deletes the key from the map, returning the previous value if any.
+func (b *BytesMap[V]) GetAndDel(key []byte) (value V, ok bool) {
+	return b.m.GetAndDel(bytesView(key))
+}
+
+// Del deletes key/keys from the map
+// Bulk deletion is more efficient than deleting keys one by one
+func (b *BytesMap[V]) Del(keys ...[]byte) {
+	views := make([]string, len(keys))
+	for i := range keys {
+		views[i] = bytesView(keys[i])
+	}
+	b.m.Del(views...)
+}
+
+// Swap atomically swaps the value of a map entry given its key
+// It returns the old value if swap was successful and a boolean `swapped` indicating whether the swap was successful or not
+func (b *BytesMap[V]) Swap(key []byte, newValue V) (oldValue V, swapped bool) {
+	return b.m.Swap(bytesView(key), newValue)
+}
+
+// ForEach iterates over key-value pairs and executes the lambda provided for each such pair
+// lambda must return `true` to continue iteration and `false` to break iteration
+// the key passed to the lambda refers to the map's own copy and must not be modified or retained after the lambda returns
+func (b *BytesMap[V]) ForEach(lambda func([]byte, V) bool) {
+	b.m.ForEach(func(key string, value V) bool {
+		return lambda(stringView(key), value)
+	})
+}
+
+// Len returns the number of key-value pairs within the map
+func (b *BytesMap[V]) Len() uintptr {
+	return b.m.Len()
+}
+
+// Clear the map by removing all entries in the map.
+func (b *BytesMap[V]) Clear() {
+	b.m.Clear()
+}
+
+// bytesView returns a string sharing the memory of the byte slice without copying
+// the result must never be stored inside the map
+func bytesView(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+// stringView returns a byte slice sharing the memory of the string without copying
+// the result must never be modified
+func stringView(s string) []byte {
+	sh := (*reflect.StringHeader)(unsafe.Pointer(&s))
+	return unsafe.Slice((*byte)(unsafe.Pointer(sh.Data)), sh.Len)
+}
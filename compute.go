@@ -0,0 +1,108 @@
+package haxmap
+
+import "sync"
+
+type (
+	// computation is a GetOrSetFunc call constructing the value of a missing key, done is closed once it finished
+	computation[K comparable] struct {
+		key  K
+		done chan struct{}
+	}
+
+	// computations holds the GetOrSetFunc calls of a map constructing a value, it is created by the first call and kept afterwards
+	computations[K comparable] struct {
+		mu    sync.Mutex
+		calls map[uintptr][]*computation[K] // calls by hash of their key
+	}
+)
+
+// GetOrSetFunc returns the existing value for the key if present, otherwise it stores and returns the value constructed by mk
+// The loaded result is true if the value was loaded, false if the value constructed by mk was stored
+// concurrent calls missing the same key wait for the one running mk instead of constructing a value of their own, so mk only runs for a value about to be stored
+// a value stored concurrently by another method such as Set still wins over the constructed one, which is then dropped and loaded is true
+func (m *Map[K, V]) GetOrSetFunc(key K, mk func() V) (actual V, loaded bool) {
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	for {
+		if actual, loaded = m.lookup(h, key); loaded {
+			if m.metrics != nil {
+				m.metrics.Get(true)
+			}
+			return
+		}
+		cs := m.computing.Load()
+		if cs == nil {
+			m.computing.CompareAndSwap(nil, &computations[K]{calls: make(map[uintptr][]*computation[K])})
+			cs = m.computing.Load()
+		}
+		call, running := cs.start(h, key, m.equal)
+		if running {
+			<-call.done
+			continue // look the key up again, it may have been deleted since
+		}
+		defer cs.finish(h, call)
+
+		// the key may have been added between the miss and registering the call
+		if actual, loaded = m.lookup(h, key); loaded {
+			if m.metrics != nil {
+				m.metrics.Get(true)
+			}
+			return
+		}
+		data := m.metadata.Load()
+		value := mk()
+		if elem, created := m.insert(h, key, value, data, data.indexElement(h), false); !created {
+			return elem.load(m.storage), true
+		}
+		return value, false
+	}
+}
+
+// lookup returns the live value of the key
+func (m *Map[K, V]) lookup(h uintptr, key K) (value V, ok bool) {
+	for elem := m.metadata.Load().indexElement(h); elem != nil && elem.keyHash <= h; elem = elem.nextPtr.Load() {
+		if elem.keyHash == h && keyEquals(m.equal, elem.key, key) && !elem.isDeleted() && !m.expireIfDue(elem) {
+			if m.capacity != 0 {
+				elem.touch()
+			}
+			return elem.load(m.storage), true
+		}
+	}
+	return
+}
+
+// start registers a computation of the key, if one is already running it is returned instead along with true
+func (cs *computations[K]) start(h uintptr, key K, equal func(a, b K) bool) (*computation[K], bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, call := range cs.calls[h] {
+		if keyEquals(equal, call.key, key) {
+			return call, true
+		}
+	}
+	call := &computation[K]{key: key, done: make(chan struct{})}
+	cs.calls[h] = append(cs.calls[h], call)
+	return call, false
+}
+
+// finish unregisters a computation and wakes up the calls waiting for it
+func (cs *computations[K]) finish(h uintptr, call *computation[K]) {
+	cs.mu.Lock()
+	list := cs.calls[h]
+	for i := range list {
+		if list[i] == call {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(cs.calls, h)
+	} else {
+		cs.calls[h] = list
+	}
+	cs.mu.Unlock()
+	close(call.done)
+}
@@ -0,0 +1,33 @@
+package haxmap
+
+// FromMap returns a new HashMap instance holding the elements of the builtin map, configured with the given options
+// the index is sized for all elements up front so that they are inserted without any intermediate resize
+func FromMap[K comparable, V any](src map[K]V, opts ...Option) *Map[K, V] {
+	m := NewWithOptions[K, V](opts...)
+	m.InsertMap(src)
+	return m
+}
+
+// ToMap returns a builtin map holding a copy of the elements of the map
+func (m *Map[K, V]) ToMap() map[K]V {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	dst := make(map[K]V, m.Len())
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		if !m.expireIfDue(item) {
+			dst[item.key] = item.load(m.storage)
+		}
+	}
+	return dst
+}
+
+// InsertMap sets all elements of the builtin map, existing keys are overwritten
+// the map is sized for the new elements up front so that they are inserted without any intermediate resize
+func (m *Map[K, V]) InsertMap(src map[K]V) {
+	m.Reserve(len(src))
+	for key, value := range src {
+		m.Set(key, value)
+	}
+}
@@ -0,0 +1,121 @@
+package haxmap
+
+import (
+	"runtime"
+	"sync"
+)
+
+// number of increments a shard buffers before merging them into the shared map
+const counterFlushOps = 1024
+
+type (
+	// Counters implements a concurrent map of integer counters optimized for workloads which mostly increment
+	// increments are buffered in shards which are local to the processor of the calling goroutine and periodically merged,
+	// so goroutines on different cores incrementing the same keys do not contend on the same cache lines
+	Counters[K comparable] struct {
+		m      *Map[K, int64]
+		pool   sync.Pool // hands out shards with affinity to the current processor
+		mu     sync.Mutex
+		shards []*counterShard[K] // every shard ever created, so that pending increments survive shards dropped from the pool
+		next   int                // round robin position for reusing shards once enough exist
+	}
+
+	// counterShard buffers increments not yet merged into the shared map
+	counterShard[K comparable] struct {
+		mu     sync.Mutex // uncontended unless a reader merges the shard or it is shared after being dropped from the pool
+		deltas map[K]int64
+		ops    int
+	}
+)
+
+// NewCounters returns a new Counters instance configured with the given options
+func NewCounters[K comparable](opts ...Option) *Counters[K] {
+	c := &Counters[K]{m: NewWithOptions[K, int64](opts...)}
+	c.pool.New = func() any {
+		return c.newShard()
+	}
+	return c
+}
+
+// newShard registers a new shard, once there are a few per processor the existing ones are shared instead
+func (c *Counters[K]) newShard() *counterShard[K] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.shards) >= 4*runtime.GOMAXPROCS(0) {
+		s := c.shards[c.next%len(c.shards)]
+		c.next++
+		return s
+	}
+	s := &counterShard[K]{deltas: make(map[K]int64)}
+	c.shards = append(c.shards, s)
+	return s
+}
+
+// Add adds delta to the counter of the key, a missing counter starts at 0
+// the increment is buffered and becomes visible to ForEach and Len after the next merge, Get always includes it
+func (c *Counters[K]) Add(key K, delta int64) {
+	s := c.pool.Get().(*counterShard[K])
+	s.mu.Lock()
+	s.deltas[key] += delta
+	if s.ops++; s.ops >= counterFlushOps {
+		c.merge(s)
+	}
+	s.mu.Unlock()
+	c.pool.Put(s)
+}
+
+// Get returns the current value of the counter of the key including increments not merged yet
+// all shards are held while the shared map is read, so that no increment is in the middle of a merge and counted twice or not at all
+func (c *Counters[K]) Get(key K) int64 {
+	c.mu.Lock()
+	shards := c.shards
+	c.mu.Unlock()
+	for _, s := range shards {
+		s.mu.Lock()
+	}
+	value, _ := c.m.Get(key)
+	for _, s := range shards {
+		value += s.deltas[key]
+		s.mu.Unlock()
+	}
+	return value
+}
+
+// Flush merges all buffered increments into the shared map
+func (c *Counters[K]) Flush() {
+	c.mu.Lock()
+	shards := c.shards
+	c.mu.Unlock()
+	for _, s := range shards {
+		s.mu.Lock()
+		c.merge(s)
+		s.mu.Unlock()
+	}
+}
+
+// ForEach flushes the buffered increments and iterates over the counters
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (c *Counters[K]) ForEach(lambda func(K, int64) bool) {
+	c.Flush()
+	c.m.ForEach(lambda)
+}
+
+// Len flushes the buffered increments and returns the number of counters
+func (c *Counters[K]) Len() uintptr {
+	c.Flush()
+	return c.m.Len()
+}
+
+// merge adds the increments buffered in the shard to the shared map, the shard must be locked
+func (c *Counters[K]) merge(s *counterShard[K]) {
+	for key, delta := range s.deltas {
+		c.add(key, delta)
+		delete(s.deltas, key)
+	}
+	s.ops = 0
+}
+
+// add atomically adds delta to the counter of the key in the shared map, inserting it if absent
+func (c *Counters[K]) add(key K, delta int64) {
+	Add(c.m, key, delta)
+}
@@ -0,0 +1,307 @@
+package haxmap
+
+import (
+	"runtime"
+	"sync"
+)
+
+type (
+	// Snapshot is a point-in-time view of a map created with WithSnapshots
+	// writers keep modifying the map while the snapshot is alive, the value an element had when the snapshot was taken
+	// is copied aside on its first modification, so the cost of a snapshot grows with the number of modified elements instead of the map size
+	Snapshot[K comparable, V any] struct {
+		m          *Map[K, V]
+		saved      map[uintptr][]*savedEntry[K, V] // elements modified since the snapshot was taken by hash, guarded by the mutex of the map's cowState
+		iterations []*snapshotIteration[K, V]
+		refs       int // readers sharing the snapshot through Version
+		closed     bool
+	}
+
+	// savedEntry is the state of a key at the time a snapshot was taken, the key is the one stored in the map
+	savedEntry[K comparable, V any] struct {
+		key     K
+		value   V
+		present bool
+	}
+
+	// snapshotIteration is the progress of a ForEach call on a snapshot
+	// keys saved after the iteration passed them were already reported with their live value and are left out at the end
+	snapshotIteration[K comparable, V any] struct {
+		position uintptr // hash of the element processed last
+		keys     []K     // keys processed at that hash
+		started  bool
+		late     map[*savedEntry[K, V]]struct{}
+	}
+
+	// cowState coordinates writers with the snapshots of a map
+	cowState[K comparable, V any] struct {
+		closed    atomicUint32                  // a snapshot is being taken, writers wait
+		writers   [reclaimStripes]paddedCounter // number of modifications in progress
+		mu        sync.Mutex                    // guards snapshots and their contents
+		taking    sync.Mutex                    // serializes taking snapshots
+		snapshots []*Snapshot[K, V]             // open snapshots
+		active    atomicUint32                  // number of open snapshots
+		current   *Snapshot[K, V]               // latest snapshot handed out by Version
+		modified  atomicUint32                  // the map was modified since the snapshot handed out by Version was taken
+	}
+)
+
+// Snapshot returns a consistent view of the current contents of the map, writers only pause while the snapshot is registered
+// the snapshot must be closed once it is not needed anymore, until then every first modification of an element copies its value aside
+// it panics if the map was not created with WithSnapshots
+func (m *Map[K, V]) Snapshot() *Snapshot[K, V] {
+	m.init()
+	c := m.cow
+	if c == nil {
+		panic("haxmap: Snapshot called on a map created without WithSnapshots")
+	}
+	return m.snapshot(c, false)
+}
+
+// snapshot takes a snapshot of the map, a snapshot for Version is installed as the current version
+func (m *Map[K, V]) snapshot(c *cowState[K, V], version bool) *Snapshot[K, V] {
+	s := &Snapshot[K, V]{m: m, saved: make(map[uintptr][]*savedEntry[K, V]), refs: 1}
+	c.taking.Lock()
+	defer c.taking.Unlock()
+
+	// wait for modifications in progress, all modifications after that point see the snapshot and save the previous state
+	c.closed.Store(1)
+	for i := range c.writers {
+		for c.writers[i].Load() != 0 {
+			runtime.Gosched()
+		}
+	}
+	c.mu.Lock()
+	c.snapshots = append(c.snapshots, s)
+	c.active.Add(1)
+	if version {
+		// reset while writers are paused, a snapshot taken by Snapshot leaves the flag to the current version
+		c.current = s
+		c.modified.Store(0)
+	}
+	c.mu.Unlock()
+	c.closed.Store(0)
+	return s
+}
+
+// Version pins the current version of the map and returns a view of it, like Snapshot
+// readers pinning the map while it is not modified share the same snapshot, so pinning a version for every request is cheap on read-mostly maps
+// each call must be paired with a Close of the returned snapshot, the version is released once all readers sharing it closed it
+// it panics if the map was not created with WithSnapshots
+func (m *Map[K, V]) Version() *Snapshot[K, V] {
+	m.init()
+	c := m.cow
+	if c == nil {
+		panic("haxmap: Version called on a map created without WithSnapshots")
+	}
+	c.mu.Lock()
+	if s := c.current; s != nil && !s.closed && c.modified.Load() == 0 {
+		s.refs++
+		c.mu.Unlock()
+		return s
+	}
+	c.mu.Unlock()
+	return m.snapshot(c, true)
+}
+
+// Get retrieves the value the key had when the snapshot was taken
+// it panics if the snapshot was closed
+func (s *Snapshot[K, V]) Get(key K) (value V, ok bool) {
+	value, ok = s.m.Get(key)
+	// checked after reading the live value, a modification after the read would have saved the previous state already
+	c := s.m.cow
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.checkOpen()
+	if entry := s.lookup(s.m.hasher(key), key); entry != nil {
+		return entry.value, entry.present
+	}
+	return
+}
+
+// lookup returns the saved state of the key, nil if the key was not modified since the snapshot was taken
+// the mutex of the map's cowState must be held
+func (s *Snapshot[K, V]) lookup(h uintptr, key K) *savedEntry[K, V] {
+	for _, entry := range s.saved[h] {
+		if keyEquals(s.m.equal, entry.key, key) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// checkOpen panics if the snapshot was closed, its saved state is gone and the live contents of the map would be reported instead
+// the mutex of the map's cowState must be held
+func (s *Snapshot[K, V]) checkOpen() {
+	if s.closed {
+		panic("haxmap: snapshot used after it was closed")
+	}
+}
+
+// ForEach iterates over the key-value pairs the map held when the snapshot was taken
+// lambda must return `true` to continue iteration and `false` to break iteration
+// it panics if the snapshot was closed
+func (s *Snapshot[K, V]) ForEach(lambda func(K, V) bool) {
+	var (
+		m  = s.m
+		c  = m.cow
+		it = &snapshotIteration[K, V]{late: make(map[*savedEntry[K, V]]struct{})}
+	)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	c.mu.Lock()
+	s.checkOpen()
+	s.iterations = append(s.iterations, it)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		for i := range s.iterations {
+			if s.iterations[i] == it {
+				s.iterations = append(s.iterations[:i], s.iterations[i+1:]...)
+				break
+			}
+		}
+		c.mu.Unlock()
+	}()
+
+	// report the live elements which were not modified since the snapshot was taken
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		if m.stale(item) {
+			continue // recorded as modified if the snapshot is older than the ClearLazy call
+		}
+		value := item.load(m.storage)
+		c.mu.Lock()
+		if !it.started || item.keyHash != it.position {
+			it.started, it.position, it.keys = true, item.keyHash, it.keys[:0]
+		}
+		it.keys = append(it.keys, item.key)
+		modified := s.lookup(item.keyHash, item.key) != nil
+		c.mu.Unlock()
+		if !modified && !lambda(item.key, value) {
+			return
+		}
+	}
+
+	// then the saved state of the modified ones
+	var (
+		keys   []K
+		values []V
+	)
+	c.mu.Lock()
+	for _, entries := range s.saved {
+		for _, entry := range entries {
+			if _, reported := it.late[entry]; entry.present && !reported {
+				keys, values = append(keys, entry.key), append(values, entry.value)
+			}
+		}
+	}
+	c.mu.Unlock()
+	for i := range keys {
+		if !lambda(keys[i], values[i]) {
+			return
+		}
+	}
+}
+
+// Len returns the number of key-value pairs the map held when the snapshot was taken
+func (s *Snapshot[K, V]) Len() int {
+	n := 0
+	s.ForEach(func(K, V) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Close releases the snapshot, modifications of the map stop saving state for it
+// a snapshot shared by several Version calls stays open until each of them was closed
+func (s *Snapshot[K, V]) Close() {
+	c := s.m.cow
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.refs--; s.refs > 0 {
+		return
+	}
+	s.closed = true
+	if c.current == s {
+		c.current = nil
+	}
+	for i := range c.snapshots {
+		if c.snapshots[i] == s {
+			c.snapshots = append(c.snapshots[:i], c.snapshots[i+1:]...)
+			break
+		}
+	}
+	c.active.Add(^uint32(0))
+	s.saved = nil
+}
+
+// enter registers a modification of the map and returns the counter to pass to exit, it waits while a snapshot is being taken
+func (c *cowState[K, V]) enter(h uintptr) *paddedCounter {
+	counter := &c.writers[h&(reclaimStripes-1)]
+	for {
+		counter.Add(1)
+		if c.closed.Load() == 0 {
+			return counter
+		}
+		counter.Add(^uintptr(0))
+		for c.closed.Load() != 0 {
+			runtime.Gosched()
+		}
+	}
+}
+
+// exit ends a modification registered with enter
+func (c *cowState[K, V]) exit(counter *paddedCounter) {
+	counter.Add(^uintptr(0))
+}
+
+// save records the current state of the element in every open snapshot before it is modified
+// present is false for a new element about to be linked, its key is recorded as absent
+// only the first modification after a snapshot was taken is recorded, the caller must be registered with enter
+func (c *cowState[K, V]) save(m *Map[K, V], elem *element[K, V], present bool) {
+	if c.modified.Load() == 0 {
+		c.modified.Store(1) // checked first, so that writers do not contend on the flag
+	}
+	if c.active.Load() == 0 || (present && elem.isDeleted()) {
+		return // modifications of deleted elements are invisible to snapshots
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := elem.keyHash
+	for _, s := range c.snapshots {
+		if s.lookup(h, elem.key) != nil {
+			continue
+		}
+		entry := &savedEntry[K, V]{key: elem.key, present: present}
+		if present {
+			entry.value = elem.load(m.storage)
+		}
+		s.saved[h] = append(s.saved[h], entry)
+		for _, it := range s.iterations {
+			if it.passed(h, elem.key, m.equal) {
+				it.late[entry] = struct{}{}
+			}
+		}
+	}
+}
+
+// passed reports whether the iteration already processed the key
+func (it *snapshotIteration[K, V]) passed(h uintptr, key K, equal func(a, b K) bool) bool {
+	if !it.started || h > it.position {
+		return false
+	}
+	if h < it.position {
+		return true
+	}
+	for _, k := range it.keys {
+		if keyEquals(equal, k, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+//go:build haxmapdebug
+
+package haxmap
+
+import (
+	"log"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+const (
+	// number of different keys inserted with the same hash after which the hasher is considered constant
+	constantHashKeys = 64
+
+	// duration after which an iteration callback is reported as blocking
+	slowCallback = time.Second
+)
+
+// debugState tracks misuse of a map, the checks are only compiled in with the haxmapdebug build tag
+type debugState[K comparable, V any] struct {
+	mu        sync.Mutex
+	firstHash uintptr
+	sameHash  int // number of inserted keys which had the hash of the first one, -1 once a different hash was seen
+}
+
+// setHasher panics if the hasher is replaced while the map holds elements, they were hashed with the previous hasher and can no longer be found
+func (d *debugState[K, V]) setHasher(length uintptr) {
+	if length != 0 {
+		panic("haxmap: SetHasher called on a map holding elements, set the hasher before the first write or use WithHasher")
+	}
+}
+
+// insert panics on keys which can never be found once stored and logs hashers which return the same hash for every key
+func (d *debugState[K, V]) insert(key K, h uintptr, created bool) {
+	switch kind := typeOf[K]().Kind(); kind {
+	case reflect.Float32, reflect.Float64:
+		// NaN is not equal to itself, so an element with a NaN key can never be found or deleted again
+		if (kind == reflect.Float32 && math.IsNaN(float64(*(*float32)(unsafe.Pointer(&key))))) ||
+			(kind == reflect.Float64 && math.IsNaN(*(*float64)(unsafe.Pointer(&key)))) {
+			panic("haxmap: NaN key stored, the element can never be found again")
+		}
+	case reflect.Interface:
+		if v := reflect.ValueOf(any(key)); (v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64) && math.IsNaN(v.Float()) {
+			panic("haxmap: NaN key stored, the element can never be found again")
+		}
+	}
+	if !created {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case d.sameHash < 0:
+	case d.sameHash == 0:
+		d.firstHash, d.sameHash = h, 1
+	case h != d.firstHash:
+		d.sameHash = -1
+	default:
+		if d.sameHash++; d.sameHash == constantHashKeys {
+			log.Printf("haxmap: the hasher returned the same hash for the first %d different keys of a %v, every lookup has to search all elements", constantHashKeys, typeOf[*Map[K, V]]())
+		}
+	}
+}
+
+// iteration wraps an iteration callback to log calls which block for a long time
+// iterations hold back the recycling of deleted elements and may see stale elements the longer they run
+func (d *debugState[K, V]) iteration(lambda func(K, V) bool) func(K, V) bool {
+	return func(key K, value V) bool {
+		start := time.Now()
+		defer func() {
+			if elapsed := time.Since(start); elapsed > slowCallback {
+				log.Printf("haxmap: iteration callback blocked for %v on key %v", elapsed, key)
+			}
+		}()
+		return lambda(key, value)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !haxmapdebug
+
+package haxmap
+
+// debugState tracks misuse of a map when built with the haxmapdebug tag, it is empty and all checks are no-ops otherwise
+type debugState[K comparable, V any] struct{}
+
+func (d *debugState[K, V]) setHasher(length uintptr)                         {}
+func (d *debugState[K, V]) insert(key K, h uintptr, created bool)            {}
+func (d *debugState[K, V]) iteration(lambda func(K, V) bool) func(K, V) bool { return lambda }
@@ -0,0 +1,55 @@
+//go:build haxmapdebug
+
+package haxmap
+
+import (
+	"bytes"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func expectPanic(t *testing.T, name string, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s should panic", name)
+		}
+	}()
+	fn()
+}
+
+func TestDebugChecks(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	m := New[float64, int]()
+	m.Set(1, 1)
+	expectPanic(t, "SetHasher after writes", func() {
+		m.SetHasher(func(float64) uintptr { return 0 })
+	})
+	expectPanic(t, "NaN key", func() {
+		m.Set(math.NaN(), 1)
+	})
+
+	constant := NewWithOptions[int, int](WithHasher(func(int) uintptr { return 7 }))
+	for i := 0; i < constantHashKeys; i++ {
+		constant.Set(i, i)
+	}
+	if !strings.Contains(logs.String(), "same hash") {
+		t.Errorf("constant hasher should be logged, got: %q", logs.String())
+	}
+
+	logs.Reset()
+	constant.ForEach(func(key, _ int) bool {
+		time.Sleep(slowCallback + 10*time.Millisecond)
+		return false
+	})
+	if !strings.Contains(logs.String(), "iteration callback blocked") {
+		t.Errorf("blocking callback should be logged, got: %q", logs.String())
+	}
+}
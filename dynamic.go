@@ -0,0 +1,126 @@
+//go:build go1.20
+
+package haxmap
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// DynamicMap is a concurrent map whose key and value types are given as reflect.Type at runtime instead of type parameters,
+// for plugin systems and code which only learns about its types through reflection
+// it shares the lock-free list and index of Map, keys are hashed according to their type like the keys of a Map with interface keys
+type DynamicMap struct {
+	m         Map[any, any]
+	keyType   reflect.Type
+	valueType reflect.Type
+}
+
+// NewDynamicMap returns a new map holding keys of keyType and values of valueType, with an optional specific initialization size
+// It returns an error wrapping ErrUnsupportedKeyType if keys of the type cannot be hashed
+func NewDynamicMap(keyType, valueType reflect.Type, size ...uintptr) (*DynamicMap, error) {
+	if keyType == nil || valueType == nil {
+		return nil, fmt.Errorf("haxmap: key and value types of a dynamic map must not be nil")
+	}
+	if !hashableType(keyType) {
+		return nil, fmt.Errorf("%w %v", ErrUnsupportedKeyType, keyType)
+	}
+	var cfg config
+	if len(size) > 0 {
+		cfg.size = size[0]
+	}
+	d := &DynamicMap{keyType: keyType, valueType: valueType}
+	if err := d.m.configure(&cfg); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// KeyType returns the type of the keys of the map
+func (d *DynamicMap) KeyType() reflect.Type {
+	return d.keyType
+}
+
+// ValueType returns the type of the values of the map
+func (d *DynamicMap) ValueType() reflect.Type {
+	return d.valueType
+}
+
+// Get retrieves the value of the key, a key of another type is never found
+func (d *DynamicMap) Get(key any) (any, bool) {
+	key, ok := convertTo(key, d.keyType)
+	if !ok {
+		return nil, false
+	}
+	return d.m.Get(key)
+}
+
+// Set sets the value of the key, it returns an error if the key or value does not match the types of the map
+func (d *DynamicMap) Set(key, value any) error {
+	k, ok := convertTo(key, d.keyType)
+	if !ok {
+		return fmt.Errorf("haxmap: key of type %T does not match key type %v", key, d.keyType)
+	}
+	v, ok := convertTo(value, d.valueType)
+	if !ok {
+		return fmt.Errorf("haxmap: value of type %T does not match value type %v", value, d.valueType)
+	}
+	d.m.Set(k, v)
+	return nil
+}
+
+// Del deletes the key from the map and reports whether it was present
+func (d *DynamicMap) Del(key any) bool {
+	key, ok := convertTo(key, d.keyType)
+	if !ok {
+		return false
+	}
+	_, ok = d.m.GetAndDel(key)
+	return ok
+}
+
+// Len returns the number of key-value pairs in the map
+func (d *DynamicMap) Len() uintptr {
+	return d.m.Len()
+}
+
+// ForEach iterates over the key-value pairs of the map
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (d *DynamicMap) ForEach(lambda func(key, value any) bool) {
+	d.m.ForEach(lambda)
+}
+
+// hashableType reports whether the dynamic hasher of interface keys supports keys of the type
+func hashableType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Array:
+		_, ok := compileDynamicLayout(t)
+		return ok
+	case reflect.Interface:
+		return true // checked for every key by the hasher
+	default:
+		return t.Comparable()
+	}
+}
+
+// convertTo returns v as a value of type t, so that equal keys given with different but assignable types are stored alike
+// it reports false if v cannot be stored as a key or value of the type
+func convertTo(v any, t reflect.Type) (any, bool) {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface:
+			return nil, true
+		case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(t).Interface(), true
+		}
+		return nil, false
+	}
+	vt := reflect.TypeOf(v)
+	switch {
+	case vt == t || t.Kind() == reflect.Interface && vt.Implements(t):
+		return v, true
+	case vt.AssignableTo(t):
+		return reflect.ValueOf(v).Convert(t).Interface(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,138 @@
+//go:build go1.20
+
+package haxmap
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestUnsupportedKeyType(t *testing.T) {
+	type key struct {
+		id   int
+		kind any
+	}
+	if _, err := TryNew[key, int](); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("expected unsupported key type error, got %v", err)
+	}
+	m, err := TryNew[key, int](WithHasher(func(k key) uintptr { return uintptr(k.id) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set(key{1, "cat"}, 1)
+	if val, ok := m.Get(key{1, "cat"}); !ok || val != 1 {
+		t.Error("item stored within the map was not found")
+	}
+}
+
+func TestInterfaceKeys(t *testing.T) {
+	type (
+		id    int
+		point struct{ X, Y float64 }
+	)
+	var (
+		m    = New[any, int]()
+		ptr  = new(int)
+		keys = []any{nil, "a", 1, int64(1), uint8(1), id(1), 1.5, true, ptr, point{1, 2}, [2]string{"a", "b"}, complex(1, 2)}
+	)
+	for i, k := range keys {
+		m.Set(k, i)
+	}
+	if m.Len() != uintptr(len(keys)) {
+		t.Fatalf("keys of different dynamic types should be distinct, expected %d elements, got %d", len(keys), m.Len())
+	}
+	for i, k := range keys {
+		if val, ok := m.Get(k); !ok || val != i {
+			t.Errorf("key %#v: expected %d, got %d, %v", k, i, val, ok)
+		}
+	}
+	if _, ok := m.Get(point{1, 3}); ok {
+		t.Error("absent key was found")
+	}
+	m.Set(-0.0, 1)
+	if val, ok := m.Get(0.0); !ok || val != 1 {
+		t.Error("+0 and -0 keys should be equal")
+	}
+
+	seeded := NewWithOptions[any, int](WithSeed(42))
+	for i, k := range keys {
+		seeded.Set(k, i)
+	}
+	for i, k := range keys {
+		if val, ok := seeded.Get(k); !ok || val != i {
+			t.Errorf("key %#v not found in the seeded map", k)
+		}
+	}
+
+	type wrapper struct{ A any }
+	nested := []any{wrapper{}, wrapper{1}, wrapper{int64(1)}, wrapper{"a"}, wrapper{point{1, 2}}, wrapper{wrapper{1}}}
+	for i, k := range nested {
+		m.Set(k, i)
+	}
+	for i, k := range nested {
+		if val, ok := m.Get(k); !ok || val != i {
+			t.Errorf("key %#v with an interface field: expected %d, got %d, %v", k, i, val, ok)
+		}
+	}
+	if val, ok := m.Get(wrapper{point{1, 2}}); !ok || val != 4 {
+		t.Errorf("equal key with an interface field should be found, got %d, %v", val, ok)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("storing an unhashable key should panic")
+		}
+	}()
+	m.Set([]int{1}, 1)
+}
+
+func TestDynamicMap(t *testing.T) {
+	type point struct{ X, Y int }
+	d, err := NewDynamicMap(reflect.TypeOf(point{}), reflect.TypeOf(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := d.Set(point{i, -i}, strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Set(struct{ X, Y int }{1000, 0}, "unnamed"); err != nil {
+		t.Errorf("keys of an assignable type should be accepted, got %v", err)
+	}
+	if val, ok := d.Get(point{1000, 0}); !ok || val != "unnamed" {
+		t.Error("keys of an assignable type should be stored as the key type")
+	}
+	if err := d.Set(1, "x"); err == nil {
+		t.Error("key of another type should be rejected")
+	}
+	if err := d.Set(point{}, 1); err == nil {
+		t.Error("value of another type should be rejected")
+	}
+	if val, ok := d.Get(point{42, -42}); !ok || val != "42" {
+		t.Errorf("expected 42, got %v", val)
+	}
+	if _, ok := d.Get("point"); ok {
+		t.Error("key of another type should not be found")
+	}
+	if !d.Del(point{42, -42}) || d.Len() != 100 {
+		t.Errorf("deleted key should be removed, length: %d", d.Len())
+	}
+	n := 0
+	d.ForEach(func(key, value any) bool {
+		if _, ok := key.(point); !ok {
+			t.Errorf("unexpected key %#v", key)
+		}
+		n++
+		return true
+	})
+	if n != 100 {
+		t.Errorf("expected 100 pairs, got %d", n)
+	}
+
+	if _, err := NewDynamicMap(reflect.TypeOf([]int{}), reflect.TypeOf(0)); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("slice keys should be unsupported, got %v", err)
+	}
+}
@@ -1,13 +1,25 @@
 package haxmap
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
+	"net/netip"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 type Animal struct {
@@ -190,6 +202,76 @@ func TestDelete2(t *testing.T) {
 	})
 }
 
+func TestInsertBehindDeletedElement(t *testing.T) {
+	identity := WithHasher(func(key int) uintptr { return uintptr(key) })
+	m := NewWithOptions[int, int](identity)
+	m.Set(10, 10)
+	m.Set(30, 30)
+
+	// an insertion of 20 found its neighbours, then 10 is deleted and unlinked before the insertion links the new element
+	left, _, right := m.search(m.listHead, 20, 20)
+	if left == nil || left.key != 10 || right == nil || right.key != 30 {
+		t.Fatal("neighbours of the new key should be 10 and 30")
+	}
+	m.Del(10)
+	m.listHead.next()
+	alloc := m.newElement()
+	alloc.keyHash, alloc.key = 20, 20
+	if left.addBefore(alloc, right) {
+		t.Fatal("an element linked behind an unlinked element is lost")
+	}
+
+	// a run of deleted elements is unlinked at once, the links of all of them are frozen
+	m = NewWithOptions[int, int](identity)
+	m.Set(10, 10)
+	m.Set(15, 15)
+	m.Set(30, 30)
+	left, _, right = m.search(m.listHead, 20, 20)
+	_, first, _ := m.search(m.listHead, 10, 10)
+	if left == nil || left.key != 15 || right == nil || right.key != 30 || first == nil {
+		t.Fatal("neighbours of the new key should be 15 and 30")
+	}
+	first.next().remove()
+	first.remove()
+	if m.listHead.next() != right {
+		t.Fatal("deleted elements should be unlinked")
+	}
+	alloc = m.newElement()
+	alloc.keyHash, alloc.key = 20, 20
+	if left.addBefore(alloc, right) {
+		t.Fatal("an element linked behind an element unlinked together with its predecessor is lost")
+	}
+
+	// the same race between concurrent insertions and deletions of neighbouring keys
+	m = NewWithOptions[int, int](identity)
+	for i := 0; i < 2000; i += 2 {
+		m.Set(i, i)
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2000; i += 2 {
+			m.Del(i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 1; i < 2000; i += 2 {
+			m.Set(i, i)
+		}
+	}()
+	wg.Wait()
+	for i := 1; i < 2000; i += 2 {
+		if _, ok := m.Get(i); !ok {
+			t.Fatalf("key %d inserted behind a deleted key was lost", i)
+		}
+	}
+	if m.Len() != 1000 {
+		t.Errorf("map should hold 1000 elements, got %d", m.Len())
+	}
+}
+
 // from https://pkg.go.dev/sync#Map.LoadOrStore
 func TestGetOrSet(t *testing.T) {
 	var (
@@ -258,6 +340,108 @@ func TestClear(t *testing.T) {
 		}
 	}
 }
+func TestClearLazy(t *testing.T) {
+	var deleted int32
+	m := NewWithOptions[int, int](WithNodeReclamation(), WithOnDelete(func(key, value int) {
+		atomic.AddInt32(&deleted, 1)
+	}))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	m.ClearLazy()
+	if m.Len() != 0 {
+		t.Errorf("map should be empty after a lazy clear, length: %d", m.Len())
+	}
+	m.ForEach(func(key, value int) bool {
+		t.Errorf("no element should be left after a lazy clear, key: %d", key)
+		return true
+	})
+	if _, ok := m.Get(1); ok {
+		t.Error("cleared key should be absent")
+	}
+	if _, ok := m.GetAndDel(2); ok {
+		t.Error("cleared key should not be deleted again")
+	}
+	if _, swapped := m.Swap(3, 3); swapped {
+		t.Error("cleared key should not be swapped")
+	}
+	if actual, loaded := m.GetOrSet(4, -4); loaded || actual != -4 {
+		t.Errorf("cleared key should be set again, actual: %d, loaded: %v", actual, loaded)
+	}
+	m.Set(5, -5)
+	if m.Len() != 2 {
+		t.Errorf("only the new elements should be counted, length: %d", m.Len())
+	}
+	if deleted != 0 {
+		t.Errorf("lazy clear should not report deletions, deleted: %d", deleted)
+	}
+
+	// insertions discard the stale elements until none is left
+	for i := 1000; i < 1000+1000/pruneBatch+1; i++ {
+		m.Set(i, i)
+	}
+	if m.gen.Load().pruning.Load() != 0 {
+		t.Error("insertions should have pruned the whole list")
+	}
+	var linked int
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		if m.stale(item) {
+			t.Errorf("stale element should have been discarded, key: %d", item.key)
+		}
+		linked++
+	}
+	if uintptr(linked) != m.Len() {
+		t.Errorf("list should only hold the new elements, linked: %d, length: %d", linked, m.Len())
+	}
+
+	// concurrent lazy clears and insertions keep the length consistent
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				m.Set(g*2000+i, i)
+				if i%500 == 0 {
+					m.ClearLazy()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	m.Compact()
+	linked = 0
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		linked++
+	}
+	if uintptr(linked) != m.Len() {
+		t.Errorf("compact should discard all stale elements, linked: %d, length: %d", linked, m.Len())
+	}
+
+	// stale elements make no room in a bounded map, but are discarded before live ones are evicted
+	bounded := NewWithOptions[int, int](WithMaxEntries[int, int](10, nil), WithSnapshots())
+	for i := 0; i < 10; i++ {
+		bounded.Set(i, i)
+	}
+	snapshot := bounded.Snapshot()
+	defer snapshot.Close()
+	bounded.ClearLazy()
+	for i := 10; i < 20; i++ {
+		bounded.Set(i, i)
+	}
+	for i := 10; i < 20; i++ {
+		if _, ok := bounded.Get(i); !ok || bounded.Len() != 10 {
+			t.Errorf("new elements should all be kept, key: %d, length: %d", i, bounded.Len())
+		}
+	}
+	if n := snapshot.Len(); n != 10 {
+		t.Errorf("snapshot should keep the elements of before the lazy clear, length: %d", n)
+	}
+	if value, ok := snapshot.Get(3); !ok || value != 3 {
+		t.Errorf("snapshot should hold cleared key, value: %d", value)
+	}
+}
+
 
 func TestMapParallel(t *testing.T) {
 	max := 10
@@ -277,6 +461,7 @@ func TestMapParallel(t *testing.T) {
 					}
 					close(done)
 				case <-done:
+					return
 				}
 			}
 		}()
@@ -293,6 +478,7 @@ func TestMapParallel(t *testing.T) {
 					}
 					fn(t, i)
 					atomic.AddInt64(&times, 1)
+					runtime.Gosched() // single threaded platforms such as wasm do not preempt busy goroutines
 				}
 			}
 			close(done)
@@ -370,6 +556,17 @@ func TestHash0Collision(t *testing.T) {
 	if !ok {
 		t.Error("2 not found")
 	}
+
+	// the zero key hashing to zero must not be taken for the list head
+	m = NewWithOptions[string, int](WithHasher(staticHasher))
+	m.Set("", 3)
+	if value, ok := m.Get(""); !ok || value != 3 || m.Len() != 1 {
+		t.Errorf("zero key should be stored, value: %d, length: %d", value, m.Len())
+	}
+	m.Del("")
+	if _, ok := m.Get(""); ok || m.Len() != 0 {
+		t.Errorf("zero key should be deleted, length: %d", m.Len())
+	}
 }
 
 // test map freezing issue
@@ -432,3 +629,2477 @@ func TestSwap(t *testing.T) {
 		t.Error("New value not set")
 	}
 }
+
+func TestStructKeys(t *testing.T) {
+	type id struct{ Tenant, User uint64 }
+	m := New[id, int]()
+	for i := uint64(0); i < 1000; i++ {
+		m.Set(id{Tenant: i % 10, User: i}, int(i))
+	}
+	if m.Len() != 1000 {
+		t.Errorf("map should contain exactly 1000 elements but has %d", m.Len())
+	}
+	for i := uint64(0); i < 1000; i++ {
+		if val, ok := m.Get(id{Tenant: i % 10, User: i}); !ok || val != int(i) {
+			t.Errorf("wrong value for key %d, value: %d", i, val)
+		}
+	}
+
+	type mixed struct {
+		name  string
+		_     int
+		score float64
+		flag  bool
+	}
+	m2 := New[mixed, int]()
+	m2.Set(mixed{name: "cat", score: 0}, 1)
+	if val, ok := m2.Get(mixed{name: "cat", score: math.Copysign(0, -1)}); !ok || val != 1 {
+		t.Error("keys which are equal by `==` should have the same hash")
+	}
+	if _, ok := m2.Get(mixed{name: "cat", flag: true}); ok {
+		t.Error("ok should be false when item is missing from map.")
+	}
+}
+
+func TestArrayKeys(t *testing.T) {
+	m := New[[3]string, int]()
+	m.Set([3]string{"a", "b", "c"}, 1)
+	m.Set([3]string{"a", "bc", ""}, 2)
+	if val, ok := m.Get([3]string{"a", "b", "c"}); !ok || val != 1 {
+		t.Error("wrong value returned for array key")
+	}
+	if val, ok := m.Get([3]string{"a", "bc", ""}); !ok || val != 2 {
+		t.Error("wrong value returned for array key")
+	}
+}
+
+func TestBytesMap(t *testing.T) {
+	m := NewBytes[int]()
+	key := []byte("animal")
+	m.Set(key, 1)
+	key[0] = 'A' // the map must hold its own copy of the key
+
+	if _, ok := m.Get([]byte("Animal")); ok {
+		t.Error("ok should be false when item is missing from map.")
+	}
+	if val, ok := m.Get([]byte("animal")); !ok || val != 1 {
+		t.Error("item stored within the map was not found")
+	}
+	m.Set([]byte("animal"), 2)
+	if m.Len() != 1 {
+		t.Errorf("map should contain exactly one element but has %v items.", m.Len())
+	}
+	if val, loaded := m.GetOrSet([]byte("human"), 3); loaded || val != 3 {
+		t.Error("Value should not have been present")
+	}
+	m.ForEach(func(key []byte, value int) bool {
+		if (string(key) == "animal" && value != 2) || (string(key) == "human" && value != 3) {
+			t.Errorf("wrong value %d for key %s", value, key)
+		}
+		return true
+	})
+	m.Del([]byte("animal"), []byte("human"))
+	if m.Len() != 0 {
+		t.Error("map should be empty.")
+	}
+}
+
+func TestOptionsHasherAndEqual(t *testing.T) {
+	m := NewWithOptions[string, int](
+		WithHasher(func(key string) uintptr {
+			return stringHasher(strings.ToLower(key))
+		}),
+		WithEqual(strings.EqualFold),
+	)
+	m.Set("Foo", 1)
+	m.Set("FOO", 2)
+	if m.Len() != 1 {
+		t.Errorf("map should contain exactly one element but has %v items.", m.Len())
+	}
+	if val, ok := m.Get("foo"); !ok || val != 2 {
+		t.Error("keys equal under the custom equality should refer to the same element")
+	}
+	m.Del("fOO")
+	if m.Len() != 0 {
+		t.Error("map should be empty.")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("mismatched hasher should panic")
+		}
+	}()
+	NewWithOptions[int, int](WithHasher(func(string) uintptr { return 0 }))
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	m := NewWithOptions[string, int](WithKeyNormalizer(strings.ToLower))
+	m.Set("Foo", 1)
+	if val, ok := m.Get("fOO"); !ok || val != 1 {
+		t.Error("normalized keys should refer to the same element")
+	}
+	if _, loaded := m.GetOrSet("FOO", 2); !loaded {
+		t.Error("Value should have been present")
+	}
+	m.ForEach(func(key string, _ int) bool {
+		if key != "Foo" {
+			t.Errorf("the key given on insertion should be retained, got %s", key)
+		}
+		return true
+	})
+	if _, ok := m.GetAndDel("foo"); !ok || m.Len() != 0 {
+		t.Error("map should be empty.")
+	}
+}
+
+func TestStdlibKeys(t *testing.T) {
+	now := time.Now()
+	times := New[time.Time, int]()
+	times.Set(now, 1)
+	times.Set(now.Add(time.Nanosecond), 2)
+	if val, ok := times.Get(now); !ok || val != 1 {
+		t.Error("item stored within the map was not found")
+	}
+
+	addrs := New[netip.Addr, int]()
+	addrs.Set(netip.MustParseAddr("10.0.0.1"), 1)
+	addrs.Set(netip.MustParseAddr("::ffff:10.0.0.1"), 2)
+	if val, ok := addrs.Get(netip.MustParseAddr("10.0.0.1")); !ok || val != 1 {
+		t.Error("item stored within the map was not found")
+	}
+	if val, ok := addrs.Get(netip.MustParseAddr("::ffff:10.0.0.1")); !ok || val != 2 {
+		t.Error("item stored within the map was not found")
+	}
+
+	ports := New[netip.AddrPort, int]()
+	ports.Set(netip.MustParseAddrPort("10.0.0.1:80"), 1)
+	if _, ok := ports.Get(netip.MustParseAddrPort("10.0.0.1:443")); ok {
+		t.Error("ok should be false when item is missing from map.")
+	}
+
+	type uuid [16]byte
+	ids := New[uuid, int]()
+	ids.Set(uuid{1}, 1)
+	ids.Set(uuid{15: 1}, 2)
+	if val, ok := ids.Get(uuid{15: 1}); !ok || val != 2 {
+		t.Error("item stored within the map was not found")
+	}
+}
+
+func TestAESHash(t *testing.T) {
+	m := NewWithOptions[string, int](WithHashAlgorithm(AESHash))
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		if val, ok := m.Get(strconv.Itoa(i)); !ok || val != i {
+			t.Errorf("wrong value for key %d, value: %d", i, val)
+		}
+	}
+
+	type digest [32]byte
+	m2 := NewWithOptions[digest, int](WithHashAlgorithm(AESHash))
+	m2.Set(digest{1}, 1)
+	m2.Set(digest{31: 1}, 2)
+	if val, ok := m2.Get(digest{31: 1}); !ok || val != 2 {
+		t.Error("item stored within the map was not found")
+	}
+}
+
+func TestHashAlgorithms(t *testing.T) {
+	for _, alg := range []HashAlgorithm{XXHash, AESHash, Wyhash, Rapidhash} {
+		strs := NewWithOptions[string, int](WithHashAlgorithm(alg))
+		ints := NewWithOptions[int, int](WithHashAlgorithm(alg))
+		hashes := make(map[uintptr]struct{})
+		for i := 0; i < 2000; i++ {
+			key := strings.Repeat("k", i%130) + strconv.Itoa(i)
+			strs.Set(key, i)
+			ints.Set(i, i)
+			hashes[strs.hasher(key)] = struct{}{}
+		}
+		if len(hashes) != 2000 {
+			t.Errorf("algorithm %d produced %d distinct hashes for 2000 keys", alg, len(hashes))
+		}
+		for i := 0; i < 2000; i++ {
+			if val, ok := strs.Get(strings.Repeat("k", i%130) + strconv.Itoa(i)); !ok || val != i {
+				t.Errorf("algorithm %d: wrong value for string key %d", alg, i)
+			}
+			if val, ok := ints.Get(i); !ok || val != i {
+				t.Errorf("algorithm %d: wrong value for int key %d", alg, i)
+			}
+		}
+	}
+}
+
+func TestHashStats(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	stats := m.HashStats()
+	if stats.Buckets != uintptr(len(m.metadata.Load().index)) || stats.Collisions != 0 {
+		t.Errorf("unexpected hash stats %#v", stats)
+	}
+	if stats.MaxChainLength > 10 {
+		t.Errorf("default hasher should spread keys evenly, stats: %#v", stats)
+	}
+
+	m.Clear()
+	m.SetHasher(func(int) uintptr { return 42 })
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	stats = m.HashStats()
+	if stats.Collisions != 99 || stats.MaxChainLength != 100 || stats.UsedBuckets != 1 || stats.Histogram[0] != 100 {
+		t.Errorf("constant hasher should show up in the hash stats, stats: %#v", stats)
+	}
+}
+
+func TestTryNewHasherMismatch(t *testing.T) {
+	if _, err := TryNew[int, int](WithHasher(func(string) uintptr { return 0 })); err == nil {
+		t.Error("mismatched hasher should be reported")
+	}
+}
+
+func TestReserve(t *testing.T) {
+	const n = 10000
+	m := New[int, int]()
+	m.Reserve(n)
+	size := len(m.metadata.Load().index)
+	for i := 0; i < n; i++ {
+		m.Set(i, i)
+	}
+	if len(m.metadata.Load().index) != size {
+		t.Errorf("map should not be resized after reserving, old size: %d, new size: %d", size, len(m.metadata.Load().index))
+	}
+	if slab := m.slab.Load(); slab == nil || slab.next.Load() != n {
+		t.Error("inserted elements should be taken from the preallocated slab")
+	}
+	for i := 0; i < n; i++ {
+		if val, ok := m.Get(i); !ok || val != i {
+			t.Errorf("wrong value for key %d, value: %d", i, val)
+		}
+	}
+	m.Set(n, n)
+	if m.slab.Load() != nil {
+		t.Error("exhausted slab should be released")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	grown := len(m.metadata.Load().index)
+	for i := 0; i < 9500; i++ {
+		m.Del(i)
+	}
+	m.Compact()
+	if size := len(m.metadata.Load().index); size >= grown || size < 1000 {
+		t.Errorf("index should be shrunk to fit 500 elements, size: %d", size)
+	}
+	for item := m.listHead.nextPtr.Load(); item != nil; item = item.nextPtr.Load() {
+		if item.isDeleted() {
+			t.Fatal("deleted elements should be unlinked after compaction")
+		}
+	}
+	for i := 9500; i < 10000; i++ {
+		if val, ok := m.Get(i); !ok || val != i {
+			t.Errorf("wrong value for key %d, value: %d", i, val)
+		}
+	}
+}
+
+func TestMaxFillRate(t *testing.T) {
+	sparse := NewWithOptions[int, int](WithMaxFillRate(25))
+	dense := NewWithOptions[int, int](WithMaxFillRate(90))
+	for i := 0; i < 1000; i++ {
+		sparse.Set(i, i)
+		dense.Set(i, i)
+	}
+	if fr := sparse.Fillrate(); fr > 25 {
+		t.Errorf("fill rate should stay at or below 25, fillrate: %d", fr)
+	}
+	if len(dense.metadata.Load().index) >= len(sparse.metadata.Load().index) {
+		t.Error("a higher max fill rate should result in a smaller index")
+	}
+	if _, err := TryNew[int, int](WithMaxFillRate(101)); err == nil {
+		t.Error("max fill rate above 100 should be rejected")
+	}
+}
+
+type countingMetrics struct {
+	gets, hits, sets, inserts, dels, resizes int64
+}
+
+func (c *countingMetrics) Get(found bool) {
+	atomic.AddInt64(&c.gets, 1)
+	if found {
+		atomic.AddInt64(&c.hits, 1)
+	}
+}
+
+func (c *countingMetrics) Set(inserted bool) {
+	atomic.AddInt64(&c.sets, 1)
+	if inserted {
+		atomic.AddInt64(&c.inserts, 1)
+	}
+}
+
+func (c *countingMetrics) Del(removed int)                 { atomic.AddInt64(&c.dels, int64(removed)) }
+func (c *countingMetrics) Resize(oldSize, newSize uintptr) { atomic.AddInt64(&c.resizes, 1) }
+
+func TestNewWithOptions(t *testing.T) {
+	metrics := &countingMetrics{}
+	m := NewWithOptions[string, int](
+		WithSize(64),
+		WithSeed(42),
+		WithMaxFillRate(75),
+		WithGrowthFactor(4),
+		WithMetrics(metrics),
+	)
+	if len(m.metadata.Load().index) != 64 {
+		t.Error("map index size is not as expected")
+	}
+	if m.hasher("key") == New[string, int]().hasher("key") {
+		t.Error("seeded hasher should differ from the default one")
+	}
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	m.Set("0", 0)
+	if len(m.metadata.Load().index) != 256 {
+		t.Errorf("map should grow by a factor of 4, size: %d", len(m.metadata.Load().index))
+	}
+	m.Get("0")
+	m.Get("missing")
+	m.Del("0", "1", "missing")
+	if metrics.sets != 101 || metrics.inserts != 100 || metrics.gets != 2 || metrics.hits != 1 || metrics.dels != 2 || metrics.resizes != 1 {
+		t.Errorf("unexpected metrics %#v", metrics)
+	}
+}
+
+func TestMemStats(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	// mark elements for deletion without unlinking them
+	for item := m.listHead.next(); item != nil; item = item.nextPtr.Load() {
+		if item.key < 10 {
+			item.remove()
+		}
+	}
+	stats := m.MemStats()
+	if stats.Nodes != 100 || stats.DeletedNodes != 10 || stats.IndexSize != uintptr(len(m.metadata.Load().index)) {
+		t.Errorf("unexpected mem stats %#v", stats)
+	}
+	if stats.EstimatedBytes < 100*unsafe.Sizeof(element[int, int]{}) {
+		t.Errorf("estimated bytes is too low %#v", stats)
+	}
+	m.Compact()
+	if stats = m.MemStats(); stats.Nodes != 90 || stats.DeletedNodes != 0 {
+		t.Errorf("deleted elements should be unlinked after compaction %#v", stats)
+	}
+}
+
+func TestInlineValues(t *testing.T) {
+	type small struct {
+		a int16
+		b bool
+	}
+	if New[int, int]().storage != inlineValues || New[int, small]().storage != inlineValues {
+		t.Error("small pointer free values should be stored inline")
+	}
+	if New[int, *int]().storage == inlineValues || New[int, string]().storage == inlineValues || New[int, [2]uintptr]().storage == inlineValues {
+		t.Error("values holding pointers or larger than a word should not be stored inline")
+	}
+	if size := elementSize[int, int](inlineValues); size != unsafe.Sizeof(element[int, int]{})+unsafe.Sizeof(uintptr(0)) {
+		t.Errorf("inline values should replace the value pointer instead of being stored beside it, element size: %d", size)
+	}
+	if unsafe.Sizeof(element[int, int]{}) != 4*unsafe.Sizeof(uintptr(0))+8 {
+		t.Errorf("elements should only hold the hash, key, link, extension and flags with the generation, size: %d", unsafe.Sizeof(element[int, int]{}))
+	}
+
+	m := New[int, small]()
+	m.Set(1, small{a: -3, b: true})
+	if val, ok := m.Get(1); !ok || val != (small{a: -3, b: true}) {
+		t.Error("inline value was not stored correctly")
+	}
+	if !m.CompareAndSwap(1, small{a: -3, b: true}, small{a: 7}) {
+		t.Error("Compare and Swap Failed")
+	}
+	if old, swapped := m.Swap(1, small{b: true}); !swapped || old != (small{a: 7}) {
+		t.Error("Swap failed")
+	}
+
+	counters := New[int, int]()
+	counters.Set(1, 1)
+	if allocs := testing.AllocsPerRun(100, func() { counters.Set(1, 2) }); allocs != 0 {
+		t.Errorf("updating an inline value should not allocate, allocs: %v", allocs)
+	}
+}
+
+func TestSearchFromDeletedIndexSlot(t *testing.T) {
+	m := NewWithOptions[int, int](WithHasher(func(key int) uintptr { return uintptr(key) }))
+	m.Set(1, 1)
+	// the element is deleted and unlinked while the first index slot still refers to it
+	_, elem, _ := m.search(m.listHead, 1, 1)
+	elem.remove()
+	m.listHead.next()
+	m.Set(2, 2)
+	if _, ok := m.Get(2); !ok {
+		t.Error("an element inserted after a deleted element was unlinked should be found")
+	}
+}
+
+func TestNodeReclamation(t *testing.T) {
+	m := NewWithOptions[int, int](WithNodeReclamation())
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20000; i++ {
+				key := g*1000 + i%1000
+				m.Set(key, i)
+				if val, ok := m.Get(key); !ok || val != i {
+					t.Errorf("value of key %d should be %d, got %d %t", key, i, val, ok)
+					return
+				}
+				m.Del(key)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if m.Len() != 0 {
+		t.Errorf("map should be empty, length: %d", m.Len())
+	}
+	if m.reclaimer != nil && m.reclaimer.recycled.Load() == 0 {
+		t.Error("deleted elements should have been recycled")
+	}
+
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < 1000; i++ {
+		if val, ok := m.Get(i); !ok || val != i {
+			t.Fatalf("recycled elements should hold the new values, key %d got %d %t", i, val, ok)
+		}
+	}
+}
+
+func TestCounters(t *testing.T) {
+	const (
+		goroutines = 8
+		increments = 5000
+	)
+	c := NewCounters[string]()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				c.Add("hits", 1)
+				c.Add("key"+strconv.Itoa(i%10), 2)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val := c.Get("hits"); val != goroutines*increments {
+		t.Errorf("hits should be %d, got %d", goroutines*increments, val)
+	}
+	if c.Len() != 11 {
+		t.Errorf("there should be 11 counters, got %d", c.Len())
+	}
+	var total int64
+	c.ForEach(func(key string, value int64) bool {
+		total += value
+		return true
+	})
+	if total != 3*goroutines*increments {
+		t.Errorf("counters should add up to %d, got %d", 3*goroutines*increments, total)
+	}
+	c.Add("hits", -1)
+	if val := c.Get("hits"); val != goroutines*increments-1 {
+		t.Errorf("hits should be %d, got %d", goroutines*increments-1, val)
+	}
+}
+
+func TestCountersGetDuringMerge(t *testing.T) {
+	const increments = 50000
+	c := NewCounters[int]()
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				c.Add(1, 1)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for last := int64(0); ; {
+		select {
+		case <-done:
+			if val := c.Get(1); val != 4*increments {
+				t.Errorf("counter should be %d, got %d", 4*increments, val)
+			}
+			return
+		default:
+		}
+		val := c.Get(1)
+		if val < last {
+			t.Fatalf("counter went backwards from %d to %d", last, val)
+		}
+		last = val
+	}
+}
+
+func TestGetOrSetConcurrent(t *testing.T) {
+	for round := 0; round < 100; round++ {
+		var (
+			m       = New[int, int]()
+			wg      sync.WaitGroup
+			actuals [8]int
+			stored  int32
+		)
+		for g := range actuals {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				actual, loaded := m.GetOrSet(1, g)
+				if !loaded {
+					atomic.AddInt32(&stored, 1)
+				}
+				actuals[g] = actual
+			}(g)
+		}
+		wg.Wait()
+		val, _ := m.Get(1)
+		for _, actual := range actuals {
+			if actual != val {
+				t.Fatalf("all callers should see the stored value %d, got %d", val, actual)
+			}
+		}
+		if stored != 1 {
+			t.Fatalf("exactly one caller should store its value, got %d", stored)
+		}
+	}
+}
+
+func TestBatchOperations(t *testing.T) {
+	m := New[string, int]()
+	keys := make([]string, 100)
+	values := make([]int, 100)
+	for i := range keys {
+		keys[i], values[i] = strconv.Itoa(i), i
+	}
+	m.BatchSet(keys[:50], values[:50])
+	if m.Len() != 50 {
+		t.Errorf("map should hold 50 elements, got %d", m.Len())
+	}
+
+	got, found := m.BatchGet(keys, nil, nil)
+	if len(got) != len(keys) || len(found) != len(keys) {
+		t.Fatalf("results should have %d entries, got %d and %d", len(keys), len(got), len(found))
+	}
+	for i := range keys {
+		if i < 50 && (!found[i] || got[i] != i) {
+			t.Errorf("key %s should map to %d, got %d %t", keys[i], i, got[i], found[i])
+		}
+		if i >= 50 && found[i] {
+			t.Errorf("key %s should be absent", keys[i])
+		}
+	}
+
+	// reusing the result slices
+	m.BatchSet(keys[50:], values[50:])
+	got, found = m.BatchGet(keys[:3], got, found)
+	if len(got) != 3 || got[2] != 2 || !found[2] {
+		t.Errorf("results should be written into the given slices, got %v %v", got, found)
+	}
+}
+
+func TestZeroValueMap(t *testing.T) {
+	var registry struct {
+		sync.Mutex
+		users Map[string, int]
+	}
+	if _, ok := registry.users.Get("missing"); ok {
+		t.Error("zero value map should be empty")
+	}
+
+	var (
+		m  Map[int, int]
+		wg sync.WaitGroup
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				m.Set(g*100+i, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if m.Len() != 800 {
+		t.Errorf("map should hold 800 elements, got %d", m.Len())
+	}
+	if val, ok := m.Get(310); !ok || val != 10 {
+		t.Errorf("key 310 should map to 10, got %d %t", val, ok)
+	}
+}
+
+func TestIncrementalResize(t *testing.T) {
+	m := NewWithOptions[int, int](WithIncrementalResize())
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 5000; i++ {
+				key := g*5000 + i
+				m.Set(key, i)
+				if val, ok := m.Get(key); !ok || val != i {
+					t.Errorf("key %d should map to %d during resizing, got %d %t", key, i, val, ok)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if m.Len() != 20000 {
+		t.Errorf("map should hold 20000 elements, got %d", m.Len())
+	}
+
+	// a pending resize is completed by Grow
+	m.Grow(0)
+	if m.rehash.Load() != nil {
+		t.Error("no incremental resize should be pending after Grow")
+	}
+	if size := len(m.metadata.Load().index); uintptr(size)*m.maxFillRate/100 < 20000 {
+		t.Errorf("index of size %d is too small for 20000 elements", size)
+	}
+	for i := 0; i < 20000; i++ {
+		if _, ok := m.Get(i); !ok {
+			t.Fatalf("key %d should be present", i)
+		}
+	}
+}
+
+func TestIncrementalResizeWithReclamation(t *testing.T) {
+	m := NewWithOptions[int, int](WithNodeReclamation(), WithIncrementalResize())
+	for i := 0; i < 20000; i++ {
+		m.Set(i, i)
+	}
+	m.finishRehash()
+	if !m.resizing.CompareAndSwap(notResizing, resizingInProgress) {
+		t.Fatal("no resize should be in progress")
+	}
+	m.startRehash(0)
+	m.stepRehash()
+
+	// the deleted elements are already in the pending index, they must not be recycled while it refers to them
+	var deleted []int
+	for item := m.listHead.next(); item != nil && len(deleted) < rehashStep; item = item.next() {
+		deleted = append(deleted, item.key)
+	}
+	m.Del(deleted...)
+	for i := 0; i < 8; i++ {
+		m.reclaimer.reclaim(m)
+	}
+	m.finishRehash()
+
+	missing := 0
+	for i := 0; i < 20000; i++ {
+		if _, ok := m.Get(i); !ok {
+			missing++
+		}
+	}
+	if missing != len(deleted) {
+		t.Errorf("%d live keys are missing after the pending index was published", missing-len(deleted))
+	}
+}
+
+func TestManualResize(t *testing.T) {
+	m := NewWithOptions[int, int](WithSize(8), WithAutoGrow(false))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if size := len(m.metadata.Load().index); size != 8 {
+		t.Errorf("index should not grow automatically, size: %d", size)
+	}
+	for i := 0; i < 1000; i++ {
+		if val, ok := m.Get(i); !ok || val != i {
+			t.Fatalf("key %d should map to itself in an overfilled index, got %d %t", i, val, ok)
+		}
+	}
+
+	m.Rehash(0)
+	if size := len(m.metadata.Load().index); size != 2048 {
+		t.Errorf("index should be rehashed to fit 1000 elements, size: %d", size)
+	}
+	m.Rehash(16)
+	if size := len(m.metadata.Load().index); size != 16 {
+		t.Errorf("index should be shrunk to the requested size, size: %d", size)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, ok := m.Get(i); !ok {
+			t.Fatalf("key %d should be present after rehashing", i)
+		}
+	}
+}
+
+func TestArena(t *testing.T) {
+	m := NewWithOptions[int, int](WithArena())
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < 1000; i++ {
+		if val, ok := m.Get(i); !ok || val != i {
+			t.Fatalf("key %d should map to itself, got %d %t", i, val, ok)
+		}
+	}
+	if reserved := m.MemStats().ReservedNodes; reserved == 0 || reserved >= arenaChunk {
+		t.Errorf("the current slab should have spare elements, reserved: %d", reserved)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		m.Del(1)
+		m.Set(1, 1)
+	}); allocs > 1 {
+		t.Errorf("inserting into an arena should rarely allocate, allocs: %v", allocs)
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	var expired []string
+	m := NewWithOptions[string, int](WithOnExpire(func(key string, value int) {
+		expired = append(expired, key+"="+strconv.Itoa(value))
+	}))
+	m.SetWithTTL("short", 1, time.Millisecond)
+	m.SetWithTTL("long", 2, time.Hour)
+	m.SetWithTTL("plain", 3, time.Millisecond)
+	m.Set("plain", 3) // a plain Set makes the element permanent
+
+	if remaining, ok := m.TTL("long"); !ok || remaining <= 0 || remaining > time.Hour {
+		t.Errorf("remaining TTL should be below an hour, got %v %t", remaining, ok)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := m.Get("short"); ok {
+		t.Error("expired element should not be returned")
+	}
+	if val, ok := m.Get("plain"); !ok || val != 3 {
+		t.Error("element set without a TTL should not expire")
+	}
+	if remaining, ok := m.TTL("plain"); !ok || remaining != 0 {
+		t.Errorf("element set without a TTL should report no deadline, got %v %t", remaining, ok)
+	}
+	if len(expired) != 1 || expired[0] != "short=1" {
+		t.Errorf("expiration callback should be notified of the expired element, got %v", expired)
+	}
+
+	m.SetWithTTL("sweep", 4, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if !m.sweepExpired() {
+		t.Error("elements with a TTL should still be pending")
+	}
+	if m.Len() != 2 {
+		t.Errorf("sweeping should remove the expired element, length: %d", m.Len())
+	}
+}
+
+func TestLRU(t *testing.T) {
+	m := NewLRU[int, int](100)
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	// clear the reference bits set on insertion by inserting and deleting one element, which evicts the element of the lowest hash
+	m.Set(-1, -1)
+	m.Del(-1)
+	var recent []int
+	for i := 0; len(recent) < 50; i++ {
+		if _, ok := m.Get(i); ok {
+			recent = append(recent, i)
+		}
+	}
+	for i := 100; i < 150; i++ {
+		m.Set(i, i)
+	}
+	if m.Len() != 100 {
+		t.Errorf("map should stay at its capacity, length: %d", m.Len())
+	}
+	for _, i := range recent {
+		if _, ok := m.Get(i); !ok {
+			t.Errorf("recently used key %d should not be evicted", i)
+		}
+	}
+	for i := 100; i < 150; i++ {
+		if _, ok := m.Get(i); !ok {
+			t.Errorf("newly inserted key %d should not be evicted", i)
+		}
+	}
+}
+
+func TestLRUConcurrent(t *testing.T) {
+	m := NewLRU[int, int](64)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 5000; i++ {
+				m.Set(g*5000+i, i)
+				m.Get(g*5000 + i/2)
+			}
+		}(g)
+	}
+	wg.Wait()
+	count := uintptr(0)
+	m.ForEach(func(int, int) bool {
+		count++
+		return true
+	})
+	if count != m.Len() || count > 64 {
+		t.Errorf("map should hold at most 64 elements, length: %d, iterated: %d", m.Len(), count)
+	}
+}
+
+func TestTinyLFU(t *testing.T) {
+	m := NewLRU[int, int](100, WithTinyLFU())
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			m.Set(i, i)
+			m.Get(i)
+		}
+	}
+	// a scan of keys seen only once must not push out the frequently used ones
+	for i := 1000; i < 3000; i++ {
+		m.Set(i, i)
+	}
+	if m.Len() > 100 {
+		t.Errorf("map should hold at most 100 elements, length: %d", m.Len())
+	}
+	hot := 0
+	for i := 0; i < 50; i++ {
+		if _, ok := m.Get(i); ok {
+			hot++
+		}
+	}
+	if hot < 45 {
+		t.Errorf("frequently used keys should survive the scan, kept %d of 50", hot)
+	}
+
+	plain := NewLRU[int, int](100)
+	for i := 0; i < 50; i++ {
+		plain.Set(i, i)
+	}
+	for i := 1000; i < 3000; i++ {
+		plain.Set(i, i)
+	}
+	if _, ok := plain.Get(0); ok {
+		t.Error("without admission filter the scan should evict old keys")
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	var evicted int32
+	m := NewWithOptions[int, int](WithMaxEntries(64, func(key, value int) {
+		if key != value {
+			t.Errorf("evicted pair should match, key: %d, value: %d", key, value)
+		}
+		atomic.AddInt32(&evicted, 1)
+	}))
+
+	var (
+		wg       sync.WaitGroup
+		finished uint32
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for atomic.LoadUint32(&finished) == 0 {
+			if n := m.Len(); n > 64 {
+				t.Errorf("map should never hold more than 64 elements, length: %d", n)
+				return
+			}
+			runtime.Gosched()
+		}
+	}()
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				m.Set(g*2000+i, g*2000+i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	atomic.StoreUint32(&finished, 1)
+	<-done
+	if m.Len() != 64 || atomic.LoadInt32(&evicted) != 8*2000-64 {
+		t.Errorf("every insertion beyond the ceiling should evict once, length: %d, evicted: %d", m.Len(), evicted)
+	}
+
+	// overwriting an existing key of a full map must not evict
+	before := atomic.LoadInt32(&evicted)
+	m.ForEach(func(key, value int) bool {
+		m.Set(key, value)
+		return true
+	})
+	if atomic.LoadInt32(&evicted) != before {
+		t.Errorf("overwrites should not evict, evicted: %d", atomic.LoadInt32(&evicted)-before)
+	}
+
+	if _, err := TryNew[int, int](WithMaxEntries[int, int](0, nil)); err == nil {
+		t.Error("a ceiling of 0 should be rejected")
+	}
+	if _, err := TryNew[int, int](WithMaxEntries[string, int](1, func(string, int) {})); err == nil {
+		t.Error("an eviction callback of another type should be rejected")
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	sizeOf := func(key int, value string) int { return 8 + len(value) }
+	var evicted int32
+	m := NewWithOptions[int, string](
+		WithMaxBytes(1000, sizeOf),
+		WithMaxEntries(100000, func(key int, value string) {
+			atomic.AddInt32(&evicted, 1)
+		}),
+	)
+	if m.Len() != 0 || m.Bytes() != 0 {
+		t.Errorf("new map should be empty, length: %d, bytes: %d", m.Len(), m.Bytes())
+	}
+
+	for i := 0; i < 500; i++ {
+		m.Set(i, strconv.Itoa(i))
+		if b := m.Bytes(); b > 1000 {
+			t.Fatalf("map should stay within its budget, bytes: %d", b)
+		}
+	}
+	var total int64
+	m.ForEach(func(key int, value string) bool {
+		total += int64(sizeOf(key, value))
+		return true
+	})
+	if total != m.Bytes() || int(m.Len())+int(atomic.LoadInt32(&evicted)) != 500 {
+		t.Errorf("tracked size should match the elements, bytes: %d, actual: %d, length: %d, evicted: %d", m.Bytes(), total, m.Len(), evicted)
+	}
+
+	// growing a value is accounted and evicts other elements
+	before := m.Len()
+	m.Set(499, strings.Repeat("x", 500))
+	if m.Bytes() > 1000 || m.Len() >= before {
+		t.Errorf("growing a value should evict, bytes: %d, length: %d", m.Bytes(), m.Len())
+	}
+	m.Del(499)
+
+	// a value larger than the budget is rejected
+	m.Set(-1, strings.Repeat("x", 2000))
+	if _, ok := m.Get(-1); ok || m.Bytes() > 1000 {
+		t.Errorf("value larger than the budget should be evicted, bytes: %d", m.Bytes())
+	}
+
+	m.Clear()
+	if m.Bytes() != 0 {
+		t.Errorf("cleared map should have no size, bytes: %d", m.Bytes())
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Set(g*1000+i, strconv.Itoa(i))
+				m.Del(g*1000 + i - 3)
+			}
+		}(g)
+	}
+	wg.Wait()
+	total = 0
+	m.ForEach(func(key int, value string) bool {
+		total += int64(sizeOf(key, value))
+		return true
+	})
+	if total != m.Bytes() || total > 1000 {
+		t.Errorf("tracked size should match the elements after concurrent use, bytes: %d, actual: %d", m.Bytes(), total)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	var events []string
+	m := NewWithOptions[int, string](
+		WithOnInsert(func(key int, value string) {
+			events = append(events, fmt.Sprintf("insert %d=%s", key, value))
+		}),
+		WithOnUpdate(func(key int, oldValue, newValue string) {
+			events = append(events, fmt.Sprintf("update %d=%s->%s", key, oldValue, newValue))
+		}),
+		WithOnDelete(func(key int, value string) {
+			events = append(events, fmt.Sprintf("delete %d=%s", key, value))
+		}),
+	)
+	m.Set(1, "a")
+	m.Set(1, "b")
+	m.GetOrSet(1, "c")
+	m.Swap(1, "c")
+	m.CompareAndSwap(1, "x", "y")
+	m.CompareAndSwap(1, "c", "d")
+	m.Del(1, 2)
+	m.GetAndDel(1)
+	expected := []string{"insert 1=a", "update 1=a->b", "update 1=b->c", "update 1=c->d", "delete 1=d"}
+	if strings.Join(events, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("hooks should report every mutation once, expected: %v, got: %v", expected, events)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		deleted []int
+	)
+	wg.Add(100)
+	async := NewWithOptions[int, int](WithAsyncHooks(4), WithOnDelete(func(key, _ int) {
+		mu.Lock()
+		deleted = append(deleted, key)
+		mu.Unlock()
+		wg.Done()
+	}))
+	for i := 0; i < 100; i++ {
+		async.Set(i, i)
+		async.Del(i)
+	}
+	wg.Wait()
+	for i, key := range deleted {
+		if key != i {
+			t.Fatalf("asynchronous hooks should run in order, expected: %d, got: %d", i, key)
+		}
+	}
+
+	if _, err := TryNew[int, int](WithOnInsert(func(string, int) {})); err == nil {
+		t.Error("a hook of another type should be rejected")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	m := New[int, string]()
+	for i := 0; i < 100; i++ {
+		m.Set(i, strconv.Itoa(i))
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gomap map[int]string
+	if err := json.Unmarshal(data, &gomap); err != nil || len(gomap) != 100 || gomap[42] != "42" {
+		t.Errorf("map should encode like a Go map, error: %v, length: %d", err, len(gomap))
+	}
+
+	var decoded Map[int, string]
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Len() != 100 {
+		t.Errorf("decoded map should hold 100 elements, length: %d", decoded.Len())
+	}
+	if size := len(decoded.metadata.Load().index); decoded.Len()*100/uintptr(size) > decoded.maxFillRate {
+		t.Errorf("decoded map should be sized for its elements, index size: %d", size)
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := decoded.Get(i); !ok || v != strconv.Itoa(i) {
+			t.Errorf("decoded value of %d should be %d, got: %s", i, i, v)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"a": 1}`), &decoded); err == nil {
+		t.Error("keys which are not integers should be rejected")
+	}
+}
+
+func TestGob(t *testing.T) {
+	m := New[string, []int]()
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), []int{i, i * 2})
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	decoded := New[string, []int]()
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Len() != 100 {
+		t.Errorf("decoded map should hold 100 elements, length: %d", decoded.Len())
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := decoded.Get(strconv.Itoa(i)); !ok || len(v) != 2 || v[1] != i*2 {
+			t.Errorf("decoded value of %d should be [%d %d], got: %v", i, i, i*2, v)
+		}
+	}
+
+	var empty Map[int, any]
+	data, err := empty.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := empty.GobDecode(data); err != nil || empty.Len() != 0 {
+		t.Errorf("empty map should round-trip, error: %v, length: %d", err, empty.Len())
+	}
+
+	// the size is only a hint, a huge one must neither panic nor allocate for all of it
+	buf.Reset()
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(uintptr(1 << 62)); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(false); err != nil {
+		t.Fatal(err)
+	}
+	huge := New[int, int]()
+	if err := huge.GobDecode(buf.Bytes()); err != nil || huge.Len() != 0 {
+		t.Errorf("huge size hint should decode an empty map, error: %v, length: %d", err, huge.Len())
+	}
+	if err := huge.GobDecode(buf.Bytes()[:buf.Len()-1]); err == nil {
+		t.Error("truncated data should be rejected")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	type level int8
+	m := New[string, level]()
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), level(i%256-128))
+	}
+	var buf bytes.Buffer
+	written, err := m.WriteTo(&buf)
+	if err != nil || written != int64(buf.Len()) {
+		t.Fatalf("snapshot should be written, error: %v, written: %d, buffered: %d", err, written, buf.Len())
+	}
+	size := buf.Len()
+	buf.WriteString("trailing")
+
+	var restored Map[string, level]
+	read, err := restored.ReadFrom(&buf)
+	if err != nil || read != int64(size) || buf.String() != "trailing" {
+		t.Fatalf("snapshot should be read up to its end, error: %v, read: %d of %d", err, read, size)
+	}
+	if restored.Len() != 1000 {
+		t.Errorf("restored map should hold 1000 elements, length: %d", restored.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := restored.Get(strconv.Itoa(i)); !ok || v != level(i%256-128) {
+			t.Errorf("restored value of %d should be %d, got: %d", i, i%256-128, v)
+		}
+	}
+
+	times := New[time.Time, float64]()
+	now := time.Now().UTC()
+	times.Set(now, 1.5)
+	buf.Reset()
+	if _, err := times.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	restoredTimes := New[time.Time, float64]()
+	if _, err := restoredTimes.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := restoredTimes.Get(now); !ok || v != 1.5 {
+		t.Errorf("binary marshalers should be restored, got: %v", v)
+	}
+	if _, err := restoredTimes.ReadFrom(bytes.NewReader(data[:len(data)-3])); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("truncated snapshot should be rejected, error: %v", err)
+	}
+	if _, err := restoredTimes.ReadFrom(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("snapshot without its element count should be rejected, error: %v", err)
+	}
+
+	// the leading size is only a hint, a huge one must not allocate for all of it, the trailing count must match the elements read
+	huge := append([]byte("haxmap\x01"), 0xff, 0xff, 0xff, 0xff, 0x07, 0, 0)
+	if _, err := New[int, int]().ReadFrom(bytes.NewReader(huge)); err != nil {
+		t.Errorf("huge size hint should restore an empty map, error: %v", err)
+	}
+	huge[len(huge)-1] = 1
+	if _, err := New[int, int]().ReadFrom(bytes.NewReader(huge)); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("snapshot with a wrong element count should be rejected, error: %v", err)
+	}
+
+	if _, err := New[int, []int]().WriteTo(&buf); err == nil {
+		t.Error("unsupported value type should be rejected")
+	}
+}
+
+func TestMapConversions(t *testing.T) {
+	src := make(map[int]string)
+	for i := 0; i < 1000; i++ {
+		src[i] = strconv.Itoa(i)
+	}
+	metrics := &countingMetrics{}
+	m := FromMap(src, WithMetrics(metrics))
+	if m.Len() != 1000 || atomic.LoadInt64(&metrics.resizes) != 1 {
+		t.Errorf("map should be filled with a single resize, length: %d, resizes: %d", m.Len(), metrics.resizes)
+	}
+	dst := m.ToMap()
+	if len(dst) != 1000 || dst[500] != "500" {
+		t.Errorf("builtin map should hold all elements, length: %d", len(dst))
+	}
+
+	m.InsertMap(map[int]string{0: "zero", 1000: "1000"})
+	if v, _ := m.Get(0); v != "zero" || m.Len() != 1001 {
+		t.Errorf("inserted map should overwrite existing keys, value: %s, length: %d", v, m.Len())
+	}
+}
+
+func TestEncodeFunc(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(i, i*i)
+	}
+	var pairs [][2]int
+	if err := m.EncodeFunc(func(key, value int) error {
+		pairs = append(pairs, [2]int{key, value})
+		return nil
+	}); err != nil || len(pairs) != 100 {
+		t.Fatalf("every element should be passed once, error: %v, passed: %d", err, len(pairs))
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := m.EncodeFunc(func(int, int) error {
+		calls++
+		return stop
+	}); err != stop || calls != 1 {
+		t.Errorf("encoding should stop at the first error, error: %v, calls: %d", err, calls)
+	}
+
+	decoded := New[int, int]()
+	if err := decoded.DecodeFunc(func() (key, value int, err error) {
+		if len(pairs) == 0 {
+			return 0, 0, io.EOF
+		}
+		key, value, pairs = pairs[0][0], pairs[0][1], pairs[1:]
+		return
+	}); err != nil || decoded.Len() != 100 {
+		t.Fatalf("every element should be decoded, error: %v, length: %d", err, decoded.Len())
+	}
+	if v, ok := decoded.Get(9); !ok || v != 81 {
+		t.Errorf("decoded value of 9 should be 81, got: %d", v)
+	}
+	if err := decoded.DecodeFunc(func() (int, int, error) { return 0, 0, stop }); err != stop {
+		t.Errorf("decoding should return the error of next, got: %v", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	m := New[int, int](8)
+	stats := m.Stats()
+	if stats.Len != 0 || stats.Capacity != 8 || stats.Resizes != 0 || stats.MaxChainLength != 0 {
+		t.Errorf("empty map should have empty stats, got: %+v", stats)
+	}
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	stats = m.Stats()
+	if stats.Len != 100 || stats.Capacity <= 100 || stats.Resizes == 0 || stats.FillRate != m.Fillrate() {
+		t.Errorf("stats should reflect the grown map, got: %+v", stats)
+	}
+
+	collisions := NewWithOptions[int, int](WithHasher(func(int) uintptr { return 42 }))
+	for i := 0; i < 10; i++ {
+		collisions.Set(i, i)
+	}
+	if stats := collisions.Stats(); stats.MaxChainLength != 10 {
+		t.Errorf("keys sharing a hash should form a single chain, got: %d", stats.MaxChainLength)
+	}
+}
+
+func TestSnapshotView(t *testing.T) {
+	const keys = 512
+	m := NewWithOptions[int, int](WithSnapshots())
+	var (
+		stop uint32
+		done = make(chan struct{})
+	)
+	// every even round sets all keys in ascending order and every odd one deletes them again,
+	// so a consistent view holds keys of one state up to some key and keys of the previous state after it
+	go func() {
+		defer close(done)
+		for round := 0; atomic.LoadUint32(&stop) == 0; round++ {
+			for k := 0; k < keys; k++ {
+				if round%2 == 0 {
+					m.Set(k, round)
+				} else {
+					m.Del(k)
+				}
+			}
+			runtime.Gosched()
+		}
+	}()
+
+	type state struct {
+		value   int
+		present bool
+	}
+	for i := 0; i < 50; i++ {
+		s := m.Snapshot()
+		time.Sleep(time.Millisecond) // let the writer modify the map after the snapshot was taken
+		view := make(map[int]int)
+		s.ForEach(func(key, value int) bool {
+			if _, ok := view[key]; ok {
+				t.Errorf("key %d reported twice", key)
+			}
+			view[key] = value
+			return true
+		})
+		if n := s.Len(); n != len(view) {
+			t.Errorf("snapshot length should be stable, expected: %d, got: %d", len(view), n)
+		}
+		states := make([]state, keys)
+		for k := range states {
+			states[k].value, states[k].present = view[k]
+			if v, ok := s.Get(k); v != states[k].value || ok != states[k].present {
+				t.Errorf("lookup of %d should match the iteration, expected: %v, got: %d %t", k, states[k], v, ok)
+			}
+		}
+		boundary := 0
+		for boundary < keys && states[boundary] == states[0] {
+			boundary++
+		}
+		for k := boundary; k < keys; k++ {
+			if states[k] != states[boundary] {
+				t.Fatalf("snapshot is not a point-in-time view, key 0: %v, key %d: %v, key %d: %v", states[0], boundary, states[boundary], k, states[k])
+			}
+		}
+		s.Close()
+	}
+	atomic.StoreUint32(&stop, 1)
+	<-done
+	if m.cow.active.Load() != 0 {
+		t.Error("closed snapshots should be released")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("snapshot of a map without WithSnapshots should panic")
+		}
+	}()
+	New[int, int]().Snapshot()
+}
+
+func TestSnapshotNormalizedKeys(t *testing.T) {
+	m := NewWithOptions[string, int](WithSnapshots(), WithKeyNormalizer(strings.ToLower))
+	m.Set("Foo", 1)
+	s := m.Snapshot()
+	m.Swap("FOO", 2)
+	m.CompareAndSwap("foo", 2, 3)
+	m.Set("Bar", 4)
+
+	var view []string
+	s.ForEach(func(key string, value int) bool {
+		view = append(view, fmt.Sprintf("%s=%d", key, value))
+		return true
+	})
+	if strings.Join(view, ",") != "Foo=1" {
+		t.Errorf("snapshot should hold the stored key with its previous value, got %v", view)
+	}
+	if val, ok := s.Get("fOO"); !ok || val != 1 {
+		t.Errorf("lookup of an equal key should return the previous value, got %d %t", val, ok)
+	}
+	if _, ok := s.Get("bar"); ok {
+		t.Error("key added after the snapshot was taken should be absent")
+	}
+
+	s.Close()
+	defer func() {
+		if recover() == nil {
+			t.Error("lookup in a closed snapshot should panic")
+		}
+	}()
+	s.Get("foo")
+}
+
+func TestDeterministicOrder(t *testing.T) {
+	order := func(keys []string, opts ...Option) string {
+		m := NewWithOptions[string, int](append([]Option{WithDeterministicOrder(7)}, opts...)...)
+		for _, key := range keys {
+			m.Set(key, 0)
+		}
+		var out []string
+		m.ForEach(func(key string, _ int) bool {
+			out = append(out, key)
+			return true
+		})
+		return strings.Join(out, ",")
+	}
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	reversed := []string{"h", "g", "f", "e", "d", "c", "b", "a"}
+	if order(keys) != order(reversed) {
+		t.Errorf("order should not depend on insertion order, got: %s and %s", order(keys), order(reversed))
+	}
+	// keys sharing a hash are ordered by their printed form
+	constant := WithHasher(func(string) uintptr { return 1 })
+	if got := order(reversed, constant); got != strings.Join(keys, ",") {
+		t.Errorf("keys sharing a hash should be sorted, got: %s", got)
+	}
+
+	if _, err := TryNew[string, int](WithDeterministicOrder(1), WithHashAlgorithm(AESHash)); err == nil {
+		t.Error("deterministic order with AESHash should be rejected")
+	}
+	// the order seed does not silently replace a different hash seed, whatever the order of the options
+	if _, err := TryNew[string, int](WithSeed(3), WithDeterministicOrder(7)); err == nil {
+		t.Error("deterministic order with a different hash seed should be rejected")
+	}
+	if _, err := TryNew[string, int](WithDeterministicOrder(7), WithSeed(3)); err == nil {
+		t.Error("hash seed differing from the deterministic order seed should be rejected")
+	}
+	if order(keys, WithSeed(7)) != order(keys) {
+		t.Error("deterministic order with the same hash seed should be accepted")
+	}
+}
+
+func TestOrderedIteration(t *testing.T) {
+	m := New[int, int]()
+	for _, i := range rand.Perm(1000) {
+		m.Set(i, i*2)
+	}
+	next := 0
+	ForEachOrdered(m, func(key, value int) bool {
+		if key != next || value != key*2 {
+			t.Fatalf("keys should be iterated in ascending order, expected: %d, got: %d", next, key)
+		}
+		next++
+		return true
+	})
+	if next != 1000 {
+		t.Errorf("all keys should be iterated, got: %d", next)
+	}
+
+	var keys []int
+	AscendRange(m, 100, 110, func(key, _ int) bool {
+		keys = append(keys, key)
+		return key < 104
+	})
+	if fmt.Sprint(keys) != "[100 101 102 103 104]" {
+		t.Errorf("range should be iterated in order until the lambda stops it, got: %v", keys)
+	}
+}
+
+func TestOnResize(t *testing.T) {
+	for _, incremental := range []bool{false, true} {
+		var (
+			mu      sync.Mutex
+			resizes [][2]uintptr
+			moved   int
+		)
+		opts := []Option{WithSize(8), WithOnResize(func(oldSize, newSize uintptr, migrated int, took time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			if took < 0 {
+				t.Errorf("resize duration should not be negative, got: %v", took)
+			}
+			resizes = append(resizes, [2]uintptr{oldSize, newSize})
+			moved += migrated
+		})}
+		if incremental {
+			opts = append(opts, WithIncrementalResize())
+		}
+		m := NewWithOptions[int, int](opts...)
+		for i := 0; i < 1000; i++ {
+			m.Set(i, i)
+		}
+		mu.Lock()
+		if len(resizes) == 0 || resizes[0][0] != 8 || moved == 0 || resizes[len(resizes)-1][1] != m.Cap() {
+			t.Errorf("every resize should be reported, incremental: %t, resizes: %v, migrated: %d", incremental, resizes, moved)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestVersions(t *testing.T) {
+	m := NewWithOptions[string, int](WithVersions())
+	if _, version, ok := m.GetVersioned("a"); ok || version != 0 {
+		t.Errorf("missing key should have version 0, got: %d", version)
+	}
+	if !m.SetIfVersion("a", 1, 0) || m.SetIfVersion("a", 2, 0) {
+		t.Error("version 0 should only add a missing key")
+	}
+	value, v1, ok := m.GetVersioned("a")
+	if !ok || value != 1 || v1 == 0 {
+		t.Errorf("unexpected versioned value: %d, version: %d, found: %t", value, v1, ok)
+	}
+	m.Set("a", 2)
+	if _, v2, _ := m.GetVersioned("a"); v2 <= v1 {
+		t.Errorf("version should grow on every store, got %d after %d", v2, v1)
+	}
+	if m.SetIfVersion("a", 3, v1) {
+		t.Error("stale version should not set the value")
+	}
+	_, v2, _ := m.GetVersioned("a")
+	if !m.SetIfVersion("a", 3, v2) {
+		t.Error("current version should set the value")
+	}
+	_, v3, _ := m.GetVersioned("a")
+	m.Del("a")
+	m.Set("a", 4)
+	if _, v4, _ := m.GetVersioned("a"); v4 <= v3 {
+		t.Errorf("version should not repeat after the key was added again, got %d after %d", v4, v3)
+	}
+
+	// optimistic increments never lose an update
+	const workers, increments = 8, 500
+	var wg sync.WaitGroup
+	m.Set("counter", 0)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < increments; {
+				value, version, _ := m.GetVersioned("counter")
+				if m.SetIfVersion("counter", value+1, version) {
+					n++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := m.Get("counter"); value != workers*increments {
+		t.Errorf("optimistic increments should not be lost, expected: %d, got: %d", workers*increments, value)
+	}
+
+	// every kind of update changes the version, a cleared key does not get a version again
+	_, v5, _ := m.GetVersioned("counter")
+	m.CompareAndSwap("counter", workers*increments, 0)
+	m.Swap("counter", 1)
+	Inc(m, "counter")
+	if value, v6, _ := m.GetVersioned("counter"); value != 2 || v6 != v5+3 {
+		t.Errorf("every update should raise the version once, got value %d with version %d after %d", value, v6, v5)
+	}
+	m.Clear()
+	m.Set("counter", 0)
+	if _, v7, _ := m.GetVersioned("counter"); v7 <= v5+3 {
+		t.Errorf("version should not repeat after the map was cleared, got %d", v7)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("GetVersioned should panic on a map created without WithVersions")
+		}
+	}()
+	New[string, int]().GetVersioned("a")
+}
+
+func TestWatch(t *testing.T) {
+	m := New[string, int]()
+	events, cancel := m.Watch("a")
+	all, cancelAll := m.WatchAll()
+	prefixed, cancelPrefixed := WatchPrefix(m, "b")
+	defer cancelAll()
+
+	m.Set("a", 1)
+	m.Set("a", 2)
+	m.Set("b1", 3)
+	m.Del("a")
+	m.Set("c", 4)
+
+	expected := []Event[string, int]{
+		{Type: EventInsert, Key: "a", Value: 1},
+		{Type: EventUpdate, Key: "a", Value: 2, OldValue: 1},
+		{Type: EventDelete, Key: "a", Value: 2},
+	}
+	for _, want := range expected {
+		if got := <-events; got != want {
+			t.Errorf("unexpected key event, expected: %+v, got: %+v", want, got)
+		}
+	}
+	if got := <-prefixed; got.Type != EventInsert || got.Key != "b1" {
+		t.Errorf("unexpected prefix event: %+v", got)
+	}
+	if len(all) != 5 {
+		t.Errorf("all modifications should be watched, got %d events", len(all))
+	}
+
+	cancel()
+	cancel()
+	m.Set("a", 5)
+	if _, open := <-events; open {
+		t.Error("cancelled watch should close its channel")
+	}
+
+	// a receiver falling behind learns how many events it missed
+	for i := 0; i < watchBuffer+10; i++ {
+		m.Set("b2", i)
+	}
+	for len(prefixed) > 0 {
+		<-prefixed
+	}
+	m.Set("b3", 0)
+	if got := <-prefixed; got.Missed != 10 {
+		t.Errorf("dropped events should be reported, expected 10, got: %d", got.Missed)
+	}
+	cancelPrefixed()
+}
+
+func TestKeySet(t *testing.T) {
+	var s Set[int] // the zero value is ready to use
+	for i := 0; i < 10; i++ {
+		if !s.Add(i) {
+			t.Errorf("new key %d should be added", i)
+		}
+	}
+	if s.Add(0) || !s.Has(0) || s.Has(10) || s.Len() != 10 {
+		t.Error("set should hold every key once")
+	}
+	if !s.Remove(0) || s.Remove(0) || s.Has(0) {
+		t.Error("removed key should not be in the set")
+	}
+
+	other := NewSet[int]()
+	for i := 5; i < 15; i++ {
+		other.Add(i)
+	}
+	keys := func(s *Set[int]) []int {
+		var keys []int
+		s.ForEach(func(key int) bool {
+			keys = append(keys, key)
+			return true
+		})
+		sort.Ints(keys)
+		return keys
+	}
+	if s.m.storage != noValues || elementSize[int, struct{}](noValues) != unsafe.Sizeof(element[int, struct{}]{}) {
+		t.Error("set elements should not carry any value storage")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { s.Add(1) }); allocs != 0 {
+		t.Errorf("adding a present key should not allocate, allocs: %v", allocs)
+	}
+	if got := keys(s.Union(other)); len(got) != 14 || got[0] != 1 || got[13] != 14 {
+		t.Errorf("unexpected union: %v", got)
+	}
+	if got := keys(s.Intersect(other)); len(got) != 5 || got[0] != 5 || got[4] != 9 {
+		t.Errorf("unexpected intersection: %v", got)
+	}
+	if got := keys(s.Difference(other)); len(got) != 4 || got[0] != 1 || got[3] != 4 {
+		t.Errorf("unexpected difference: %v", got)
+	}
+
+	folded := NewSetWithOptions[string](WithKeyNormalizer(strings.ToLower))
+	folded.Add("Key")
+	if !folded.Union(NewSet[string]()).Has("KEY") {
+		t.Error("set operations should keep the key equality of the set")
+	}
+}
+
+func TestMultiMap(t *testing.T) {
+	var mm MultiMap[int, string] // the zero value is ready to use
+	mm.Append(1, "a")
+	mm.Append(1, "b")
+	mm.Append(1, "a")
+	mm.Append(2, "c")
+	if got := strings.Join(mm.GetAll(1), ","); got != "a,b,a" {
+		t.Errorf("values should be kept in append order, got: %s", got)
+	}
+	if mm.GetAll(3) != nil || mm.Len() != 2 {
+		t.Error("only keys with values should be present")
+	}
+	if !mm.RemoveValue(1, "a") || mm.RemoveValue(1, "x") || strings.Join(mm.GetAll(1), ",") != "b,a" {
+		t.Errorf("first matching value should be removed, got: %v", mm.GetAll(1))
+	}
+	if !mm.RemoveValue(2, "c") || mm.Len() != 1 {
+		t.Error("key should be deleted with its last value")
+	}
+
+	// concurrent appends and removals of the same key never lose a value
+	const workers, appends = 8, 200
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for n := 0; n < appends; n++ {
+				mm.Append(3, strconv.Itoa(worker))
+				if n%2 == 0 && !mm.RemoveValue(3, strconv.Itoa(worker)) {
+					t.Error("appended value should be removable")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got := len(mm.GetAll(3)); got != workers*appends/2 {
+		t.Errorf("expected %d values, got: %d", workers*appends/2, got)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	m := New[string, int64]()
+	if got := Add(m, "a", 5); got != 5 {
+		t.Errorf("missing key should start at delta, got: %d", got)
+	}
+	if got := Inc(m, "a"); got != 6 {
+		t.Errorf("expected 6, got: %d", got)
+	}
+	if got := Dec(m, "a"); got != 5 {
+		t.Errorf("expected 5, got: %d", got)
+	}
+	if got := Dec(New[string, uint8](), "b"); got != math.MaxUint8 {
+		t.Errorf("unsigned decrement should wrap around, got: %d", got)
+	}
+	if got := Add(New[string, float64](), "c", 0.5); got != 0.5 {
+		t.Errorf("expected 0.5, got: %v", got)
+	}
+
+	const workers, increments = 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < increments; n++ {
+				Inc(m, "counter")
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := m.Get("counter"); value != workers*increments {
+		t.Errorf("concurrent increments should not be lost, expected: %d, got: %d", workers*increments, value)
+	}
+}
+
+func TestBiMap(t *testing.T) {
+	var b BiMap[string, int] // the zero value is ready to use
+	b.Put("a", 1)
+	b.Put("b", 2)
+	if v, ok := b.Get("a"); !ok || v != 1 {
+		t.Errorf("expected 1, got: %d", v)
+	}
+	if k, ok := b.GetKey(2); !ok || k != "b" {
+		t.Errorf("expected b, got: %s", k)
+	}
+	b.Put("a", 2) // unbinds a from 1 and b from 2
+	if _, ok := b.Get("b"); ok {
+		t.Error("previous key of the value should be unbound")
+	}
+	if _, ok := b.GetKey(1); ok {
+		t.Error("previous value of the key should be unbound")
+	}
+	if k, _ := b.GetKey(2); k != "a" || b.Len() != 1 {
+		t.Errorf("expected a single pair bound to a, got key: %s, length: %d", k, b.Len())
+	}
+	if !b.DelValue(2) || b.Del("a") || b.Len() != 0 {
+		t.Error("deleted pair should be gone from both directions")
+	}
+
+	// both directions agree once writers rebinding the same keys and values concurrently are done
+	var (
+		wg   sync.WaitGroup
+		stop int32
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 2000; n++ {
+				b.Put(strconv.Itoa((i+n)%8), (i*n)%8)
+				if n%7 == 0 {
+					b.Del(strconv.Itoa(n % 8))
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				for v := 0; v < 8; v++ {
+					if k, ok := b.GetKey(v); ok && len(k) != 1 {
+						t.Errorf("unexpected key: %q", k)
+					}
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	count := uintptr(0)
+	b.ForEach(func(k string, v int) bool {
+		if kk, _ := b.GetKey(v); kk != k {
+			t.Errorf("inverse of %s -> %d should be %s, got: %s", k, v, k, kk)
+		}
+		count++
+		return true
+	})
+	if count != b.Len() {
+		t.Errorf("length should match the pairs, expected: %d, got: %d", count, b.Len())
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	var om OrderedMap[string, int] // the zero value is ready to use
+	for i, key := range []string{"z", "a", "m", "b"} {
+		om.Set(key, i)
+	}
+	om.Set("a", 10) // keeps its position
+	om.Del("m")
+	om.Set("m", 11) // moves to the end
+	var got []string
+	om.ForEach(func(key string, value int) bool {
+		got = append(got, key+"="+strconv.Itoa(value))
+		return true
+	})
+	if joined := strings.Join(got, ","); joined != "z=0,a=10,b=3,m=11" {
+		t.Errorf("unexpected insertion order: %s", joined)
+	}
+	if value, ok := om.Get("a"); !ok || value != 10 || om.Len() != 4 {
+		t.Errorf("unexpected value: %d, length: %d", value, om.Len())
+	}
+}
+
+func TestLoadingMap(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+	l := NewLoadingMap(func(key string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		if key == "bad" {
+			return 0, errors.New("not found")
+		}
+		return len(key), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := l.Get("abc"); err != nil || value != 3 {
+				t.Errorf("unexpected loaded value: %d, error: %v", value, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("concurrent misses should share a single load, got %d loads", n)
+	}
+
+	if _, err := l.Get("bad"); err == nil {
+		t.Error("load error should be returned")
+	}
+	if _, err := l.Get("bad"); err == nil || atomic.LoadInt32(&loads) != 3 || l.Len() != 1 {
+		t.Error("load errors should not be stored")
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	ns := NewNamespaces[string, string, int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ns.Ns("tenant").Set(strconv.Itoa(i), i)
+		}(i)
+	}
+	wg.Wait()
+	if m, ok := ns.Get("tenant"); !ok || m.Len() != 8 || ns.Len() != 1 {
+		t.Error("concurrent first uses of a namespace should share its map")
+	}
+	if _, ok := ns.Get("other"); ok {
+		t.Error("Get should not create a namespace")
+	}
+
+	dropped, ok := ns.Drop("tenant")
+	if !ok || dropped.Len() != 8 || ns.Ns("tenant").Len() != 0 {
+		t.Error("dropped namespace should start over empty")
+	}
+	ns.Ns("empty")
+	ns.Ns("full").Set("a", 1)
+	if n := ns.DropEmpty(); n != 2 || ns.Len() != 1 {
+		t.Errorf("empty namespaces should be dropped, dropped: %d, left: %d", n, ns.Len())
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	m := New[int, string]()
+	if f := m.Freeze(); f.Len() != 0 {
+		t.Error("frozen empty map should be empty")
+	} else if _, ok := f.Get(1); ok {
+		t.Error("frozen empty map should not find any key")
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, strconv.Itoa(i))
+	}
+	m.Del(7)
+	f := m.Freeze()
+	m.Set(1000, "late")
+	for i := 0; i < 1000; i++ {
+		if value, ok := f.Get(i); ok != (i != 7) || (ok && value != strconv.Itoa(i)) {
+			t.Errorf("unexpected frozen value of %d: %q, found: %t", i, value, ok)
+		}
+	}
+	if _, ok := f.Get(1000); ok || f.Len() != 999 {
+		t.Errorf("frozen map should not see later changes, length: %d", f.Len())
+	}
+	n := 0
+	f.ForEach(func(int, string) bool {
+		n++
+		return true
+	})
+	if n != 999 {
+		t.Errorf("expected 999 pairs, got: %d", n)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	m := NewWithOptions[string, int](WithSnapshots())
+	m.Set("a", 1)
+	v1 := m.Version()
+	v2 := m.Version()
+	if v1 != v2 {
+		t.Error("readers pinning an unmodified map should share its version")
+	}
+	m.Set("a", 2)
+	v3 := m.Version()
+	if v3 == v1 {
+		t.Error("a modification should start a new version")
+	}
+	if value, _ := v1.Get("a"); value != 1 {
+		t.Errorf("pinned version should keep its contents, got: %d", value)
+	}
+	v1.Close()
+	if value, _ := v2.Get("a"); value != 1 {
+		t.Errorf("version should stay pinned until every reader released it, got: %d", value)
+	}
+	v2.Close()
+	if value, _ := v3.Get("a"); value != 2 {
+		t.Errorf("expected 2, got: %d", value)
+	}
+	v3.Close()
+	if n := m.cow.active.Load(); n != 0 {
+		t.Errorf("released versions should be reclaimed, %d still open", n)
+	}
+
+	// a snapshot taken in between does not make a modified version current again
+	v4 := m.Version()
+	m.Set("a", 3)
+	s := m.Snapshot()
+	v5 := m.Version()
+	if v5 == v4 {
+		t.Error("a modification before a snapshot should still start a new version")
+	}
+	if value, _ := v5.Get("a"); value != 3 {
+		t.Errorf("version should see the latest value, expected 3, got: %d", value)
+	}
+	s.Close()
+	v4.Close()
+	v5.Close()
+}
+
+func TestParallelForEach(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	for _, workers := range []int{0, 1, 3, 16} {
+		var (
+			mu   sync.Mutex
+			seen = make(map[int]int)
+		)
+		m.ParallelForEach(workers, func(key, value int) bool {
+			mu.Lock()
+			seen[key]++
+			mu.Unlock()
+			return key == value
+		})
+		if len(seen) != 10000 {
+			t.Errorf("every pair should be visited with %d workers, got %d", workers, len(seen))
+		}
+		for key, n := range seen {
+			if n != 1 {
+				t.Errorf("key %d visited %d times with %d workers", key, n, workers)
+			}
+		}
+	}
+
+	var calls int32
+	m.ParallelForEach(4, func(int, int) bool {
+		atomic.AddInt32(&calls, 1)
+		return false
+	})
+	if n := atomic.LoadInt32(&calls); n > 4 {
+		t.Errorf("returning false should stop all workers, got %d calls", n)
+	}
+}
+
+func TestScan(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	var (
+		seen   = make(map[int]int)
+		cursor Cursor
+		pages  int
+	)
+	for {
+		var pairs []Pair[int, int]
+		pairs, cursor = m.Scan(cursor, 64)
+		pages++
+		for _, p := range pairs {
+			seen[p.Key]++
+		}
+		// concurrent modifications do not disturb the pairs present during the whole iteration
+		m.Set(1000+pages, 0)
+		m.Del(1000 + pages - 1)
+		if cursor == 0 {
+			break
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if seen[i] != 1 {
+			t.Errorf("key %d returned %d times", i, seen[i])
+		}
+	}
+	if pages < 1000/64 {
+		t.Errorf("expected pages of about 64 pairs, got %d pages", pages)
+	}
+
+	// keys sharing a hash are never split across pages
+	m = New[int, int]()
+	m.SetHasher(func(key int) uintptr { return uintptr(key / 10) })
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	if pairs, _ := m.Scan(0, 5); len(pairs) != 10 {
+		t.Errorf("page should include the whole run of a hash, got %d pairs", len(pairs))
+	}
+}
+
+func TestForEachCtx(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	n := 0
+	if err := m.ForEachCtx(context.Background(), func(int, int) bool {
+		n++
+		return true
+	}); err != nil || n != 10000 {
+		t.Errorf("complete iteration should succeed, visited: %d, error: %v", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err := m.ForEachCtx(ctx, func(int, int) bool {
+		if n++; n == 1000 {
+			cancel()
+		}
+		return true
+	})
+	if !errors.Is(err, context.Canceled) || n >= 10000 {
+		t.Errorf("cancelled iteration should stop early, visited: %d, error: %v", n, err)
+	}
+	if err := m.ForEachCtx(ctx, func(int, int) bool {
+		t.Error("done context should not iterate")
+		return false
+	}); err == nil {
+		t.Error("done context should be reported")
+	}
+}
+
+func TestGetRef(t *testing.T) {
+	type stats struct {
+		hits  [15]uint64
+		total uint64
+	}
+	m := New[string, stats]()
+	m.Set("a", stats{})
+	for i := 0; i < 10; i++ {
+		ref, ok := m.GetRef("a")
+		if !ok {
+			t.Fatal("stored key was not found")
+		}
+		ref.hits[i]++
+		ref.total++
+	}
+	if val, _ := m.Get("a"); val.total != 10 || val.hits[9] != 1 {
+		t.Errorf("modifications through the reference should be visible, got %+v", val)
+	}
+	if _, ok := m.GetRef("b"); ok {
+		t.Error("absent key was found")
+	}
+
+	ref, _ := m.GetRef("a")
+	m.Set("a", stats{})
+	ref.total++
+	if val, _ := m.Get("a"); val.total != 0 {
+		t.Error("a reference taken before Set should not modify the new value")
+	}
+
+	// values stored inline share the element with the map, a pointer to them would race with every other access
+	panics := func(m *Map[int, int32]) (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		m.GetRef(1)
+		return
+	}
+	if !panics(New[int, int32]()) || !panics(NewWithOptions[int, int32](WithVersions())) {
+		t.Error("GetRef should panic on maps whose values are not held behind a pointer of their own")
+	}
+}
+
+func TestInterner(t *testing.T) {
+	var (
+		in   = NewInterner()
+		a    = NewWithOptions[string, int](WithInterner(in))
+		b    = NewWithOptions[string, int](WithInterner(in))
+		data = func(s string) uintptr { return *(*uintptr)(unsafe.Pointer(&s)) } // address of the backing array
+	)
+	for i := 0; i < 10; i++ {
+		// keys built separately hold separate backing arrays
+		a.Set(fmt.Sprintf("https://example.com/%d", i), i)
+		b.Set(fmt.Sprintf("https://example.com/%d", i), i)
+	}
+	if in.Len() != 10 {
+		t.Errorf("expected 10 interned keys, got %d", in.Len())
+	}
+	a.ForEach(func(key string, _ int) bool {
+		b.ForEach(func(other string, _ int) bool {
+			if key == other && data(key) != data(other) {
+				t.Errorf("key %q is stored twice", key)
+			}
+			return true
+		})
+		return true
+	})
+	if val, ok := b.Get("https://example.com/3"); !ok || val != 3 {
+		t.Error("interned key was not found")
+	}
+
+	if _, err := TryNew[int, int](WithInterner(in)); err == nil {
+		t.Error("interning non string keys should fail")
+	}
+}
+
+func TestGetWait(t *testing.T) {
+	m := New[string, int]()
+	m.Set("ready", 1)
+	if val, err := m.GetWait(context.Background(), "ready"); err != nil || val != 1 {
+		t.Errorf("present key should be returned right away, got %d, %v", val, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if val, err := m.GetWait(context.Background(), "later"); err != nil || val != 2 {
+				t.Errorf("expected the value set by the producer, got %d, %v", val, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	m.Set("other", 3)
+	m.Set("later", 2)
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.GetWait(ctx, "never"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if w := m.waiters.Load(); w.active.Load() != 0 || len(w.hashes) != 0 {
+		t.Error("finished waits should be unregistered")
+	}
+}
+
+func TestResizePolicy(t *testing.T) {
+	for _, incremental := range []bool{false, true} {
+		var sizes []uintptr
+		opts := []Option{
+			WithSize(10),
+			WithResizePolicy(func(current, length uintptr) uintptr {
+				return current + current/2
+			}),
+			WithOnResize(func(oldSize, newSize uintptr, _ int, _ time.Duration) {
+				sizes = append(sizes, newSize)
+			}),
+		}
+		if incremental {
+			opts = append(opts, WithIncrementalResize())
+		}
+		m := NewWithOptions[int, int](opts...)
+		for i := 0; i < 1000; i++ {
+			m.Set(i, i)
+		}
+		// the initial size is rounded up to 16, the policy grows it to 24 or to the fitting size if more elements were added meanwhile
+		if len(sizes) == 0 || sizes[0] < 24 || sizes[0] >= 32 {
+			t.Fatalf("the index should grow by less than doubling, sizes: %v", sizes)
+		}
+		for i := 0; i < 1000; i++ {
+			if val, ok := m.Get(i); !ok || val != i {
+				t.Fatalf("wrong value for key %d, value: %d", i, val)
+			}
+		}
+		m.Del(1, 2, 3)
+		if m.Len() != 997 {
+			t.Errorf("expected 997 elements, got %d", m.Len())
+		}
+	}
+
+	// sizes too small for the elements are raised
+	m := NewWithOptions[int, int](WithResizePolicy(func(current, length uintptr) uintptr { return 0 }))
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	if m.Fillrate() > defaultMaxFillRate {
+		t.Errorf("fill rate should stay below the maximum, got %d", m.Fillrate())
+	}
+}
+
+// run with GOARCH=386 or GOOS=js GOARCH=wasm to check the hashes of other platforms
+func TestHashDistribution(t *testing.T) {
+	const n = 1 << 14
+	check := func(name string, stats HashStats) {
+		for bin, count := range stats.Histogram {
+			if count < n/histogramBins*3/4 || count > n/histogramBins*5/4 {
+				t.Errorf("%s: skewed hash distribution, bin %d holds %d of %d keys", name, bin, count, n)
+			}
+		}
+		if stats.MaxChainLength > 16 {
+			t.Errorf("%s: max chain length %d is too long", name, stats.MaxChainLength)
+		}
+	}
+
+	ints, words, floats := New[int, int](), New[uint32, int](), New[float64, int]()
+	strs, pairs := New[string, int](), New[[2]int32, int]()
+	for i := 0; i < n; i++ {
+		ints.Set(i, i)
+		words.Set(uint32(i), i)
+		floats.Set(float64(i), i)
+		strs.Set("key-"+strconv.Itoa(i), i)
+		pairs.Set([2]int32{int32(i), int32(i >> 8)}, i)
+	}
+	check("int", ints.HashStats())
+	check("uint32", words.HashStats())
+	check("float64", floats.HashStats())
+	check("string", strs.HashStats())
+	check("[2]int32", pairs.HashStats())
+}
+
+func TestSwapIf(t *testing.T) {
+	m := New[string, time.Time]()
+	later := func(newer time.Time) func(time.Time) bool {
+		return func(old time.Time) bool {
+			return newer.After(old)
+		}
+	}
+	base := time.Unix(1000, 0)
+	if _, swapped := m.SwapIf("a", base, later(base)); swapped {
+		t.Error("absent key should not be swapped")
+	}
+	m.Set("a", base)
+	if old, swapped := m.SwapIf("a", base.Add(time.Second), later(base.Add(time.Second))); !swapped || !old.Equal(base) {
+		t.Errorf("later timestamp should replace the value, old: %v, swapped: %v", old, swapped)
+	}
+	if old, swapped := m.SwapIf("a", base, later(base)); swapped || !old.Equal(base.Add(time.Second)) {
+		t.Errorf("earlier timestamp should be rejected, old: %v, swapped: %v", old, swapped)
+	}
+
+	// concurrent updates keep the latest timestamp
+	m.Set("b", base)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				ts := base.Add(time.Duration(i*8+g) * time.Millisecond)
+				m.SwapIf("b", ts, later(ts))
+			}
+		}(g)
+	}
+	wg.Wait()
+	if val, _ := m.Get("b"); !val.Equal(base.Add(7999 * time.Millisecond)) {
+		t.Errorf("expected the latest timestamp, got %v", val)
+	}
+}
+
+func TestGetOrSetFunc(t *testing.T) {
+	m := New[string, []byte]()
+	var calls int32
+	mk := func() []byte {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond)
+		return make([]byte, 128)
+	}
+	var (
+		wg     sync.WaitGroup
+		stored int32
+	)
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, loaded := m.GetOrSetFunc("key", mk); !loaded {
+				atomic.AddInt32(&stored, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 || stored != 1 {
+		t.Errorf("the constructor should run once for the stored value, calls: %d, stored: %d", calls, stored)
+	}
+	if val, loaded := m.GetOrSetFunc("key", mk); !loaded || len(val) != 128 || calls != 1 {
+		t.Error("present key should be loaded without calling the constructor")
+	}
+	if m.computing.Load() == nil || len(m.computing.Load().calls) != 0 {
+		t.Error("finished computations should be unregistered")
+	}
+}
+
+func TestLockKey(t *testing.T) {
+	m := New[string, int]()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := "counter" + strconv.Itoa(i%4)
+				unlock := m.LockKey(key)
+				value, _ := m.Get(key)
+				runtime.Gosched() // widen the window between the read and the write
+				m.Set(key, value+1)
+				unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 4; i++ {
+		if value, _ := m.Get("counter" + strconv.Itoa(i)); value != 1000 {
+			t.Errorf("no increment should be lost under the key lock, key: counter%d, value: %d", i, value)
+		}
+	}
+
+	// the lock does not block other operations on the key
+	unlock := m.LockKey("counter0")
+	m.Set("counter0", 0)
+	if value, ok := m.Get("counter0"); !ok || value != 0 {
+		t.Errorf("operations should ignore the key lock, value: %d", value)
+	}
+	unlock()
+}
+
+func TestReduce(t *testing.T) {
+	m := New[int, int]()
+	for i := 1; i <= 1000; i++ {
+		m.Set(i, i)
+	}
+	if sum := Sum(m); sum != 500500 {
+		t.Errorf("expected a sum of 500500, got %d", sum)
+	}
+	if n := Count(m, func(key, _ int) bool { return key%2 == 0 }); n != 500 {
+		t.Errorf("expected 500 even keys, got %d", n)
+	}
+	if max := Reduce(m, 0, func(acc, _, value int) int {
+		if value > acc {
+			return value
+		}
+		return acc
+	}); max != 1000 {
+		t.Errorf("expected a max of 1000, got %d", max)
+	}
+	for _, workers := range []int{0, 1, 3, 8} {
+		sum := ParallelReduce(m, workers, 0, func(acc, _, value int) int {
+			return acc + value
+		}, func(a, b int) int {
+			return a + b
+		})
+		if sum != 500500 {
+			t.Errorf("%d workers: expected a sum of 500500, got %d", workers, sum)
+		}
+	}
+}
+
+func TestMapAlgebra(t *testing.T) {
+	a, b := New[string, int](), New[string, int]()
+	for i := 0; i < 10; i++ {
+		a.Set(strconv.Itoa(i), i)
+	}
+	for i := 5; i < 15; i++ {
+		b.Set(strconv.Itoa(i), 100*i)
+	}
+
+	union := a.Union(b, func(key string, value, otherValue int) int {
+		return value + otherValue
+	})
+	if union.Len() != 15 {
+		t.Errorf("expected 15 keys in the union, got %d", union.Len())
+	}
+	for i := 0; i < 15; i++ {
+		expected := i
+		if i >= 5 {
+			expected = 100 * i
+		}
+		if i >= 5 && i < 10 {
+			expected = 101 * i
+		}
+		if val, ok := union.Get(strconv.Itoa(i)); !ok || val != expected {
+			t.Errorf("union: expected %d for key %d, got %d", expected, i, val)
+		}
+	}
+
+	intersection := a.Intersect(b)
+	if intersection.Len() != 5 {
+		t.Errorf("expected 5 keys in the intersection, got %d", intersection.Len())
+	}
+	if val, ok := intersection.Get("7"); !ok || val != 7 {
+		t.Errorf("intersection should hold the values of the receiver, got %d", val)
+	}
+
+	difference := a.Difference(b)
+	if difference.Len() != 5 {
+		t.Errorf("expected 5 keys in the difference, got %d", difference.Len())
+	}
+	for i := 0; i < 5; i++ {
+		if val, ok := difference.Get(strconv.Itoa(i)); !ok || val != i {
+			t.Errorf("difference: expected %d, got %d", i, val)
+		}
+	}
+	if _, ok := difference.Get("5"); ok {
+		t.Error("keys of the other map should not be in the difference")
+	}
+
+	// the result normalizes keys like the receiver but is not bounded like it
+	bounded := NewWithOptions[string, int](WithKeyNormalizer(strings.ToLower), WithMaxEntries[string, int](2, nil))
+	bounded.Set("A", 1)
+	other := New[string, int]()
+	for i := 0; i < 10; i++ {
+		other.Set(strconv.Itoa(i), i)
+	}
+	union = bounded.Union(other, func(key string, value, otherValue int) int {
+		return value
+	})
+	if union.Len() != 11 {
+		t.Errorf("expected 11 keys in the union of a bounded map, got %d", union.Len())
+	}
+	if val, ok := union.Get("a"); !ok || val != 1 {
+		t.Errorf("union should normalize keys like the receiver, got %d", val)
+	}
+}
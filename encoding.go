@@ -0,0 +1,107 @@
+package haxmap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+)
+
+// maxSizeHint caps the number of elements reserved for the size read from encoded data, which may come from untrusted input
+// larger maps are still decoded, they just grow while their elements are added
+const maxSizeHint = 1 << 16
+
+// sizeHint returns the number of elements to reserve for a decoded size
+func sizeHint(size uint64) int {
+	if size > maxSizeHint {
+		return maxSizeHint
+	}
+	return int(size)
+}
+
+// EncodeFunc passes every element of the map to fn, so that any encoder can serialize the map element by element
+// without materializing its contents first, it stops at the first error returned by fn and returns it
+// elements added or removed during the call may or may not be passed
+func (m *Map[K, V]) EncodeFunc(fn func(key K, value V) error) error {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	var err error
+	m.walk(func(item *element[K, V]) bool {
+		err = fn(item.key, item.load(m.storage))
+		return err == nil
+	})
+	return err
+}
+
+// DecodeFunc sets the elements produced by next until it returns an error, it is the streaming counterpart of EncodeFunc
+// next returns io.EOF once all elements are decoded, which ends the call without an error, any other error is returned
+// call Reserve first if the number of elements is known to insert them without intermediate resizes
+func (m *Map[K, V]) DecodeFunc(next func() (key K, value V, err error)) error {
+	for {
+		key, value, err := next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		m.Set(key, value)
+	}
+}
+
+// GobEncode implements the gob.GobEncoder interface.
+// The elements are encoded one by one straight from the map without copying them into a Go map first
+func (m *Map[K, V]) GobEncode() ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		enc = gob.NewEncoder(&buf)
+	)
+	// the length is only a hint for sizing the decoded map, every element is preceded by a flag and the last one is followed by false
+	if err := enc.Encode(m.Len()); err != nil {
+		return nil, err
+	}
+	err := m.EncodeFunc(func(key K, value V) error {
+		if err := enc.Encode(true); err != nil {
+			return err
+		}
+		// encoded through pointers so that interface types keep their static type like in a Go map
+		if err := enc.Encode(&key); err != nil {
+			return err
+		}
+		return enc.Encode(&value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(false); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements the gob.GobDecoder interface.
+// The decoded elements are added to the map, which is sized up front for up to maxSizeHint of them
+func (m *Map[K, V]) GobDecode(data []byte) error {
+	var (
+		dec  = gob.NewDecoder(bytes.NewReader(data))
+		size uintptr
+	)
+	if err := dec.Decode(&size); err != nil {
+		return err
+	}
+	m.Reserve(sizeHint(uint64(size)))
+	return m.DecodeFunc(func() (key K, value V, err error) {
+		var more bool
+		if err = dec.Decode(&more); err != nil {
+			return
+		}
+		if !more {
+			return key, value, io.EOF
+		}
+		if err = dec.Decode(&key); err != nil {
+			return
+		}
+		err = dec.Decode(&value)
+		return
+	})
+}
@@ -0,0 +1,114 @@
+package haxmap
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// NewLRU returns a new HashMap instance holding at most about capacity elements
+// once the capacity is exceeded an insertion evicts an element which was not accessed recently
+// recency is approximated with the CLOCK algorithm: every access sets a reference bit on the element and a clock hand
+// sweeping over the elements clears the bits and evicts the first element found without one, so no lock or list reordering is needed
+// concurrent insertions may briefly push the number of elements above the capacity
+func NewLRU[K comparable, V any](capacity int, opts ...Option) *Map[K, V] {
+	if capacity <= 0 {
+		panic("haxmap: LRU capacity must be positive")
+	}
+	return NewWithOptions[K, V](append(opts, func(c *config) {
+		c.capacity = uintptr(capacity)
+	})...)
+}
+
+// touch sets the reference bit of the element, the bit is only written if it is not set already to keep the cache line shared
+func (self *element[K, V]) touch() {
+	for flags := atomic.LoadUint32(&self.flags); flags&referenced == 0; flags = atomic.LoadUint32(&self.flags) {
+		if atomic.CompareAndSwapUint32(&self.flags, flags, flags|referenced) {
+			return
+		}
+	}
+}
+
+// unreference clears the reference bit of the element and reports whether it was set
+func (self *element[K, V]) unreference() bool {
+	for flags := atomic.LoadUint32(&self.flags); flags&referenced != 0; flags = atomic.LoadUint32(&self.flags) {
+		if atomic.CompareAndSwapUint32(&self.flags, flags, flags&^referenced) {
+			return true
+		}
+	}
+	return false
+}
+
+// evict advances the clock hand to the next element without a reference bit and removes it
+// with an admission filter the newly inserted candidate is removed instead if it was accessed less often than that element
+// it returns false if the map has no element left to evict
+func (m *Map[K, V]) evict(candidate *element[K, V]) bool {
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	hand := m.clockHand.Load()
+	item := m.metadata.Load().indexElement(hand)
+	if item == nil || item.keyHash > hand {
+		item = m.listHead.next()
+	}
+	for item != nil && item.keyHash <= hand {
+		item = item.next()
+	}
+
+	// two rounds are enough to find an element, the first one clears all reference bits in the worst case
+	for scanned, limit := uintptr(0), 2*m.Len()+2; scanned < limit; scanned++ {
+		if item == nil { // wrap around to the start of the list
+			if item = m.listHead.next(); item == nil {
+				return false
+			}
+		}
+		if m.discardIfStale(item) {
+			return true // frees no room in the current generation, but its memory
+		}
+		if !item.unreference() { // an element with its reference bit set gets a second chance
+			if m.rejects(candidate, item) {
+				m.evictElement(candidate)
+				return true
+			} else if m.evictElement(item) {
+				m.clockHand.Store(item.keyHash)
+				return true
+			}
+		}
+		item = item.next()
+	}
+	return false
+}
+
+// rejects reports whether the admission filter prefers keeping the victim over the newly inserted candidate
+func (m *Map[K, V]) rejects(candidate, victim *element[K, V]) bool {
+	if m.sketch == nil || candidate == nil || candidate == victim || candidate.isDeleted() {
+		return false
+	}
+	return m.sketch.frequency(candidate.keyHash) <= m.sketch.frequency(victim.keyHash)
+}
+
+// evictElement removes the element and notifies the eviction callback, it returns false if the element was already deleted
+func (m *Map[K, V]) evictElement(elem *element[K, V]) bool {
+	value := elem.load(m.storage)
+	if !m.removeElement(elem) {
+		return false
+	}
+	if m.onEvict != nil {
+		m.onEvict(elem.key, value)
+	}
+	return true
+}
+
+// reserve counts a new element of a map with a hard ceiling in advance, evicting elements until there is room for it
+// it returns the generation the element was counted in
+func (m *Map[K, V]) reserve() *generation {
+	for {
+		g := m.gen.Load()
+		if n := g.numItems.Load(); n < m.capacity {
+			if g.numItems.CompareAndSwap(n, n+1) {
+				return g
+			}
+		} else if !m.evict(nil) {
+			runtime.Gosched() // the room is held by insertions in progress
+		}
+	}
+}
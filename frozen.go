@@ -0,0 +1,83 @@
+package haxmap
+
+import "strconv"
+
+// FrozenMap is an immutable copy of a map laid out for reading
+// the elements are stored in dense arrays sorted by hash, and the index maps the leading bits of a hash to the range of its elements,
+// so a lookup is a couple of plain memory reads without atomics, deleted elements or pointer chasing
+type FrozenMap[K comparable, V any] struct {
+	hasher  func(K) uintptr
+	equal   func(a, b K) bool
+	shift   uintptr   // shift of a hash to its index slot
+	offsets []uintptr // offsets[i] is the position of the first element of index slot i, followed by the number of elements
+	hashes  []uintptr
+	keys    []K
+	values  []V
+}
+
+// Freeze returns an immutable copy of the current contents of the map for maps which are built once and then read a lot
+// modifications of the map during the call may or may not be included
+func (m *Map[K, V]) Freeze() *FrozenMap[K, V] {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	n := int(m.Len())
+	f := &FrozenMap[K, V]{
+		hasher: m.hasher,
+		equal:  m.equal,
+		hashes: make([]uintptr, 0, n),
+		keys:   make([]K, 0, n),
+		values: make([]V, 0, n),
+	}
+	m.walk(func(item *element[K, V]) bool {
+		f.hashes = append(f.hashes, item.keyHash)
+		f.keys = append(f.keys, item.key)
+		f.values = append(f.values, item.load(m.storage))
+		return true
+	})
+
+	// one index slot per element at most, the elements are sorted by hash so every slot covers a contiguous range
+	size := roundUpPower2(uintptr(len(f.hashes)))
+	if size == 0 {
+		size = 1
+	}
+	f.shift = strconv.IntSize - log2(size)
+	f.offsets = make([]uintptr, size+1)
+	j := uintptr(0)
+	for i := uintptr(0); i < size; i++ {
+		f.offsets[i] = j
+		for j < uintptr(len(f.hashes)) && f.hashes[j]>>f.shift == i {
+			j++
+		}
+	}
+	f.offsets[size] = j
+	return f
+}
+
+// Get retrieves the value of the key
+func (f *FrozenMap[K, V]) Get(key K) (value V, ok bool) {
+	h := f.hasher(key)
+	i := h >> f.shift
+	for j, end := f.offsets[i], f.offsets[i+1]; j < end; j++ {
+		if f.hashes[j] == h && keyEquals(f.equal, f.keys[j], key) {
+			return f.values[j], true
+		}
+	}
+	return
+}
+
+// Len returns the number of key-value pairs
+func (f *FrozenMap[K, V]) Len() uintptr {
+	return uintptr(len(f.keys))
+}
+
+// ForEach iterates over the key-value pairs in the iteration order of the map they were copied from
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (f *FrozenMap[K, V]) ForEach(lambda func(K, V) bool) {
+	for i := range f.keys {
+		if !lambda(f.keys[i], f.values[i]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package haxmap
+
+import "sync/atomic"
+
+// maximum number of elements an insertion walks to discard elements left behind by ClearLazy
+const pruneBatch = 8
+
+// generation groups the elements added to a map between two clears, elements of an earlier generation are stale
+// and treated as absent by every operation, which discards them on the way
+type generation struct {
+	seq      uint32        // sequence number stored in the elements of the generation, never 0
+	numItems atomicUintptr // number of elements of the generation which were not removed yet
+	pruning  atomicUint32  // set while insertions discard stale elements left behind by ClearLazy
+	cursor   atomicUintptr // hash of the element the next insertion resumes pruning at
+}
+
+// ClearLazy removes all elements of the map in O(1), unlike Clear it keeps the list and the index
+// the elements are invalidated at once, every later operation treats them as absent and discards those it comes across,
+// and each insertion discards a few more, so the memory held by them is released gradually instead of all at once
+// together with WithNodeReclamation the discarded elements are recycled for new insertions, which avoids the allocation spike of rebuilding a large map
+// Compact discards all of them at once
+// like Clear it reports no deletion to hooks and watches, and with snapshots open every element is recorded for them first, which takes O(n)
+func (m *Map[K, V]) ClearLazy() {
+	m.init()
+	if c := m.cow; c != nil {
+		defer c.exit(c.enter(0))
+		for item := m.listHead.next(); item != nil; item = item.next() {
+			if !m.stale(item) {
+				c.save(m, item, true)
+			}
+		}
+	}
+	g := m.newGeneration()
+	g.pruning.Store(1)
+	m.gen.Store(g)
+	if b := m.budget; b != nil {
+		atomic.StoreInt64(&b.used, 0)
+	}
+}
+
+// newGeneration returns a generation with the next sequence number of the map
+// the numbers wrap around after 2^32 clears, an element would have to outlive that many ClearLazy calls without being pruned to be taken for a current one
+func (m *Map[K, V]) newGeneration() *generation {
+	seq := m.generations.Add(1)
+	if seq == 0 {
+		seq = m.generations.Add(1)
+	}
+	return &generation{seq: seq}
+}
+
+// stale reports whether the element belongs to a generation invalidated by ClearLazy
+// the list head belongs to no generation
+func (m *Map[K, V]) stale(elem *element[K, V]) bool {
+	return elem.gen != 0 && elem.gen != m.gen.Load().seq
+}
+
+// discardIfStale removes the element without notifying anyone if it is stale and reports whether it was
+func (m *Map[K, V]) discardIfStale(elem *element[K, V]) bool {
+	if !m.stale(elem) {
+		return false
+	}
+	if m.retireVersion(elem, anyVersion) && elem.remove() {
+		m.removeItemFromIndex(elem)
+		if m.reclaimer != nil {
+			m.reclaimer.retire(m, elem)
+		}
+		if m.incremental {
+			m.stepRehash()
+		}
+	}
+	return true
+}
+
+// search looks the key up from the start element like element.search, discarding a stale element holding the key
+// the list head holds the zero key at hash zero without being an element, so it is never returned as the element of the key
+func (m *Map[K, V]) search(start *element[K, V], h uintptr, key K) (left, curr, right *element[K, V]) {
+	for {
+		if start == m.listHead {
+			if start = m.listHead.next(); start == nil {
+				return m.listHead, nil, nil
+			}
+			if left, curr, right = start.search(h, key, m.equal); left == nil {
+				left = m.listHead
+			}
+		} else {
+			left, curr, right = start.search(h, key, m.equal)
+		}
+		if curr == nil || !m.discardIfStale(curr) {
+			return
+		}
+		if start = left; start == nil {
+			start = m.listHead
+		}
+	}
+}
+
+// prune discards the stale elements among the next few elements of the list, resuming where the last call stopped
+// the generation stops pruning once the end of the list is reached
+func (m *Map[K, V]) prune(g *generation) {
+	cursor := g.cursor.Load()
+	item := m.metadata.Load().indexElement(cursor)
+	if item == nil || item.keyHash > cursor {
+		item = m.listHead.next()
+	}
+	for item != nil && item.keyHash < cursor {
+		item = item.next()
+	}
+	for i := 0; i < pruneBatch && item != nil; i++ {
+		m.discardIfStale(item)
+		cursor = item.keyHash
+		item = item.next()
+	}
+	if item == nil || cursor == ^uintptr(0) {
+		g.pruning.Store(0)
+		return
+	}
+	g.cursor.Store(cursor + 1) // elements sharing the hash of the last one are left to the operations coming across them
+}
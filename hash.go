@@ -27,8 +27,14 @@ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
 import (
 	"encoding/binary"
+	"fmt"
+	"math"
 	"math/bits"
+	"net/netip"
 	"reflect"
+	"strconv"
+	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -41,6 +47,24 @@ const (
 	owordSize
 )
 
+// HashAlgorithm selects the family of default hash functions used by a map
+type HashAlgorithm uint8
+
+const (
+	// XXHash is the default pure Go xxHash algorithm
+	XXHash HashAlgorithm = iota
+
+	// AESHash uses the hardware accelerated hash function of the Go runtime for string keys and fixed size keys of 16 bytes or more
+	// the hash values are randomly seeded once per process, builds with the haxmap_purego tag use a seeded wyhash instead
+	AESHash
+
+	// Wyhash is suited for workloads dominated by short string keys
+	Wyhash
+
+	// Rapidhash is the successor of wyhash with better throughput on medium and long keys
+	Rapidhash
+)
+
 const (
 	prime1 uint64 = 11400714785074694791
 	prime2 uint64 = 14029467366897019727
@@ -89,7 +113,7 @@ var (
 		h ^= h >> 29
 		h *= prime3
 		h ^= h >> 32
-		return uintptr(h)
+		return foldHash(h)
 	}
 
 	// word hasher, key size -> 2 bytes
@@ -104,7 +128,7 @@ var (
 		h ^= h >> 29
 		h *= prime3
 		h ^= h >> 32
-		return uintptr(h)
+		return foldHash(h)
 	}
 
 	// dword hasher, key size -> 4 bytes
@@ -117,7 +141,7 @@ var (
 		h ^= h >> 29
 		h *= prime3
 		h ^= h >> 32
-		return uintptr(h)
+		return foldHash(h)
 	}
 
 	// separate dword hasher for float32 type
@@ -133,7 +157,7 @@ var (
 		h ^= h >> 29
 		h *= prime3
 		h ^= h >> 32
-		return uintptr(h)
+		return foldHash(h)
 	}
 
 	// qword hasher, key size -> 8 bytes
@@ -148,7 +172,7 @@ var (
 		h ^= h >> 29
 		h *= prime3
 		h ^= h >> 32
-		return uintptr(h)
+		return foldHash(h)
 	}
 
 	// separate qword hasher for float64 type
@@ -164,7 +188,7 @@ var (
 		h ^= h >> 29
 		h *= prime3
 		h ^= h >> 32
-		return uintptr(h)
+		return foldHash(h)
 	}
 
 	// separate qword hasher for complex64 type
@@ -179,69 +203,201 @@ var (
 		h ^= h >> 29
 		h *= prime3
 		h ^= h >> 32
-		return uintptr(h)
+		return foldHash(h)
+	}
+
+	// oword hasher, key size -> 16 bytes
+	owordHasher = func(key [owordSize]byte) uintptr {
+		return owordHash(u64(key[0:8]), u64(key[8:16]))
+	}
+
+	// time hasher
+	// times which are equal by `==` always have the same unix seconds and nanoseconds
+	timeHasher = func(key time.Time) uintptr {
+		return owordHash(uint64(key.Unix()), uint64(key.Nanosecond()))
+	}
+
+	// ip address hasher, the bit length distinguishes IPv4 from IPv4-mapped IPv6 addresses
+	addrHasher = func(key netip.Addr) uintptr {
+		b := key.As16()
+		return owordHash(u64(b[0:8])^uint64(key.BitLen()), u64(b[8:16]))
+	}
+
+	// ip address and port hasher
+	addrPortHasher = func(key netip.AddrPort) uintptr {
+		b := key.Addr().As16()
+		return owordHash(u64(b[0:8])^(uint64(key.Port())<<16|uint64(key.Addr().BitLen())), u64(b[8:16]))
 	}
 )
 
-func (m *Map[K, V]) setDefaultHasher() {
-	// default hash functions
-	switch reflect.TypeOf(*new(K)).Kind() {
-	case reflect.String:
-		// use default xxHash algorithm for key of any size for golang string data type
-		m.hasher = func(key K) uintptr {
-			sh := (*reflect.StringHeader)(unsafe.Pointer(&key))
-			b := unsafe.Slice((*byte)(unsafe.Pointer(sh.Data)), sh.Len)
-			n := sh.Len
-			var h uint64
-
-			if n >= 32 {
-				v1 := prime1v + prime2
-				v2 := prime2
-				v3 := uint64(0)
-				v4 := -prime1v
-				for len(b) >= 32 {
-					v1 = round(v1, u64(b[0:8:len(b)]))
-					v2 = round(v2, u64(b[8:16:len(b)]))
-					v3 = round(v3, u64(b[16:24:len(b)]))
-					v4 = round(v4, u64(b[24:32:len(b)]))
-					b = b[32:len(b):len(b)]
-				}
-				h = rol1(v1) + rol7(v2) + rol12(v3) + rol18(v4)
-				h = mergeRound(h, v1)
-				h = mergeRound(h, v2)
-				h = mergeRound(h, v3)
-				h = mergeRound(h, v4)
-			} else {
-				h = prime5
-			}
+// owordHash hashes 16 bytes of input given as two little endian qwords
+func owordHash(lo, hi uint64) uintptr {
+	h := prime5 + 16
 
-			h += uint64(n)
+	k1 := lo * prime2
+	k1 = bits.RotateLeft64(k1, 31)
+	k1 *= prime1
 
-			i, end := 0, len(b)
-			for ; i+8 <= end; i += 8 {
-				k1 := round(0, u64(b[i:i+8:len(b)]))
-				h ^= k1
-				h = rol27(h)*prime1 + prime4
-			}
-			if i+4 <= end {
-				h ^= uint64(u32(b[i:i+4:len(b)])) * prime1
-				h = rol23(h)*prime2 + prime3
-				i += 4
-			}
-			for ; i < end; i++ {
-				h ^= uint64(b[i]) * prime5
-				h = rol11(h) * prime1
-			}
+	h ^= k1
+	h = bits.RotateLeft64(h, 27)*prime1 + prime4
+
+	k1 = hi * prime2
+	k1 = bits.RotateLeft64(k1, 31)
+	k1 *= prime1
+
+	h ^= k1
+	h = bits.RotateLeft64(h, 27)*prime1 + prime4
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+
+	return foldHash(h)
+}
 
-			h ^= h >> 33
-			h *= prime2
-			h ^= h >> 29
-			h *= prime3
-			h ^= h >> 32
+// xxHash computes the 64-bit xxHash digest of a byte slice of any size
+func xxHash(b []byte, seed uint64) uint64 {
+	n := len(b)
+	var h uint64
+
+	if n >= 32 {
+		v1 := seed + prime1v + prime2
+		v2 := seed + prime2
+		v3 := seed
+		v4 := seed - prime1v
+		for len(b) >= 32 {
+			v1 = round(v1, u64(b[0:8:len(b)]))
+			v2 = round(v2, u64(b[8:16:len(b)]))
+			v3 = round(v3, u64(b[16:24:len(b)]))
+			v4 = round(v4, u64(b[24:32:len(b)]))
+			b = b[32:len(b):len(b)]
+		}
+		h = rol1(v1) + rol7(v2) + rol12(v3) + rol18(v4)
+		h = mergeRound(h, v1)
+		h = mergeRound(h, v2)
+		h = mergeRound(h, v3)
+		h = mergeRound(h, v4)
+	} else {
+		h = seed + prime5
+	}
+
+	h += uint64(n)
+
+	i, end := 0, len(b)
+	for ; i+8 <= end; i += 8 {
+		k1 := round(0, u64(b[i:i+8:len(b)]))
+		h ^= k1
+		h = rol27(h)*prime1 + prime4
+	}
+	if i+4 <= end {
+		h ^= uint64(u32(b[i:i+4:len(b)])) * prime1
+		h = rol23(h)*prime2 + prime3
+		i += 4
+	}
+	for ; i < end; i++ {
+		h ^= uint64(b[i]) * prime5
+		h = rol11(h) * prime1
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+
+	return h
+}
+
+// string hasher, key of any size
+var stringHasher = func(key string) uintptr {
+	sh := (*reflect.StringHeader)(unsafe.Pointer(&key))
+	return foldHash(xxHash(unsafe.Slice((*byte)(unsafe.Pointer(sh.Data)), sh.Len), 0))
+}
+
+// foldHash reduces a 64 bit hash to the size of a uintptr
+// on platforms with 32 bit pointers such as 386 and arm the upper half is mixed into the lower one instead of being dropped,
+// the branch is resolved at compile time
+func foldHash(h uint64) uintptr {
+	if strconv.IntSize == 32 {
+		h ^= h >> 32
+	}
+	return uintptr(h)
+}
+
+// typeOf returns the static type of T, unlike reflect.TypeOf it also works for interface types
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
 
-			return uintptr(h)
+// setHashAlgorithm replaces the default hasher with the one provided by the algorithm and seed if it supports the key type
+// keys which cannot be hashed as raw bytes fall back to a seeded xxHash
+func (m *Map[K, V]) setHashAlgorithm(alg HashAlgorithm, seed uint64) {
+	var applied bool
+	switch alg {
+	case XXHash:
+		if seed == 0 {
+			return // the default hashers are unseeded xxHash
+		}
+		applied = m.setBytesHasher(func(b []byte) uint64 { return xxHash(b, seed) }, 0)
+	case AESHash:
+		applied = m.setBytesHasher(runtimeHash, owordSize)
+	case Wyhash:
+		applied = m.setBytesHasher(func(b []byte) uint64 { return wyhash(b, seed) }, 0)
+	case Rapidhash:
+		applied = m.setBytesHasher(func(b []byte) uint64 { return rapidhash(b, seed) }, 0)
+	}
+	if !applied && seed != 0 {
+		if typeOf[K]().Kind() == reflect.Interface {
+			m.hasher = interfaceHasher[K](seed)
+		} else if fields, ok := compileKeyLayout(typeOf[K](), 0, nil); ok {
+			m.hasher = compositeHasher[K](fields, seed)
 		}
-	case reflect.Int, reflect.Uint, reflect.Uintptr, reflect.UnsafePointer:
+	}
+}
+
+// setBytesHasher hashes string keys and keys made up of a single contiguous region of plain memory with the given function
+// keys of other types and fixed size keys smaller than minSize keep using the default hasher, in which case false is returned
+func (m *Map[K, V]) setBytesHasher(hashBytes func([]byte) uint64, minSize uintptr) bool {
+	t := typeOf[K]()
+	if t.Kind() == reflect.String {
+		m.hasher = func(key K) uintptr {
+			sh := (*reflect.StringHeader)(unsafe.Pointer(&key))
+			return foldHash(hashBytes(unsafe.Slice((*byte)(unsafe.Pointer(sh.Data)), sh.Len)))
+		}
+		return true
+	}
+	if fields, ok := compileKeyLayout(t, 0, nil); ok && len(fields) == 1 && fields[0].kind == memoryField && fields[0].size >= minSize {
+		offset, size := fields[0].offset, int(fields[0].size)
+		m.hasher = func(key K) uintptr {
+			return foldHash(hashBytes(unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(&key), offset)), size)))
+		}
+		return true
+	}
+	return false
+}
+
+func (m *Map[K, V]) setDefaultHasher() {
+	// specialized hash functions for common standard library key types
+	switch any(*new(K)).(type) {
+	case time.Time:
+		m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&timeHasher))
+		return
+	case netip.Addr:
+		m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&addrHasher))
+		return
+	case netip.AddrPort:
+		m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&addrPortHasher))
+		return
+	}
+
+	// default hash functions
+	switch typeOf[K]().Kind() {
+	case reflect.String:
+		// use default xxHash algorithm for key of any size for golang string data type
+		m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&stringHasher))
+	case reflect.Int, reflect.Uint, reflect.Uintptr, reflect.UnsafePointer, reflect.Pointer, reflect.Chan:
 		switch intSizeBytes {
 		case 2:
 			// word hasher
@@ -253,7 +409,7 @@ func (m *Map[K, V]) setDefaultHasher() {
 			// qword hasher
 			m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&qwordHasher))
 		}
-	case reflect.Int8, reflect.Uint8:
+	case reflect.Int8, reflect.Uint8, reflect.Bool:
 		// byte hasher
 		m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&byteHasher))
 	case reflect.Int16, reflect.Uint16:
@@ -276,37 +432,244 @@ func (m *Map[K, V]) setDefaultHasher() {
 		m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&complex64Hasher))
 	case reflect.Complex128:
 		// oword hasher, key size -> 16 bytes
-		m.hasher = func(key K) uintptr {
-			b := *(*[owordSize]byte)(unsafe.Pointer(&key))
-			h := prime5 + 16
+		m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&owordHasher))
+	case reflect.Array:
+		t := typeOf[K]()
+		if t.Len() == owordSize && t.Elem().Kind() == reflect.Uint8 {
+			// [16]byte keys such as UUIDs
+			m.hasher = *(*func(K) uintptr)(unsafe.Pointer(&owordHasher))
+		} else if fields, ok := compileKeyLayout(t, 0, nil); ok {
+			m.hasher = compositeHasher[K](fields, 0)
+		}
+	case reflect.Struct:
+		// composite keys are hashed field by field according to their memory layout
+		if fields, ok := compileKeyLayout(typeOf[K](), 0, nil); ok {
+			m.hasher = compositeHasher[K](fields, 0)
+		}
+	case reflect.Interface:
+		// keys of mixed types, the hash function is chosen from the dynamic type of every key
+		m.hasher = interfaceHasher[K](0)
+	}
+}
 
-			val := uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
-				uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+// kinds of regions within the memory of a composite key
+const (
+	memoryField uint8 = iota // plain memory compared byte by byte
+	stringField
+	float32Field
+	float64Field
+	interfaceField // hashed according to the dynamic type of the value it holds
+)
 
-			k1 := val * prime2
-			k1 = bits.RotateLeft64(k1, 31)
-			k1 *= prime1
+// keyField is a region within the memory of a composite key which takes part in equality
+type keyField struct {
+	offset, size uintptr
+	kind         uint8
+	typ          reflect.Type // static type of an interface field
+}
 
-			h ^= k1
-			h = bits.RotateLeft64(h, 27)*prime1 + prime4
+// compileKeyLayout flattens a comparable type into the regions of memory that are compared by `==`
+// returns false if the type contains a kind whose hash cannot be derived from its memory
+func compileKeyLayout(t reflect.Type, offset uintptr, fields []keyField) ([]keyField, bool) {
+	return compileLayout(t, offset, fields, false)
+}
 
-			val = uint64(b[8]) | uint64(b[9])<<8 | uint64(b[10])<<16 | uint64(b[11])<<24 |
-				uint64(b[12])<<32 | uint64(b[13])<<40 | uint64(b[14])<<48 | uint64(b[15])<<56
+// compileDynamicLayout flattens the dynamic type of an interface key, its interface fields are hashed by their own dynamic type
+func compileDynamicLayout(t reflect.Type) ([]keyField, bool) {
+	return compileLayout(t, 0, nil, true)
+}
 
-			k1 = val * prime2
-			k1 = bits.RotateLeft64(k1, 31)
-			k1 *= prime1
+// compileLayout flattens a comparable type, interface fields are only supported if dynamic is set
+func compileLayout(t reflect.Type, offset uintptr, fields []keyField, dynamic bool) ([]keyField, bool) {
+	ok := true
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Pointer, reflect.UnsafePointer, reflect.Chan:
+		fields = appendMemoryField(fields, offset, t.Size())
+	case reflect.Float32:
+		fields = append(fields, keyField{offset: offset, size: 4, kind: float32Field})
+	case reflect.Float64:
+		fields = append(fields, keyField{offset: offset, size: 8, kind: float64Field})
+	case reflect.Complex64:
+		fields = append(fields, keyField{offset: offset, size: 4, kind: float32Field}, keyField{offset: offset + 4, size: 4, kind: float32Field})
+	case reflect.Complex128:
+		fields = append(fields, keyField{offset: offset, size: 8, kind: float64Field}, keyField{offset: offset + 8, size: 8, kind: float64Field})
+	case reflect.String:
+		fields = append(fields, keyField{offset: offset, size: t.Size(), kind: stringField})
+	case reflect.Interface:
+		fields, ok = append(fields, keyField{offset: offset, size: t.Size(), kind: interfaceField, typ: t}), dynamic
+	case reflect.Array:
+		for i := 0; i < t.Len() && ok; i++ {
+			fields, ok = compileLayout(t.Elem(), offset+uintptr(i)*t.Elem().Size(), fields, dynamic)
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField() && ok; i++ {
+			// blank fields do not take part in struct equality
+			if f := t.Field(i); f.Name != "_" {
+				fields, ok = compileLayout(f.Type, offset+f.Offset, fields, dynamic)
+			}
+		}
+	default:
+		ok = false
+	}
+	return fields, ok
+}
 
-			h ^= k1
-			h = bits.RotateLeft64(h, 27)*prime1 + prime4
+// appendMemoryField adds a plain memory region, merging it with the previous one if they are adjacent
+func appendMemoryField(fields []keyField, offset, size uintptr) []keyField {
+	if n := len(fields); n > 0 && fields[n-1].kind == memoryField && fields[n-1].offset+fields[n-1].size == offset {
+		fields[n-1].size += size
+		return fields
+	}
+	return append(fields, keyField{offset: offset, size: size, kind: memoryField})
+}
 
-			h ^= h >> 33
-			h *= prime2
-			h ^= h >> 29
-			h *= prime3
-			h ^= h >> 32
+// compositeHasher returns a hasher for struct and array keys given their compiled layout
+func compositeHasher[K comparable](fields []keyField, seed uint64) func(K) uintptr {
+	// fast path for keys made up of a single contiguous region of plain memory, example struct{ Tenant, User uint64 }
+	if len(fields) == 1 && fields[0].kind == memoryField {
+		offset, size := fields[0].offset, int(fields[0].size)
+		return func(key K) uintptr {
+			return foldHash(xxHash(unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(&key), offset)), size), seed))
+		}
+	}
+	return func(key K) uintptr {
+		return foldHash(hashKeyFields(unsafe.Pointer(&key), fields, seed))
+	}
+}
 
-			return uintptr(h)
+// hashKeyFields hashes the regions of the composite key at p
+func hashKeyFields(p unsafe.Pointer, fields []keyField, seed uint64) uint64 {
+	h := seed + prime5 + uint64(len(fields))
+	for _, f := range fields {
+		h = mergeRound(h, hashKeyField(unsafe.Add(p, f.offset), f))
+	}
+	return avalanche(h)
+}
+
+// avalanche is the final mixing step of xxHash
+func avalanche(h uint64) uint64 {
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
+
+// hashKeyField hashes a single region of a composite key
+func hashKeyField(p unsafe.Pointer, f keyField) uint64 {
+	switch f.kind {
+	case stringField:
+		sh := (*reflect.StringHeader)(p)
+		return xxHash(unsafe.Slice((*byte)(unsafe.Pointer(sh.Data)), sh.Len), 0)
+	case float32Field:
+		// +0 and -0 are equal but differ in their bits
+		if v := *(*float32)(p); v != 0 {
+			return uint64(math.Float32bits(v))
+		}
+		return 0
+	case float64Field:
+		if v := *(*float64)(p); v != 0 {
+			return math.Float64bits(v)
 		}
+		return 0
+	case interfaceField:
+		// like a Go map, it panics on values whose dynamic type is not comparable
+		return hashDynamic(reflect.NewAt(f.typ, p).Elem().Interface(), 0)
+	default:
+		return xxHash(unsafe.Slice((*byte)(p), f.size), 0)
 	}
 }
+
+// layouts of the dynamic struct and array types of interface keys, reflect.Type -> []keyField
+var dynamicLayouts sync.Map
+
+// interfaceHasher returns a hasher for interface keys which dispatches on the dynamic type of every key
+// like a Go map, it panics on keys whose dynamic type is not comparable
+func interfaceHasher[K comparable](seed uint64) func(K) uintptr {
+	return func(key K) uintptr {
+		return foldHash(hashDynamic(any(key), seed))
+	}
+}
+
+// hashDynamic hashes the value held by an interface according to its dynamic type
+func hashDynamic(key any, seed uint64) uint64 {
+	var h uint64
+	// fast paths for the most common key types, named types and composite keys go through reflection
+	switch k := key.(type) {
+	case nil:
+		return avalanche(seed + prime5)
+	case string:
+		return hashString(k, seed)
+	case int:
+		h = uint64(k)
+	case int64:
+		h = uint64(k)
+	case uint64:
+		h = k
+	case int32:
+		h = uint64(k)
+	case uint32:
+		h = uint64(k)
+	default:
+		v := reflect.ValueOf(key)
+		switch v.Kind() {
+		case reflect.String:
+			return hashString(v.String(), seed)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			h = uint64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			h = v.Uint()
+		case reflect.Bool:
+			if v.Bool() {
+				h = 1
+			}
+		case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+			h = uint64(v.Pointer())
+		case reflect.Float32, reflect.Float64:
+			// +0 and -0 are equal but differ in their bits
+			if f := v.Float(); f != 0 {
+				h = math.Float64bits(f)
+			}
+		case reflect.Complex64, reflect.Complex128:
+			c := v.Complex()
+			if r := real(c); r != 0 {
+				h = math.Float64bits(r)
+			}
+			if i := imag(c); i != 0 {
+				h ^= bits.RotateLeft64(math.Float64bits(i), 32)
+			}
+		default:
+			return hashDynamicComposite(v, seed)
+		}
+	}
+	return avalanche(mergeRound(seed+prime5+8, h))
+}
+
+// hashDynamicComposite hashes a struct or array held by an interface key with the compiled layout of its type
+func hashDynamicComposite(v reflect.Value, seed uint64) uint64 {
+	t := v.Type()
+	cached, ok := dynamicLayouts.Load(t)
+	if !ok {
+		fields, supported := []keyField(nil), false
+		if k := t.Kind(); k == reflect.Struct || k == reflect.Array {
+			fields, supported = compileDynamicLayout(t)
+		}
+		if !supported {
+			panic(fmt.Sprintf("haxmap: hash of unsupported key type %v", t))
+		}
+		cached, _ = dynamicLayouts.LoadOrStore(t, fields)
+	}
+	// the value is copied to addressable memory, interfaces do not expose the memory of the value they hold
+	p := reflect.New(t)
+	p.Elem().Set(v)
+	return hashKeyFields(p.UnsafePointer(), cached.([]keyField), seed)
+}
+
+// hashString hashes the bytes of a string
+func hashString(s string, seed uint64) uint64 {
+	sh := (*reflect.StringHeader)(unsafe.Pointer(&s))
+	return xxHash(unsafe.Slice((*byte)(unsafe.Pointer(sh.Data)), sh.Len), seed)
+}
@@ -0,0 +1,8 @@
+//go:build !haxmap_purego
+
+package haxmap
+
+import "hash/maphash"
+
+// processSeed seeds the runtime hash function for the lifetime of the process
+var processSeed = maphash.MakeSeed()
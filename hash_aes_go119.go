@@ -0,0 +1,11 @@
+//go:build go1.19 && !haxmap_purego
+
+package haxmap
+
+import "hash/maphash"
+
+// runtimeHash hashes bytes with the runtime hash function
+// the runtime detects CPU support for AES instructions on startup and falls back to a portable implementation otherwise
+func runtimeHash(b []byte) uint64 {
+	return maphash.Bytes(processSeed, b)
+}
@@ -0,0 +1,14 @@
+//go:build haxmap_purego
+
+package haxmap
+
+import "time"
+
+// processSeed seeds the stand-in of the runtime hash function for the lifetime of the process
+var processSeed = uint64(time.Now().UnixNano())
+
+// runtimeHash hashes bytes with wyhash in place of the runtime hash function
+// the haxmap_purego build tag avoids depending on the internals of the Go runtime, so that the package builds with TinyGo and other restricted toolchains
+func runtimeHash(b []byte) uint64 {
+	return wyhash(b, processSeed)
+}
@@ -0,0 +1,58 @@
+package haxmaptest
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Distribution draws the indexes of the keys operated on, Config.Key turns them into keys
+// it is called once per goroutine with the source of randomness of the goroutine and returns the function drawing its indexes
+type Distribution func(r *rand.Rand) func() int
+
+// Uniform draws the indexes 0 to n-1 with equal probability
+func Uniform(n int) Distribution {
+	if n <= 0 {
+		panic(fmt.Sprintf("haxmaptest: number of keys must be positive, got %d", n))
+	}
+	return func(r *rand.Rand) func() int {
+		return func() int {
+			return r.Intn(n)
+		}
+	}
+}
+
+// Zipf draws the indexes 0 to n-1 following Zipf's law with exponent s, which must be greater than 1
+// low indexes are drawn far more often than high ones, the larger s the more skewed the distribution
+func Zipf(n int, s float64) Distribution {
+	if n <= 0 {
+		panic(fmt.Sprintf("haxmaptest: number of keys must be positive, got %d", n))
+	}
+	if s <= 1 {
+		panic(fmt.Sprintf("haxmaptest: zipf exponent must be greater than 1, got %v", s))
+	}
+	return func(r *rand.Rand) func() int {
+		z := rand.NewZipf(r, s, 1, uint64(n-1))
+		return func() int {
+			return int(z.Uint64())
+		}
+	}
+}
+
+// Hotspot draws one of the first hot indexes with probability p and any of the indexes 0 to n-1 otherwise
+// it concentrates the contention on a few keys while the map still holds many
+func Hotspot(n, hot int, p float64) Distribution {
+	if hot <= 0 || hot > n {
+		panic(fmt.Sprintf("haxmaptest: number of hot keys must be between 1 and %d, got %d", n, hot))
+	}
+	if p < 0 || p > 1 {
+		panic(fmt.Sprintf("haxmaptest: probability must be between 0 and 1, got %v", p))
+	}
+	return func(r *rand.Rand) func() int {
+		return func() int {
+			if r.Float64() < p {
+				return r.Intn(hot)
+			}
+			return r.Intn(n)
+		}
+	}
+}
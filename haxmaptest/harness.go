@@ -0,0 +1,377 @@
+// Package haxmaptest stress tests haxmap maps and checks the outcome for consistency
+//
+// Run drives a map from many goroutines with a configurable mix of operations on keys drawn from a configurable distribution.
+// It records every operation and checks afterwards that the history of every key is linearizable, meaning that each operation
+// appears to take effect at a single instant between its call and its return, and that the final state of the map is consistent.
+// It is meant for maps set up with custom hashers, equality functions and options, where a broken hasher shows up as lost updates.
+//
+//	m := haxmap.NewWithOptions[string, uint64](haxmap.WithHasher(hash))
+//	res, err := haxmaptest.Run(m, haxmaptest.Config[string]{Key: strconv.Itoa, Keys: haxmaptest.Zipf(1000, 1.1)})
+//
+// The operations of every goroutine are derived from the seed, so a failure is reproduced by running the same configuration with the reported seed,
+// the interleaving of the goroutines is still up to the scheduler.
+package haxmaptest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alphadose/haxmap"
+)
+
+// kinds of operations performed by the harness
+const (
+	OpGet Op = iota
+	OpSet
+	OpDel
+	OpGetAndDel
+	OpGetOrSet
+	OpCompareAndSwap
+	OpSwap
+	OpAdd
+	numOps
+)
+
+// number of violations and operations of a history shown by Result.Err
+const (
+	maxReportedViolations = 5
+	maxReportedOperations = 20
+)
+
+type (
+	// Op is the kind of an operation performed on the map
+	Op uint8
+
+	// Mix gives the relative frequency of every kind of operation, kinds missing from it are not performed
+	Mix map[Op]int
+
+	// Config configures a run of the harness, only Key is required
+	Config[K comparable] struct {
+		Goroutines int           // number of goroutines operating on the map concurrently, GOMAXPROCS by default
+		Operations int           // number of operations performed by every goroutine, 1000 by default
+		Mix        Mix           // frequency of the kinds of operations, all kinds are performed by default with a majority of reads
+		Keys       Distribution  // distribution of the indexes of the keys operated on, Uniform(64) by default
+		Key        func(i int) K // key of an index drawn from the distribution, different indexes must map to different keys
+		Seed       int64         // seed of the operations of the goroutines, taken from the clock if zero
+		Yield      float64       // probability of yielding the processor between two operations, to vary the interleavings
+	}
+
+	// Operation is a single operation recorded by the harness, Input is the value passed in and Output the value returned if any
+	// the values stored by Set, GetOrSet, CompareAndSwap and Swap are unique, the goroutine index plus one in the upper 32 bits and the operation index plus one in the lower ones
+	Operation[K comparable] struct {
+		Goroutine int // index of the goroutine which performed the operation, -1 for the reads of the final state
+		Op        Op
+		Key       K
+		Input     uint64
+		Expected  uint64 // old value passed to CompareAndSwap
+		Output    uint64
+		OK        bool   // presence of the key, whether the value was loaded or swapped depending on the kind of operation
+		Call      uint64 // logical time of the call
+		Return    uint64 // logical time of the return
+	}
+
+	// Violation is an inconsistency found by the harness, the history holds the operations on the key sorted by call time
+	// it is empty for violations which are not tied to a single key, such as a length which does not match the elements
+	Violation[K comparable] struct {
+		Key     K
+		Message string
+		History []Operation[K]
+	}
+
+	// Result is the outcome of a run of the harness
+	Result[K comparable] struct {
+		Seed       int64 // seed of the run, to run the same operations again
+		Operations int   // number of operations performed
+		Keys       int   // number of distinct keys operated on
+		Violations []Violation[K]
+	}
+)
+
+// defaultMix is used if Config.Mix is empty
+var defaultMix = Mix{
+	OpGet:            40,
+	OpSet:            20,
+	OpDel:            10,
+	OpGetAndDel:      5,
+	OpGetOrSet:       10,
+	OpCompareAndSwap: 5,
+	OpSwap:           5,
+	OpAdd:            5,
+}
+
+// Run performs the configured operations on the map, which must be empty, and checks their outcome
+// it returns an error if the configuration is invalid, violations found are reported by the result
+func Run[K comparable](m *haxmap.Map[K, uint64], cfg Config[K]) (*Result[K], error) {
+	if cfg.Key == nil {
+		return nil, errors.New("haxmaptest: key function must be set")
+	}
+	if m.Len() != 0 {
+		return nil, fmt.Errorf("haxmaptest: map must be empty, length: %d", m.Len())
+	}
+	if cfg.Goroutines <= 0 {
+		cfg.Goroutines = runtime.GOMAXPROCS(0)
+	}
+	if cfg.Operations <= 0 {
+		cfg.Operations = 1000
+	}
+	if len(cfg.Mix) == 0 {
+		cfg.Mix = defaultMix
+	}
+	if cfg.Keys == nil {
+		cfg.Keys = Uniform(64)
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	weights, err := cfg.Mix.cumulative()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		clock     uint64
+		histories = make([][]Operation[K], cfg.Goroutines)
+		start     = make(chan struct{})
+		wg        sync.WaitGroup
+	)
+	for g := 0; g < cfg.Goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			var (
+				r        = rand.New(rand.NewSource(cfg.Seed + int64(g)))
+				next     = cfg.Keys(r)
+				history  = make([]Operation[K], 0, cfg.Operations)
+				lastSeen = make(map[K]uint64) // values last observed by the goroutine, expected by its CompareAndSwap calls
+			)
+			<-start
+			for i := 0; i < cfg.Operations; i++ {
+				op := Operation[K]{
+					Goroutine: g,
+					Op:        pick(weights, r),
+					Key:       cfg.Key(next()),
+					Input:     uint64(g+1)<<32 | uint64(i+1), // unique among all operations
+				}
+				op.Expected = lastSeen[op.Key]
+				perform(m, &op, &clock)
+				if op.OK {
+					lastSeen[op.Key] = op.Output
+				}
+				history = append(history, op)
+				if cfg.Yield > 0 && r.Float64() < cfg.Yield {
+					runtime.Gosched()
+				}
+			}
+			histories[g] = history
+		}(g)
+	}
+	close(start)
+	wg.Wait()
+
+	res := &Result[K]{Seed: cfg.Seed}
+	byKey := make(map[K][]Operation[K])
+	for _, history := range histories {
+		for _, op := range history {
+			byKey[op.Key] = append(byKey[op.Key], op)
+		}
+		res.Operations += len(history)
+	}
+	res.Keys = len(byKey)
+	res.checkFinalState(m, byKey, atomic.LoadUint64(&clock))
+	for key, history := range byKey {
+		if !linearizable(history) {
+			res.violate(key, "history is not linearizable", history)
+		}
+	}
+	sort.Slice(res.Violations, func(i, j int) bool {
+		a, b := res.Violations[i].History, res.Violations[j].History
+		return len(a) > 0 && (len(b) == 0 || a[0].Call < b[0].Call)
+	})
+	return res, nil
+}
+
+// Stress runs the harness on the map and fails the test on an invalid configuration or any violation found
+func Stress[K comparable](t testing.TB, m *haxmap.Map[K, uint64], cfg Config[K]) {
+	t.Helper()
+	res, err := Run(m, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Err returns an error describing the violations found, nil if there are none
+func (r *Result[K]) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "haxmaptest: %d violations in %d operations on %d keys, seed %d", len(r.Violations), r.Operations, r.Keys, r.Seed)
+	for i, v := range r.Violations {
+		if i == maxReportedViolations {
+			fmt.Fprintf(&b, "\n...")
+			break
+		}
+		if len(v.History) == 0 {
+			fmt.Fprintf(&b, "\n%s", v.Message)
+			continue
+		}
+		fmt.Fprintf(&b, "\nkey %v: %s", v.Key, v.Message)
+		for j, op := range v.History {
+			if j == maxReportedOperations {
+				fmt.Fprintf(&b, "\n\t... %d more", len(v.History)-j)
+				break
+			}
+			fmt.Fprintf(&b, "\n\t%v", op)
+		}
+	}
+	return errors.New(b.String())
+}
+
+// String returns the name of the kind of operation
+func (op Op) String() string {
+	switch op {
+	case OpGet:
+		return "Get"
+	case OpSet:
+		return "Set"
+	case OpDel:
+		return "Del"
+	case OpGetAndDel:
+		return "GetAndDel"
+	case OpGetOrSet:
+		return "GetOrSet"
+	case OpCompareAndSwap:
+		return "CompareAndSwap"
+	case OpSwap:
+		return "Swap"
+	case OpAdd:
+		return "Add"
+	}
+	return fmt.Sprintf("Op(%d)", uint8(op))
+}
+
+// String formats the operation with its arguments, results and logical times
+func (op Operation[K]) String() string {
+	who := fmt.Sprintf("goroutine %d", op.Goroutine)
+	if op.Goroutine < 0 {
+		who = "final state"
+	}
+	var call string
+	switch op.Op {
+	case OpGet, OpGetAndDel:
+		call = fmt.Sprintf("%v(%v) = %#x, %v", op.Op, op.Key, op.Output, op.OK)
+	case OpSet:
+		call = fmt.Sprintf("Set(%v, %#x)", op.Key, op.Input)
+	case OpDel:
+		call = fmt.Sprintf("Del(%v)", op.Key)
+	case OpCompareAndSwap:
+		call = fmt.Sprintf("CompareAndSwap(%v, %#x, %#x) = %v", op.Key, op.Expected, op.Input, op.OK)
+	case OpAdd:
+		call = fmt.Sprintf("Add(%v, %d) = %#x", op.Key, op.Input, op.Output)
+	default:
+		call = fmt.Sprintf("%v(%v, %#x) = %#x, %v", op.Op, op.Key, op.Input, op.Output, op.OK)
+	}
+	return fmt.Sprintf("[%d, %d] %s: %s", op.Call, op.Return, who, call)
+}
+
+// perform runs the operation on the map and records its results and logical times
+func perform[K comparable](m *haxmap.Map[K, uint64], op *Operation[K], clock *uint64) {
+	op.Call = atomic.AddUint64(clock, 1)
+	switch op.Op {
+	case OpGet:
+		op.Output, op.OK = m.Get(op.Key)
+	case OpSet:
+		m.Set(op.Key, op.Input)
+	case OpDel:
+		m.Del(op.Key)
+	case OpGetAndDel:
+		op.Output, op.OK = m.GetAndDel(op.Key)
+	case OpGetOrSet:
+		op.Output, op.OK = m.GetOrSet(op.Key, op.Input)
+	case OpCompareAndSwap:
+		op.OK = m.CompareAndSwap(op.Key, op.Expected, op.Input)
+	case OpSwap:
+		op.Output, op.OK = m.Swap(op.Key, op.Input)
+	case OpAdd:
+		op.Input = 1
+		op.Output, op.OK = haxmap.Add(m, op.Key, 1), true
+	}
+	op.Return = atomic.AddUint64(clock, 1)
+}
+
+// checkFinalState compares the length, the iteration and the lookups of the quiescent map
+// the lookups are appended to the histories of their keys, so that the linearizability check covers the final values
+func (r *Result[K]) checkFinalState(m *haxmap.Map[K, uint64], byKey map[K][]Operation[K], now uint64) {
+	iterated := make(map[K]uint64)
+	m.ForEach(func(key K, value uint64) bool {
+		if _, dup := iterated[key]; dup {
+			r.violate(key, "key reported twice by ForEach", byKey[key])
+		}
+		iterated[key] = value
+		return true
+	})
+	if n := m.Len(); n != uintptr(len(iterated)) {
+		var zero K
+		r.violate(zero, fmt.Sprintf("length %d does not match the %d elements reported by ForEach", n, len(iterated)), nil)
+	}
+	for key, value := range iterated {
+		if _, ok := byKey[key]; !ok {
+			r.violate(key, fmt.Sprintf("ForEach reported key %v with value %#x which was never set", key, value), nil)
+		}
+	}
+	for key, history := range byKey {
+		op := Operation[K]{Goroutine: -1, Op: OpGet, Key: key, Call: now + 1, Return: now + 2}
+		op.Output, op.OK = m.Get(key)
+		byKey[key] = append(history, op)
+		if value, ok := iterated[key]; ok != op.OK || value != op.Output {
+			r.violate(key, fmt.Sprintf("ForEach reported %#x, %v but Get returned %#x, %v", value, ok, op.Output, op.OK), byKey[key])
+		}
+	}
+}
+
+// violate records a violation, the history is copied and sorted by call time
+func (r *Result[K]) violate(key K, message string, history []Operation[K]) {
+	sorted := append([]Operation[K](nil), history...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Call < sorted[j].Call })
+	r.Violations = append(r.Violations, Violation[K]{Key: key, Message: message, History: sorted})
+}
+
+// cumulative returns the cumulative weights of the kinds of operations in a fixed order, so that a seed always yields the same operations
+func (mix Mix) cumulative() ([]int, error) {
+	weights := make([]int, numOps)
+	total := 0
+	for op, weight := range mix {
+		if op >= numOps {
+			return nil, fmt.Errorf("haxmaptest: unknown operation %v", op)
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("haxmaptest: weight of %v must not be negative, got %d", op, weight)
+		}
+		weights[op] = weight
+	}
+	for op := range weights {
+		total += weights[op]
+		weights[op] = total
+	}
+	if total == 0 {
+		return nil, errors.New("haxmaptest: mix must hold a positive weight")
+	}
+	return weights, nil
+}
+
+// pick draws a kind of operation according to the cumulative weights
+func pick(weights []int, r *rand.Rand) Op {
+	n := r.Intn(weights[len(weights)-1])
+	return Op(sort.SearchInts(weights, n+1))
+}
@@ -0,0 +1,116 @@
+package haxmaptest
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alphadose/haxmap"
+)
+
+func TestRun(t *testing.T) {
+	m := haxmap.New[int, uint64]()
+	res, err := Run(m, Config[int]{
+		Goroutines: 4,
+		Operations: 2000,
+		Keys:       Zipf(64, 1.2),
+		Key:        func(i int) int { return i },
+		Seed:       1,
+		Yield:      0.1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Err(); err != nil {
+		t.Error(err)
+	}
+	if res.Operations != 8000 || res.Keys == 0 || res.Seed != 1 {
+		t.Errorf("result should count the operations, operations: %d, keys: %d, seed: %d", res.Operations, res.Keys, res.Seed)
+	}
+}
+
+func TestStressCustomHasher(t *testing.T) {
+	// a hasher with many collisions is slow but must not lose updates
+	m := haxmap.NewWithOptions[string, uint64](haxmap.WithHasher(func(key string) uintptr {
+		return uintptr(len(key))
+	}))
+	Stress(t, m, Config[string]{
+		Goroutines: 4,
+		Operations: 500,
+		Mix:        Mix{OpSet: 2, OpGet: 2, OpDel: 1, OpAdd: 1},
+		Keys:       Hotspot(100, 4, 0.5),
+		Key:        strconv.Itoa,
+	})
+}
+
+func TestRunConfig(t *testing.T) {
+	m := haxmap.New[int, uint64]()
+	if _, err := Run(m, Config[int]{}); err == nil {
+		t.Error("missing key function should be rejected")
+	}
+	key := func(i int) int { return i }
+	if _, err := Run(m, Config[int]{Key: key, Mix: Mix{OpGet: -1}}); err == nil {
+		t.Error("negative weight should be rejected")
+	}
+	if _, err := Run(m, Config[int]{Key: key, Mix: Mix{OpGet: 0}}); err == nil {
+		t.Error("mix without weight should be rejected")
+	}
+	m.Set(1, 1)
+	if _, err := Run(m, Config[int]{Key: key}); err == nil {
+		t.Error("map which is not empty should be rejected")
+	}
+}
+
+func TestLinearizable(t *testing.T) {
+	set := func(value, call, ret uint64) Operation[int] {
+		return Operation[int]{Op: OpSet, Input: value, Call: call, Return: ret}
+	}
+	get := func(value uint64, ok bool, call, ret uint64) Operation[int] {
+		return Operation[int]{Op: OpGet, Output: value, OK: ok, Call: call, Return: ret}
+	}
+	tests := []struct {
+		name    string
+		history []Operation[int]
+		want    bool
+	}{
+		{"sequential", []Operation[int]{get(0, false, 1, 2), set(1, 3, 4), get(1, true, 5, 6)}, true},
+		{"lost update", []Operation[int]{set(1, 1, 2), set(2, 3, 4), get(1, true, 5, 6)}, false},
+		{"concurrent write", []Operation[int]{set(1, 1, 2), set(2, 3, 6), get(1, true, 4, 5)}, true},
+		{"stale read after read", []Operation[int]{set(1, 1, 2), set(2, 3, 8), get(2, true, 4, 5), get(1, true, 6, 7)}, false},
+		{"value never set", []Operation[int]{set(1, 1, 4), get(3, true, 2, 3)}, false},
+		{"double insert", []Operation[int]{
+			{Op: OpGetOrSet, Input: 1, Output: 1, Call: 1, Return: 4},
+			{Op: OpGetOrSet, Input: 2, Output: 2, Call: 2, Return: 3},
+		}, false},
+		{"counter", []Operation[int]{
+			{Op: OpAdd, Input: 1, Output: 2, Call: 1, Return: 4},
+			{Op: OpAdd, Input: 1, Output: 1, Call: 2, Return: 3},
+			get(2, true, 5, 6),
+		}, true},
+	}
+	for _, tt := range tests {
+		if got := linearizable(tt.history); got != tt.want {
+			t.Errorf("%s: linearizable should be %v", tt.name, tt.want)
+		}
+	}
+}
+
+func TestResultErr(t *testing.T) {
+	res := &Result[int]{Seed: 7, Operations: 3, Keys: 1}
+	if res.Err() != nil {
+		t.Error("result without violations should have no error")
+	}
+	res.violate(1, "history is not linearizable", []Operation[int]{
+		{Goroutine: 0, Op: OpGet, Key: 1, Output: 1, OK: true, Call: 3, Return: 4},
+		{Goroutine: 1, Op: OpSet, Key: 1, Input: 1, Call: 1, Return: 2},
+	})
+	err := res.Err()
+	if err == nil {
+		t.Fatal("result with violations should have an error")
+	}
+	for _, want := range []string{"seed 7", "key 1: history is not linearizable", "[1, 2] goroutine 1: Set(1, 0x1)", "[3, 4] goroutine 0: Get(1) = 0x1, true"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should contain %q, got: %v", want, err)
+		}
+	}
+}
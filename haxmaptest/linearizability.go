@@ -0,0 +1,178 @@
+package haxmaptest
+
+import "sort"
+
+type (
+	// register is the state of a single key in the sequential model of the map
+	register struct {
+		value   uint64
+		present bool
+	}
+
+	// event is the call or the return of an operation in the doubly linked list of a history ordered by time
+	event struct {
+		id         int // index of the operation in the history
+		time       uint64
+		call       bool
+		match      *event // return event of a call
+		prev, next *event
+	}
+
+	// frame is an operation linearized on the search path, along with the state before it
+	frame struct {
+		call  *event
+		state register
+	}
+
+	// linearization is a set of linearized operations and the state they lead to, explored once by the search
+	linearization struct {
+		done  bitset
+		state register
+	}
+
+	bitset []uint64
+)
+
+// linearizable reports whether the operations of a single key can be ordered so that each of them takes effect between its call and its return
+// and the results they recorded match those of the sequential model when run in that order, starting from an absent key
+// the search tries the pending calls in order of time and backtracks once an operation returned before any order fits, states already explored are skipped
+// histories of different keys are independent, since linearizability is compositional
+func linearizable[K comparable](history []Operation[K]) bool {
+	events := make([]*event, 0, 2*len(history))
+	for i := range history {
+		call := &event{id: i, time: history[i].Call, call: true}
+		call.match = &event{id: i, time: history[i].Return}
+		events = append(events, call, call.match)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].time < events[j].time })
+	head := &event{}
+	prev := head
+	for _, e := range events {
+		prev.next, e.prev = e, prev
+		prev = e
+	}
+
+	var (
+		done     = make(bitset, (len(history)+63)/64)
+		explored = make(map[uint64][]linearization)
+		stack    []frame
+		state    register
+		e        = head.next
+	)
+	for head.next != nil {
+		if e.call {
+			if next, ok := step(state, &history[e.id]); ok {
+				done.set(e.id)
+				if explore(explored, done, next) {
+					stack = append(stack, frame{call: e, state: state})
+					state = next
+					lift(e)
+					e = head.next
+					continue
+				}
+				done.clear(e.id)
+			}
+			e = e.next
+			continue
+		}
+		// an operation returned before any of the pending calls could be linearized, undo the last choice
+		if len(stack) == 0 {
+			return false
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		state = top.state
+		done.clear(top.call.id)
+		unlift(top.call)
+		e = top.call.next
+	}
+	return true
+}
+
+// step runs the operation on the sequential model and reports whether the results recorded match
+func step[K comparable](s register, op *Operation[K]) (register, bool) {
+	switch op.Op {
+	case OpGet:
+		return s, op.OK == s.present && (!s.present || op.Output == s.value)
+	case OpSet:
+		return register{value: op.Input, present: true}, true
+	case OpDel:
+		return register{}, true
+	case OpGetAndDel:
+		return register{}, op.OK == s.present && (!s.present || op.Output == s.value)
+	case OpGetOrSet:
+		if s.present {
+			return s, op.OK && op.Output == s.value
+		}
+		return register{value: op.Input, present: true}, !op.OK && op.Output == op.Input
+	case OpCompareAndSwap:
+		if s.present && s.value == op.Expected {
+			return register{value: op.Input, present: true}, op.OK
+		}
+		return s, !op.OK
+	case OpSwap:
+		if s.present {
+			return register{value: op.Input, present: true}, op.OK && op.Output == s.value
+		}
+		return s, !op.OK
+	case OpAdd:
+		s.value, s.present = s.value+op.Input, true
+		return s, op.Output == s.value
+	}
+	return s, false
+}
+
+// explore records the linearization and reports whether it was not explored before
+func explore(explored map[uint64][]linearization, done bitset, state register) bool {
+	h := done.hash() ^ state.value*0x9e3779b97f4a7c15
+	if state.present {
+		h = ^h
+	}
+	for _, l := range explored[h] {
+		if l.state == state && l.done.equal(done) {
+			return false
+		}
+	}
+	explored[h] = append(explored[h], linearization{done: append(bitset(nil), done...), state: state})
+	return true
+}
+
+// lift removes the call and its return from the list once the operation is linearized
+func lift(call *event) {
+	call.prev.next, call.next.prev = call.next, call.prev
+	ret := call.match
+	ret.prev.next = ret.next
+	if ret.next != nil {
+		ret.next.prev = ret.prev
+	}
+}
+
+// unlift puts back the call and its return removed by lift
+func unlift(call *event) {
+	ret := call.match
+	ret.prev.next = ret
+	if ret.next != nil {
+		ret.next.prev = ret
+	}
+	call.prev.next, call.next.prev = call, call
+}
+
+func (b bitset) set(i int)   { b[i/64] |= 1 << (i % 64) }
+func (b bitset) clear(i int) { b[i/64] &^= 1 << (i % 64) }
+
+func (b bitset) hash() uint64 {
+	h := uint64(14695981039346656037)
+	for _, w := range b {
+		h = (h ^ w) * 1099511628211
+	}
+	return h
+}
+
+func (b bitset) equal(other bitset) bool {
+	for i := range b {
+		if b[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+// Package haxprom exports the metrics of haxmap maps to Prometheus
+//
+// A Collector reports the length, index capacity, fill rate, resizes and operation counts of every map registered with it,
+// each map is identified by a name which is attached to its series as the `map` label
+//
+//	c := haxprom.NewCollector("haxmap")
+//	m := haxmap.NewWithOptions[string, int](haxmap.WithMetrics(c.Metrics("sessions")))
+//	haxprom.Watch(c, "sessions", m)
+//	prometheus.MustRegister(c)
+package haxprom
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/alphadose/haxmap"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// Collector is a prometheus.Collector reporting the metrics of named maps
+	Collector struct {
+		mu   sync.RWMutex
+		maps map[string]*mapMetrics
+
+		length   *prometheus.Desc
+		capacity *prometheus.Desc
+		fillRate *prometheus.Desc
+		resizes  *prometheus.Desc
+		gets     *prometheus.Desc
+		sets     *prometheus.Desc
+		deletes  *prometheus.Desc
+	}
+
+	// mapMetrics counts the operations of a single map and samples its size, it implements haxmap.Metrics
+	mapMetrics struct {
+		hits, misses     uint64
+		inserts, updates uint64
+		deletes, resizes uint64
+		stats            func() (length, capacity, fillRate uintptr) // nil until the map is watched
+		statsMu          sync.Mutex
+	}
+)
+
+// NewCollector returns a collector whose metric names start with the namespace, "haxmap" if it is empty
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = "haxmap"
+	}
+	labels := []string{"map"}
+	return &Collector{
+		maps:     make(map[string]*mapMetrics),
+		length:   prometheus.NewDesc(namespace+"_length", "Number of elements in the map.", labels, nil),
+		capacity: prometheus.NewDesc(namespace+"_capacity", "Size of the map index.", labels, nil),
+		fillRate: prometheus.NewDesc(namespace+"_fill_ratio", "Ratio of used map index slots.", labels, nil),
+		resizes:  prometheus.NewDesc(namespace+"_resizes_total", "Number of resizes of the map index.", labels, nil),
+		gets:     prometheus.NewDesc(namespace+"_gets_total", "Number of lookups by result.", []string{"map", "result"}, nil),
+		sets:     prometheus.NewDesc(namespace+"_sets_total", "Number of stores by result.", []string{"map", "result"}, nil),
+		deletes:  prometheus.NewDesc(namespace+"_deletes_total", "Number of deleted elements.", labels, nil),
+	}
+}
+
+// Metrics returns the operation hooks of the named map, pass them to the map with haxmap.WithMetrics
+// the same hooks are returned for every call with the same name
+func (c *Collector) Metrics(name string) haxmap.Metrics {
+	return c.entry(name)
+}
+
+// Watch reports the length, capacity and fill rate of the map under the given name
+// the values are sampled from the map whenever the collector is scraped
+func Watch[K comparable, V any](c *Collector, name string, m *haxmap.Map[K, V]) {
+	e := c.entry(name)
+	e.statsMu.Lock()
+	e.stats = func() (uintptr, uintptr, uintptr) {
+		return m.Len(), m.Cap(), m.Fillrate()
+	}
+	e.statsMu.Unlock()
+}
+
+// Remove stops reporting the named map
+func (c *Collector) Remove(name string) {
+	c.mu.Lock()
+	delete(c.maps, name)
+	c.mu.Unlock()
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.length
+	ch <- c.capacity
+	ch <- c.fillRate
+	ch <- c.resizes
+	ch <- c.gets
+	ch <- c.sets
+	ch <- c.deletes
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, e := range c.maps {
+		e.statsMu.Lock()
+		stats := e.stats
+		e.statsMu.Unlock()
+		if stats != nil {
+			length, capacity, fillRate := stats()
+			ch <- prometheus.MustNewConstMetric(c.length, prometheus.GaugeValue, float64(length), name)
+			ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(capacity), name)
+			ch <- prometheus.MustNewConstMetric(c.fillRate, prometheus.GaugeValue, float64(fillRate)/100, name)
+		}
+		ch <- prometheus.MustNewConstMetric(c.resizes, prometheus.CounterValue, float64(atomic.LoadUint64(&e.resizes)), name)
+		ch <- prometheus.MustNewConstMetric(c.gets, prometheus.CounterValue, float64(atomic.LoadUint64(&e.hits)), name, "hit")
+		ch <- prometheus.MustNewConstMetric(c.gets, prometheus.CounterValue, float64(atomic.LoadUint64(&e.misses)), name, "miss")
+		ch <- prometheus.MustNewConstMetric(c.sets, prometheus.CounterValue, float64(atomic.LoadUint64(&e.inserts)), name, "insert")
+		ch <- prometheus.MustNewConstMetric(c.sets, prometheus.CounterValue, float64(atomic.LoadUint64(&e.updates)), name, "update")
+		ch <- prometheus.MustNewConstMetric(c.deletes, prometheus.CounterValue, float64(atomic.LoadUint64(&e.deletes)), name)
+	}
+}
+
+// entry returns the metrics of the named map, creating them on first use
+func (c *Collector) entry(name string) *mapMetrics {
+	c.mu.RLock()
+	e, ok := c.maps[name]
+	c.mu.RUnlock()
+	if ok {
+		return e
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok = c.maps[name]; !ok {
+		e = &mapMetrics{}
+		c.maps[name] = e
+	}
+	return e
+}
+
+// Get implements haxmap.Metrics
+func (e *mapMetrics) Get(found bool) {
+	if found {
+		atomic.AddUint64(&e.hits, 1)
+	} else {
+		atomic.AddUint64(&e.misses, 1)
+	}
+}
+
+// Set implements haxmap.Metrics
+func (e *mapMetrics) Set(inserted bool) {
+	if inserted {
+		atomic.AddUint64(&e.inserts, 1)
+	} else {
+		atomic.AddUint64(&e.updates, 1)
+	}
+}
+
+// Del implements haxmap.Metrics
+func (e *mapMetrics) Del(removed int) {
+	atomic.AddUint64(&e.deletes, uint64(removed))
+}
+
+// Resize implements haxmap.Metrics
+func (e *mapMetrics) Resize(oldSize, newSize uintptr) {
+	atomic.AddUint64(&e.resizes, 1)
+}
@@ -0,0 +1,54 @@
+package haxprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alphadose/haxmap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("")
+	m := haxmap.NewWithOptions[int, int](haxmap.WithSize(8), haxmap.WithMetrics(c.Metrics("test")))
+	Watch(c, "test", m)
+	for i := 0; i < 10; i++ {
+		m.Set(i, i)
+	}
+	m.Set(0, 1)
+	m.Get(1)
+	m.Get(100)
+	m.Del(1, 2, 100)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	expected := `
+# HELP haxmap_deletes_total Number of deleted elements.
+# TYPE haxmap_deletes_total counter
+haxmap_deletes_total{map="test"} 2
+# HELP haxmap_gets_total Number of lookups by result.
+# TYPE haxmap_gets_total counter
+haxmap_gets_total{map="test",result="hit"} 1
+haxmap_gets_total{map="test",result="miss"} 1
+# HELP haxmap_length Number of elements in the map.
+# TYPE haxmap_length gauge
+haxmap_length{map="test"} 8
+# HELP haxmap_sets_total Number of stores by result.
+# TYPE haxmap_sets_total counter
+haxmap_sets_total{map="test",result="insert"} 10
+haxmap_sets_total{map="test",result="update"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"haxmap_deletes_total", "haxmap_gets_total", "haxmap_length", "haxmap_sets_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(c, "haxmap_resizes_total"); n != 1 {
+		t.Errorf("resizes should be reported once per map, got: %d", n)
+	}
+
+	c.Remove("test")
+	if n := testutil.CollectAndCount(c); n != 0 {
+		t.Errorf("removed map should not be reported, got %d metrics", n)
+	}
+}
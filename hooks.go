@@ -0,0 +1,135 @@
+package haxmap
+
+// kinds of mutations reported to the lifecycle hooks
+const (
+	hookInsert = iota
+	hookUpdate
+	hookDelete
+)
+
+type (
+	// hooks holds the lifecycle callbacks of a map
+	hooks[K comparable, V any] struct {
+		onInsert func(K, V)
+		onUpdate func(K, V, V)
+		onDelete func(K, V)
+		queue    chan hookEvent[K, V] // pending events of asynchronous hooks, nil if the hooks run synchronously
+		running  atomicUint32         // the goroutine running the queued events is active
+	}
+
+	// hookEvent is a mutation waiting in the queue of asynchronous hooks
+	hookEvent[K comparable, V any] struct {
+		kind     int
+		key      K
+		oldValue V
+		value    V
+	}
+)
+
+// inserted reports a new element
+func (h *hooks[K, V]) inserted(key K, value V) {
+	if h.onInsert != nil {
+		h.notify(hookEvent[K, V]{kind: hookInsert, key: key, value: value})
+	}
+}
+
+// updated reports a changed value of an existing element
+func (h *hooks[K, V]) updated(key K, oldValue, value V) {
+	if h.onUpdate != nil {
+		h.notify(hookEvent[K, V]{kind: hookUpdate, key: key, oldValue: oldValue, value: value})
+	}
+}
+
+// deleted reports a removed element
+func (h *hooks[K, V]) deleted(key K, value V) {
+	if h.onDelete != nil {
+		h.notify(hookEvent[K, V]{kind: hookDelete, key: key, value: value})
+	}
+}
+
+// notify runs the callback of the event or queues it for the background goroutine
+func (h *hooks[K, V]) notify(ev hookEvent[K, V]) {
+	if h.queue == nil {
+		h.run(ev)
+		return
+	}
+	h.queue <- ev // blocks while the queue is full, so that no event is lost
+	if h.running.CompareAndSwap(0, 1) {
+		go h.drain()
+	}
+}
+
+// drain runs queued events in order until the queue is empty
+func (h *hooks[K, V]) drain() {
+	for {
+		select {
+		case ev := <-h.queue:
+			h.run(ev)
+		default:
+			h.running.Store(0)
+			// an event queued after the queue was found empty may have missed the running goroutine
+			if len(h.queue) == 0 || !h.running.CompareAndSwap(0, 1) {
+				return
+			}
+		}
+	}
+}
+
+// run calls the callback of the event
+func (h *hooks[K, V]) run(ev hookEvent[K, V]) {
+	switch ev.kind {
+	case hookInsert:
+		h.onInsert(ev.key, ev.value)
+	case hookUpdate:
+		h.onUpdate(ev.key, ev.oldValue, ev.value)
+	case hookDelete:
+		h.onDelete(ev.key, ev.value)
+	}
+}
+
+// observed reports whether mutations are reported to lifecycle hooks, watches or the byte budget, which then need the values involved
+func (m *Map[K, V]) observed() bool {
+	return m.hooks != nil || m.watching() || m.budget != nil
+}
+
+// inserted reports a new element to the hooks and watches and wakes up the GetWait calls waiting for its key
+func (m *Map[K, V]) inserted(key K, value V) {
+	if b := m.budget; b != nil {
+		b.add(b.sizeOf(key, value))
+	}
+	if m.hooks != nil {
+		m.hooks.inserted(key, value)
+	}
+	if m.watching() {
+		m.watchers.Load().notify(Event[K, V]{Type: EventInsert, Key: key, Value: value})
+	}
+	if w := m.waiters.Load(); w != nil && w.active.Load() != 0 {
+		w.wake(m.hasher(key), key, value, m.equal)
+	}
+}
+
+// updated reports a changed value to the hooks and watches
+func (m *Map[K, V]) updated(key K, oldValue, value V) {
+	if b := m.budget; b != nil {
+		b.add(b.sizeOf(key, value) - b.sizeOf(key, oldValue))
+	}
+	if m.hooks != nil {
+		m.hooks.updated(key, oldValue, value)
+	}
+	if m.watching() {
+		m.watchers.Load().notify(Event[K, V]{Type: EventUpdate, Key: key, Value: value, OldValue: oldValue})
+	}
+}
+
+// deleted reports a removed element to the hooks and watches
+func (m *Map[K, V]) deleted(key K, value V) {
+	if b := m.budget; b != nil {
+		b.add(-b.sizeOf(key, value))
+	}
+	if m.hooks != nil {
+		m.hooks.deleted(key, value)
+	}
+	if m.watching() {
+		m.watchers.Load().notify(Event[K, V]{Type: EventDelete, Key: key, Value: value})
+	}
+}
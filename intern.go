@@ -0,0 +1,43 @@
+package haxmap
+
+import "unsafe"
+
+// Interner deduplicates strings, maps created with WithInterner store the canonical copy of their keys
+// so that maps holding the same keys, or keys sliced from larger strings, do not keep a separate backing array for each of them
+// the zero value is ready to use
+//
+// interned strings are kept for as long as the interner is reachable, which suits key sets that are bounded or mostly stable,
+// share one interner between the maps holding the same keys and let go of it together with them
+type Interner struct {
+	strings Map[string, string]
+}
+
+// NewInterner returns an empty interner
+func NewInterner() *Interner {
+	return &Interner{}
+}
+
+// Intern returns the canonical copy of s
+// the first string interned with given contents is copied, so that the canonical copy never keeps a larger string it was sliced from alive
+func (in *Interner) Intern(s string) string {
+	if canonical, ok := in.strings.Get(s); ok {
+		return canonical
+	}
+	clone := string([]byte(s))
+	canonical, _ := in.strings.GetOrSet(clone, clone)
+	return canonical
+}
+
+// Len returns the number of interned strings
+func (in *Interner) Len() int {
+	return int(in.strings.Len())
+}
+
+// internKey returns the canonical copy of a key which is about to be stored, only maps with string keys have an interner
+func (m *Map[K, V]) internKey(key K) K {
+	if m.interner == nil {
+		return key
+	}
+	s := m.interner.Intern(*(*string)(unsafe.Pointer(&key)))
+	return *(*K)(unsafe.Pointer(&s))
+}
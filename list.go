@@ -1,6 +1,10 @@
 package haxmap
 
-import "sync/atomic"
+import (
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+)
 
 // states denoting whether a node is deleted or not
 const (
@@ -8,41 +12,276 @@ const (
 	deleted
 )
 
+// flags of a node stored beside its deletion state
+const (
+	stateMask  uint32 = 1 // bit holding the deletion state
+	referenced uint32 = 2 // set whenever a bounded map accesses the node, cleared by the eviction clock hand passing over it
+)
+
 // Below implementation is a lock-free linked list based on https://www.cl.cam.ac.uk/research/srg/netos/papers/2001-caslists.pdf by Timothy L. Harris
 // Performance improvements suggested in https://arxiv.org/pdf/2010.15755.pdf were also added
 
+// valueStorage is the way the elements of a map hold their values, each way has its own element layout
+type valueStorage uint8
+
+const (
+	pointerValues   valueStorage = iota // values are allocated separately and referenced by a pointer
+	inlineValues                        // values which fit in a machine word and hold no pointers are stored in the element itself
+	versionedValues                     // values of a map created with WithVersions are held in immutable records together with their version
+	noValues                            // values of a zero-size type, such as the members of a Set, need no storage at all
+)
+
 // newListHead returns the new head of any list
-func newListHead[K hashable, V any]() *element[K, V] {
-	e := &element[K, V]{keyHash: 0, key: *new(K)}
-	e.nextPtr.Store(nil)
-	e.value.Store(new(V))
+func newListHead[K comparable, V any](storage valueStorage) *element[K, V] {
+	e := newElement[K, V](storage)
+	e.store(storage, *new(V))
 	return e
 }
 
 // a single node in the list
-type element[K hashable, V any] struct {
+// the value follows the node in memory, laid out as a pointerElement, an inlineElement or a versionedElement depending on the storage of the map,
+// elements holding zero-size values end with the node
+type element[K comparable, V any] struct {
 	keyHash uintptr
 	key     K
-	// The next element in the list. If this pointer has the marked flag set it means THIS element, not the next one, is deleted.
-	nextPtr atomicPointer[element[K, V]]
-	value   atomicPointer[V]
-	deleted uint32
+	// The next element in the list. If the link is marked it means THIS element, not the next one, is deleted and being unlinked.
+	nextPtr listLink[K, V]
+	ext     atomicPointer[elementExt] // state of optional features, nil until one of them is used on the element
+	flags   uint32                    // deletion state in the lowest bits, followed by the flags above
+	gen     uint32                    // sequence number of the generation the element was added in, 0 for the list head
+}
+
+// elementExt holds the state of an element which only some features need, it is replaced as a whole on every change
+type elementExt struct {
+	expiry int64 // deadline of an element set with a TTL, 0 if it never expires
+}
+
+// expiry returns the deadline of the element, 0 if it never expires
+func (self *element[K, V]) expiry() int64 {
+	if ext := self.ext.Load(); ext != nil {
+		return ext.expiry
+	}
+	return 0
+}
+
+// setExpiry sets the deadline of the element, 0 makes it permanent
+func (self *element[K, V]) setExpiry(deadline int64) {
+	for {
+		ext := self.ext.Load()
+		if ext == nil && deadline == 0 {
+			return
+		}
+		updated := new(elementExt)
+		if ext != nil {
+			*updated = *ext
+		}
+		updated.expiry = deadline
+		if self.ext.CompareAndSwap(ext, updated) {
+			return
+		}
+	}
+}
+
+// pointerElement is the layout of an element holding its value behind a pointer
+type pointerElement[K comparable, V any] struct {
+	element[K, V]
+	value atomicPointer[V]
+}
+
+// inlineElement is the layout of an element holding its value in place
+// this saves an allocation on every store and a pointer dereference on every load
+type inlineElement[K comparable, V any] struct {
+	element[K, V]
+	word atomicUintptr
+}
+
+// versionedElement is the layout of an element of a map created with WithVersions
+// the value and its version are replaced together with a single compare-and-swap, so neither readers nor writers have to hold the element
+type versionedElement[K comparable, V any] struct {
+	element[K, V]
+	record atomicPointer[versionedValue[V]]
+}
+
+// versionedValue is an immutable record of the value of an element and its version
+type versionedValue[V any] struct {
+	value   V
+	version uintptr
+	final   bool // the element is being deleted, its record is not replaced anymore
+}
+
+// newElement allocates a zeroed element with the layout of the given storage
+func newElement[K comparable, V any](storage valueStorage) *element[K, V] {
+	switch storage {
+	case inlineValues:
+		return &(&inlineElement[K, V]{}).element
+	case versionedValues:
+		return &(&versionedElement[K, V]{}).element
+	case noValues:
+		return &element[K, V]{}
+	}
+	return &(&pointerElement[K, V]{}).element
+}
+
+// elementSize returns the size of an element with the layout of the given storage
+func elementSize[K comparable, V any](storage valueStorage) uintptr {
+	switch storage {
+	case inlineValues:
+		return unsafe.Sizeof(inlineElement[K, V]{})
+	case versionedValues:
+		return unsafe.Sizeof(versionedElement[K, V]{})
+	case noValues:
+		return unsafe.Sizeof(element[K, V]{})
+	}
+	return unsafe.Sizeof(pointerElement[K, V]{})
+}
+
+// pointer returns the value pointer of an element allocated as a pointerElement
+func (self *element[K, V]) pointer() *atomicPointer[V] {
+	return &(*pointerElement[K, V])(unsafe.Pointer(self)).value
+}
+
+// word returns the value word of an element allocated as an inlineElement
+func (self *element[K, V]) word() *atomicUintptr {
+	return &(*inlineElement[K, V])(unsafe.Pointer(self)).word
+}
+
+// record returns the value record of an element allocated as a versionedElement
+func (self *element[K, V]) record() *atomicPointer[versionedValue[V]] {
+	return &(*versionedElement[K, V])(unsafe.Pointer(self)).record
+}
+
+// reset zeroes the element and its value so that it can be reused
+func (self *element[K, V]) reset(storage valueStorage) {
+	switch storage {
+	case inlineValues:
+		*(*inlineElement[K, V])(unsafe.Pointer(self)) = inlineElement[K, V]{}
+	case versionedValues:
+		*(*versionedElement[K, V])(unsafe.Pointer(self)) = versionedElement[K, V]{}
+	case noValues:
+		*self = element[K, V]{}
+	default:
+		*(*pointerElement[K, V])(unsafe.Pointer(self)) = pointerElement[K, V]{}
+	}
+}
+
+// load returns the current value of the element
+func (self *element[K, V]) load(storage valueStorage) V {
+	switch storage {
+	case inlineValues:
+		return wordToValue[V](self.word().Load())
+	case versionedValues:
+		return self.record().Load().value
+	case noValues:
+		return *new(V)
+	}
+	return *self.pointer().Load()
+}
+
+// store sets the value of the element
+// a versioned value starts at version 0, versioned elements which are linked into the list are only changed with modify
+func (self *element[K, V]) store(storage valueStorage, value V) {
+	switch storage {
+	case inlineValues:
+		self.word().Store(valueToWord(value))
+	case versionedValues:
+		self.record().Store(&versionedValue[V]{value: value})
+	case noValues:
+		// zero-size values are not stored
+	default:
+		ptr := new(V)
+		*ptr = value
+		self.pointer().Store(ptr)
+	}
+}
+
+// swap sets the value of the element returning the previous one
+// it fails if the element is versioned and being deleted
+func (self *element[K, V]) swap(storage valueStorage, value V) (V, bool) {
+	switch storage {
+	case inlineValues:
+		return wordToValue[V](self.word().Swap(valueToWord(value))), true
+	case versionedValues:
+		return self.modify(storage, func(V, uintptr) (V, bool) { return value, true })
+	case noValues:
+		return value, true
+	}
+	ptr := new(V)
+	*ptr = value
+	return *self.pointer().Swap(ptr), true
+}
+
+// modify replaces the value of the element with the result of fn on the current value and version, unless fn declines
+// the value is replaced with a compare-and-swap, so fn runs again whenever another writer got in between, elements which are not versioned pass version 0
+// it returns the value held before and whether it was replaced, the value of a versioned element being deleted is never replaced
+func (self *element[K, V]) modify(storage valueStorage, fn func(value V, version uintptr) (V, bool)) (V, bool) {
+	switch storage {
+	case inlineValues:
+		for {
+			word := self.word().Load()
+			old := wordToValue[V](word)
+			value, ok := fn(old, 0)
+			if !ok || self.word().CompareAndSwap(word, valueToWord(value)) {
+				return old, ok
+			}
+		}
+	case versionedValues:
+		for {
+			current := self.record().Load()
+			if current.final {
+				return current.value, false
+			}
+			value, ok := fn(current.value, current.version)
+			if !ok || self.record().CompareAndSwap(current, &versionedValue[V]{value: value, version: current.version + 1}) {
+				return current.value, ok
+			}
+		}
+	case noValues:
+		_, ok := fn(*new(V), 0)
+		return *new(V), ok
+	}
+	for {
+		current := self.pointer().Load()
+		value, ok := fn(*current, 0)
+		if !ok {
+			return *current, false
+		}
+		ptr := new(V)
+		*ptr = value
+		if self.pointer().CompareAndSwap(current, ptr) {
+			return *current, true
+		}
+	}
 }
 
 // next returns the next element
 // this also deletes all marked elements while traversing the list
 func (self *element[K, V]) next() *element[K, V] {
-	for nextElement := self.nextPtr.Load(); nextElement != nil; {
+	for {
+		nextElement, frozen := self.nextPtr.LoadMarked()
+		if nextElement == nil || !nextElement.isDeleted() {
+			return nextElement
+		}
+		if frozen {
+			// this element is deleted and its link is frozen, the elements behind it are unlinked from its predecessor
+			// together with it, so their links have to be frozen as well
+			return nextElement.freeze().next()
+		}
 		// if our next element is itself deleted (by the same criteria) then we will just replace
 		// it with its next() (which should be the first node behind it that isn't itself deleted) and then check again
-		if nextElement.isDeleted() {
-			self.nextPtr.CompareAndSwap(nextElement, nextElement.next()) // actual deletion happens here after nodes are marked deleted lazily
-			nextElement = self.nextPtr.Load()
-		} else {
-			return nextElement
+		// the link of the deleted element is marked first, so that no element can be inserted behind it while it is unlinked
+		self.nextPtr.CompareAndSwap(nextElement, nextElement.freeze().next()) // actual deletion happens here after nodes are marked deleted lazily
+	}
+}
+
+// freeze marks the link of a deleted element and returns the element itself
+// an insertion behind the element has to swap its link, which fails once the link is marked
+func (self *element[K, V]) freeze() *element[K, V] {
+	for {
+		succ, frozen := self.nextPtr.LoadMarked()
+		if frozen || self.nextPtr.mark(succ) {
+			return self
 		}
 	}
-	return nil
 }
 
 // addBefore inserts an element before the specified element
@@ -54,28 +293,8 @@ func (self *element[K, V]) addBefore(allocatedElement, before *element[K, V]) bo
 	return self.nextPtr.CompareAndSwap(before, allocatedElement)
 }
 
-// inject updates an existing value in the list if present or adds a new entry
-func (self *element[K, V]) inject(c uintptr, key K, value *V) (*element[K, V], bool) {
-	var (
-		alloc             *element[K, V]
-		left, curr, right = self.search(c, key)
-	)
-	if curr != nil {
-		curr.value.Store(value)
-		return curr, false
-	}
-	if left != nil {
-		alloc = &element[K, V]{keyHash: c, key: key}
-		alloc.value.Store(value)
-		if left.addBefore(alloc, right) {
-			return alloc, true
-		}
-	}
-	return nil, false
-}
-
 // search for an element in the list and return left_element, searched_element and right_element respectively
-func (self *element[K, V]) search(c uintptr, key K) (*element[K, V], *element[K, V], *element[K, V]) {
+func (self *element[K, V]) search(c uintptr, key K, eq func(a, b K) bool) (*element[K, V], *element[K, V], *element[K, V]) {
 	var (
 		left, right *element[K, V]
 		curr        = self
@@ -89,7 +308,7 @@ func (self *element[K, V]) search(c uintptr, key K) (*element[K, V], *element[K,
 			right = curr
 			curr = nil
 			return left, curr, right
-		} else if c == curr.keyHash && key == curr.key {
+		} else if c == curr.keyHash && keyEquals(eq, key, curr.key) && !curr.isDeleted() {
 			return left, curr, right
 		}
 		left = curr
@@ -102,10 +321,117 @@ func (self *element[K, V]) search(c uintptr, key K) (*element[K, V], *element[K,
 // the node will be removed in the next iteration via `element.next()`
 // CAS ensures each node can be marked for deletion exactly once
 func (self *element[K, V]) remove() bool {
-	return atomic.CompareAndSwapUint32(&self.deleted, notDeleted, deleted)
+	for {
+		flags := atomic.LoadUint32(&self.flags)
+		if flags&stateMask != notDeleted {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(&self.flags, flags, flags|deleted) {
+			return true
+		}
+	}
+}
+
+// storageOf returns the way values of the given type are stored in the elements
+func storageOf(t reflect.Type) valueStorage {
+	if t.Size() == 0 {
+		return noValues
+	}
+	if t.Size() <= unsafe.Sizeof(uintptr(0)) && !hasPointers(t) {
+		return inlineValues
+	}
+	return pointerValues
+}
+
+// hasPointers reports whether values of the given type hold any pointers the garbage collector needs to know about
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Map, reflect.Slice, reflect.String, reflect.Interface, reflect.Func, reflect.Chan:
+		return true
+	default:
+		return false
+	}
+}
+
+// valueToWord packs a value which can be inlined into a machine word
+func valueToWord[V any](value V) (word uintptr) {
+	*(*V)(unsafe.Pointer(&word)) = value
+	return
+}
+
+// wordToValue unpacks a value which was packed with valueToWord
+func wordToValue[V any](word uintptr) V {
+	return *(*V)(unsafe.Pointer(&word))
+}
+
+// keyEquals compares two keys with the custom equality function if provided, else with `==`
+func keyEquals[K comparable](eq func(a, b K) bool, a, b K) bool {
+	if eq == nil {
+		return a == b
+	}
+	return eq(a, b)
 }
 
 // if current element is deleted
 func (self *element[K, V]) isDeleted() bool {
-	return atomic.LoadUint32(&self.deleted) == deleted
+	return atomic.LoadUint32(&self.flags)&stateMask != notDeleted
+}
+
+// listEnd stands in for the missing successor of the last element once its link is marked, as a nil link has no address to mark
+// its halves are two bytes wide, so that its address is even and the marked address still points into it
+var listEnd [2]uint16
+
+// listLink is the link of an element to its successor
+// a marked link is stored as the address of the successor plus one, which still points into the successor for the garbage collector
+// a plain compare-and-swap of the link fails once it is marked, this freezes the link of a deleted element while it is unlinked
+// without allocating a marker node
+type listLink[K comparable, V any] struct {
+	_   noCopy
+	ptr unsafe.Pointer
+}
+
+// Load returns the successor whether the link is marked or not
+func (l *listLink[K, V]) Load() *element[K, V] {
+	next, _ := l.LoadMarked()
+	return next
+}
+
+// LoadMarked returns the successor and whether the link is marked
+func (l *listLink[K, V]) LoadMarked() (*element[K, V], bool) {
+	ptr := atomic.LoadPointer(&l.ptr)
+	if uintptr(ptr)&1 == 0 {
+		return (*element[K, V])(ptr), false
+	}
+	if ptr = unsafe.Pointer(uintptr(ptr) - 1); ptr == unsafe.Pointer(&listEnd) {
+		return nil, true
+	}
+	return (*element[K, V])(ptr), true
+}
+
+// Store sets the successor, leaving the link unmarked
+func (l *listLink[K, V]) Store(next *element[K, V]) {
+	atomic.StorePointer(&l.ptr, unsafe.Pointer(next))
+}
+
+// CompareAndSwap replaces the successor if the link is unmarked and still points to old
+func (l *listLink[K, V]) CompareAndSwap(old, new *element[K, V]) bool {
+	return atomic.CompareAndSwapPointer(&l.ptr, unsafe.Pointer(old), unsafe.Pointer(new))
+}
+
+// mark marks the link if it is unmarked and still points to next
+func (l *listLink[K, V]) mark(next *element[K, V]) bool {
+	target := unsafe.Pointer(&listEnd)
+	if next != nil {
+		target = unsafe.Pointer(next)
+	}
+	return atomic.CompareAndSwapPointer(&l.ptr, unsafe.Pointer(next), unsafe.Pointer(uintptr(target)+1))
 }
@@ -0,0 +1,78 @@
+package haxmap
+
+import "errors"
+
+// errLoadPanicked is returned to the callers waiting for a load which panicked
+var errLoadPanicked = errors.New("haxmap: load panicked")
+
+type (
+	// LoadingMap is a concurrent map which loads missing values on demand
+	// concurrent misses of the same key share a single call of the load function, errors are returned to all of them and not stored
+	LoadingMap[K comparable, V any] struct {
+		m     *Map[K, V]
+		calls *Map[K, *loadCall[V]] // loads in progress
+		load  func(K) (V, error)
+	}
+
+	// loadCall is a load in progress, done is closed once value and err are set
+	loadCall[V any] struct {
+		done  chan struct{}
+		value V
+		err   error
+	}
+)
+
+// NewLoadingMap returns a new map which calls load for keys missing on Get, the options configure the map holding the loaded values
+// It panics if the configuration is invalid
+func NewLoadingMap[K comparable, V any](load func(K) (V, error), opts ...Option) *LoadingMap[K, V] {
+	m := NewWithOptions[K, V](opts...)
+	// keys of loads in progress are hashed and compared like the keys of the values
+	callOpts := []Option{WithHasher(m.hasher)}
+	if m.equal != nil {
+		callOpts = append(callOpts, WithEqual(m.equal))
+	}
+	return &LoadingMap[K, V]{m: m, calls: NewWithOptions[K, *loadCall[V]](callOpts...), load: load}
+}
+
+// Get returns the value of the key, loading it if missing
+// callers missing the same key concurrently wait for a single load and share its result
+func (l *LoadingMap[K, V]) Get(key K) (V, error) {
+	if value, ok := l.m.Get(key); ok {
+		return value, nil
+	}
+	call := &loadCall[V]{done: make(chan struct{})}
+	if current, loaded := l.calls.GetOrSet(key, call); loaded {
+		<-current.done
+		return current.value, current.err
+	}
+	defer func() {
+		l.calls.Del(key)
+		close(call.done)
+	}()
+	// the value may have been loaded between the miss and registering the call
+	if value, ok := l.m.Get(key); ok {
+		call.value = value
+		return value, nil
+	}
+	call.err = errLoadPanicked
+	call.value, call.err = l.load(key)
+	if call.err == nil {
+		l.m.Set(key, call.value) // stored before the call is removed, so a later miss cannot load again
+	}
+	return call.value, call.err
+}
+
+// Set stores the value of the key without loading it
+func (l *LoadingMap[K, V]) Set(key K, value V) {
+	l.m.Set(key, value)
+}
+
+// Del deletes the keys, the next Get of them loads them again
+func (l *LoadingMap[K, V]) Del(keys ...K) {
+	l.m.Del(keys...)
+}
+
+// Len returns the number of loaded values
+func (l *LoadingMap[K, V]) Len() uintptr {
+	return l.m.Len()
+}
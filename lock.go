@@ -0,0 +1,38 @@
+package haxmap
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// number of mutexes shared by the keys of a map for LockKey
+const keyLockStripes = 64
+
+type (
+	// paddedMutex is a mutex occupying a whole cache line
+	paddedMutex struct {
+		sync.Mutex
+		_ [cacheLineSize - unsafe.Sizeof(sync.Mutex{})]byte
+	}
+
+	// keyLockTable holds the striped mutexes of a map for LockKey, created by the first call and kept afterwards
+	keyLockTable [keyLockStripes]paddedMutex
+)
+
+// LockKey acquires an exclusive lock on the key and returns the function releasing it
+// it serves multi-step transactions on a single key such as reading a value, calling an external service and storing the result,
+// which need short exclusion from other transactions on the key without a global mutex
+// the lock is advisory, it only excludes other LockKey callers, all other methods of the map stay lock-free and ignore it
+// keys share a fixed number of mutexes by hash, so a goroutine holding the lock of a key must not lock another key, which may deadlock
+// the returned function must be called exactly once
+func (m *Map[K, V]) LockKey(key K) (unlock func()) {
+	m.init()
+	locks := m.keyLocks.Load()
+	if locks == nil {
+		m.keyLocks.CompareAndSwap(nil, new(keyLockTable))
+		locks = m.keyLocks.Load()
+	}
+	mu := &locks[m.hasher(key)&(keyLockStripes-1)]
+	mu.Lock()
+	return mu.Unlock
+}
@@ -1,25 +1,34 @@
 package haxmap
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"math/bits"
 	"reflect"
 	"sort"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
-
-	"golang.org/x/exp/constraints"
 )
 
 const (
 	// defaultSize is the default size for a zero allocated map
 	defaultSize = 8
 
-	// maxFillRate is the maximum fill rate for the slice before a resize will happen
-	maxFillRate = 50
+	// defaultGrowthFactor is the default factor by which the index grows
+	defaultGrowthFactor = 2
+
+	// defaultMaxFillRate is the default maximum fill rate for the slice before a resize will happen
+	defaultMaxFillRate = 50
 
 	// intSizeBytes is the size in byte of an int or uint value
 	intSizeBytes = strconv.IntSize >> 3
+
+	// ctxCheckInterval is the number of elements ForEachCtx iterates between checks of its context
+	ctxCheckInterval = 256
 )
 
 // indicates resizing operation status enums
@@ -29,13 +38,9 @@ const (
 )
 
 type (
-	hashable interface {
-		constraints.Integer | constraints.Float | constraints.Complex | ~string | uintptr | ~unsafe.Pointer
-	}
-
 	// metadata of the hashmap
-	metadata[K hashable, V any] struct {
-		keyshifts uintptr        //  array_size - log2(array_size)
+	metadata[K comparable, V any] struct {
+		keyshifts uintptr        //  array_size - log2(array_size), 0 if the size is not a power of 2
 		count     atomicUintptr  // number of filled items
 		data      unsafe.Pointer // pointer to array of map indexes
 
@@ -45,56 +50,116 @@ type (
 	}
 
 	// Map implements the concurrent hashmap
-	Map[K hashable, V any] struct {
-		listHead    *element[K, V] // Harris lock-free list of elements in ascending order of hash
-		hasher      func(K) uintptr
-		metadata    atomicPointer[metadata[K, V]] // atomic.Pointer for safe access even during resizing
-		resizing    atomicUint32
-		numItems    atomicUintptr
-		defaultSize uintptr
+	// the zero value is an empty map ready to use with the default settings, it is set up on first use
+	Map[K comparable, V any] struct {
+		listHead      *element[K, V] // Harris lock-free list of elements in ascending order of hash
+		hasher        func(K) uintptr
+		equal         func(a, b K) bool             // custom key equality, `==` is used if nil
+		metadata      atomicPointer[metadata[K, V]] // atomic.Pointer for safe access even during resizing
+		resizing      atomicUint32
+		gen           atomicPointer[generation] // generation of new elements, replaced by Clear and ClearLazy
+		generations   atomicUint32              // last sequence number handed out to a generation
+		defaultSize   uintptr
+		maxFillRate   uintptr                          // fill rate percentage of the index above which the map grows
+		growthFactor  uintptr                          // factor by which the index grows
+		metrics       Metrics                          // optional hooks notified of map operations
+		storage       valueStorage                     // layout of the elements, values small enough are stored inline
+		slab          atomicPointer[nodeSlab[K, V]]    // preallocated elements handed out before falling back to the heap
+		reclaimer     *reclaimer[K, V]                 // optional recycling of deleted elements, nil if disabled
+		initOnce      sync.Once                        // sets up a zero value map on first use
+		incremental   bool                             // automatic growth re-indexes the elements in steps
+		rehash        atomicPointer[rehashState[K, V]] // larger index being filled by an incremental resize
+		stepping      atomicUint32                     // an operation is indexing a step of the incremental resize
+		manualGrow    bool                             // the index is only resized on request
+		arena         bool                             // elements are allocated in slabs instead of one by one
+		onExpire      func(K, V)                       // optional callback notified of expired elements
+		sweeping      atomicUint32                     // the background sweeper of expired elements is running
+		ttlAdded      atomicUint32                     // an element with a TTL was set since the sweeper started its last pass
+		capacity      uintptr                          // number of elements above which the least recently used ones are evicted, 0 if unbounded
+		clockHand     atomicUintptr                    // hash of the element the eviction clock hand last stopped at
+		sketch        *frequencySketch                 // access frequencies for the admission of new elements into a bounded map, nil if disabled
+		strict        bool                             // the capacity is a hard ceiling, room is made before a new element is added
+		onEvict       func(K, V)                       // optional callback notified of evicted elements
+		hooks         *hooks[K, V]                     // optional callbacks notified of mutations, nil if none are set
+		resizes       atomicUintptr                    // number of index resizes since the map was created
+		debug         debugState[K, V]                 // misuse checks of the haxmapdebug build tag
+		cow           *cowState[K, V]                  // coordination of writers with open snapshots, nil unless enabled
+		deterministic bool                             // iteration order only depends on the keys and the hash seed
+		versions      atomicUintptr                    // version clock, at least the final version of every deleted element
+		watchers      atomicPointer[watchers[K, V]]    // watches of key modifications, nil until the first watch
+		interner      *Interner                        // shared copies of string keys, nil if keys are not interned
+		waiters       atomicPointer[waitLists[K, V]]   // GetWait calls blocked on missing keys, nil until the first wait
+		computing     atomicPointer[computations[K]]   // GetOrSetFunc calls constructing a value, nil until the first call
+		keyLocks      atomicPointer[keyLockTable]      // mutexes of LockKey, nil until the first call
+		budget        *byteBudget[K, V]                // size of the elements of a map bounded in bytes, nil if unbounded
+		// optional callback notified of index resizes
+		onResize func(oldSize, newSize uintptr, migrated int, took time.Duration)
+		// optional size of the index after an automatic growth, the growth factor is used if nil
+		resizePolicy func(current, length uintptr) uintptr
 	}
 
 	// used in deletion of map elements
-	deletionRequest[K hashable] struct {
+	deletionRequest[K comparable] struct {
 		keyHash uintptr
 		key     K
 	}
 )
 
 // New returns a new HashMap instance with an optional specific initialization size
-func New[K hashable, V any](size ...uintptr) *Map[K, V] {
-	m := &Map[K, V]{listHead: newListHead[K, V]()}
-	m.numItems.Store(0)
-	m.defaultSize = defaultSize
-	if len(size) > 0 && size[0] > 0 {
-		m.defaultSize = size[0]
-	}
-	m.allocate(m.defaultSize)
-	m.setDefaultHasher()
+// It panics if the key type has no default hasher, use NewWithOptions with WithHasher to provide one
+func New[K comparable, V any](size ...uintptr) *Map[K, V] {
+	var cfg config
+	if len(size) > 0 {
+		cfg.size = size[0]
+	}
+	m, err := newMap[K, V](&cfg)
+	if err != nil {
+		panic(err)
+	}
 	return m
 }
 
+// init sets up a zero value map on its first use
+// maps created by a constructor already have their metadata set, so this is a single atomic load for them
+func (m *Map[K, V]) init() {
+	if m.metadata.Load() == nil {
+		m.initOnce.Do(func() {
+			if err := m.configure(&config{}); err != nil {
+				panic(err)
+			}
+		})
+	}
+}
+
 // Del deletes key/keys from the map
 // Bulk deletion is more efficient than deleting keys one by one
 func (m *Map[K, V]) Del(keys ...K) {
-	size := len(keys)
+	m.init()
+	var (
+		size    = len(keys)
+		removed = 0
+	)
 	switch {
 	case size == 0:
 		return
 	case size == 1: // delete one
-		var (
-			h        = m.hasher(keys[0])
-			existing = m.metadata.Load().indexElement(h)
-		)
+		h := m.hasher(keys[0])
+		if r := m.reclaimer; r != nil {
+			defer r.exit(r.enter(h))
+		}
+		existing := m.metadata.Load().indexElement(h)
 		if existing == nil || existing.keyHash > h {
 			existing = m.listHead.next()
 		}
 		for ; existing != nil && existing.keyHash <= h; existing = existing.next() {
-			if existing.key == keys[0] {
-				if existing.remove() { // mark node for lazy removal on next pass
-					m.removeItemFromIndex(existing) // remove node from map index
+			if existing.keyHash == h && keyEquals(m.equal, existing.key, keys[0]) {
+				if m.discardIfStale(existing) {
+					continue
 				}
-				return
+				if m.removeElement(existing) {
+					removed++
+				}
+				break
 			}
 		}
 	default: // delete multiple entries
@@ -105,6 +170,9 @@ func (m *Map[K, V]) Del(keys ...K) {
 		for idx := 0; idx < size; idx++ {
 			delQ[idx].keyHash, delQ[idx].key = m.hasher(keys[idx]), keys[idx]
 		}
+		if r := m.reclaimer; r != nil {
+			defer r.exit(r.enter(delQ[0].keyHash))
+		}
 
 		// sort in ascending order of keyhash
 		sort.Slice(delQ, func(i, j int) bool {
@@ -118,9 +186,13 @@ func (m *Map[K, V]) Del(keys ...K) {
 		}
 
 		for elem != nil && iter < size {
-			if elem.keyHash == delQ[iter].keyHash && elem.key == delQ[iter].key {
-				if elem.remove() { // mark node for lazy removal on next pass
-					m.removeItemFromIndex(elem) // remove node from map index
+			if elem.keyHash == delQ[iter].keyHash && keyEquals(m.equal, elem.key, delQ[iter].key) {
+				if m.discardIfStale(elem) {
+					elem = elem.next()
+					continue
+				}
+				if m.removeElement(elem) {
+					removed++
 				}
 				iter++
 				elem = elem.next()
@@ -131,20 +203,44 @@ func (m *Map[K, V]) Del(keys ...K) {
 			}
 		}
 	}
+	if m.metrics != nil {
+		m.metrics.Del(removed)
+	}
 }
 
 // Get retrieves an element from the map
 // returns `false“ if element is absent
 func (m *Map[K, V]) Get(key K) (value V, ok bool) {
+	m.init()
 	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	if m.sketch != nil {
+		m.sketch.increment(h)
+	}
+	elem := m.metadata.Load().indexElement(h)
+	if elem == nil || elem.keyHash > h {
+		elem = m.listHead.nextPtr.Load() // no usable index entry before the key, search from the start of the list
+	}
 	// inline search
-	for elem := m.metadata.Load().indexElement(h); elem != nil && elem.keyHash <= h; elem = elem.nextPtr.Load() {
-		if elem.key == key {
-			value, ok = *elem.value.Load(), !elem.isDeleted()
-			return
+	for ; elem != nil && elem.keyHash <= h; elem = elem.nextPtr.Load() {
+		if elem.keyHash == h && keyEquals(m.equal, elem.key, key) {
+			if elem.isDeleted() {
+				continue // a newer element for the key may follow a deleted one which is not unlinked yet
+			}
+			value, ok = elem.load(m.storage), true
+			if m.expireIfDue(elem) {
+				value, ok = *new(V), false
+			} else if m.capacity != 0 {
+				elem.touch()
+			}
+			break
 		}
 	}
-	ok = false
+	if m.metrics != nil {
+		m.metrics.Get(ok)
+	}
 	return
 }
 
@@ -152,79 +248,48 @@ func (m *Map[K, V]) Get(key K) (value V, ok bool) {
 // If a resizing operation is happening concurrently while calling Set()
 // then the item might show up in the map only after the resize operation is finished
 func (m *Map[K, V]) Set(key K, value V) {
-	var (
-		h        = m.hasher(key)
-		valPtr   = &value
-		alloc    *element[K, V]
-		created  = false
-		data     = m.metadata.Load()
-		existing = data.indexElement(h)
-	)
-
-	if existing == nil || existing.keyHash > h {
-		existing = m.listHead
-	}
-	if alloc, created = existing.inject(h, key, valPtr); alloc != nil {
-		if created {
-			m.numItems.Add(1)
-		}
-	} else {
-		for existing = m.listHead; alloc == nil; alloc, created = existing.inject(h, key, valPtr) {
-		}
-		if created {
-			m.numItems.Add(1)
-		}
-	}
-
-	count := data.addItemToIndex(alloc)
-	if resizeNeeded(uintptr(len(data.index)), count) && m.resizing.CompareAndSwap(notResizing, resizingInProgress) {
-		m.grow(0) // double in size
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
 	}
+	data := m.metadata.Load()
+	m.insert(h, key, value, data, data.indexElement(h), true)
 }
 
 // GetOrSet returns the existing value for the key if present
 // Otherwise, it stores and returns the given value
 // The loaded result is true if the value was loaded, false if stored
 func (m *Map[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
 	var (
-		h        = m.hasher(key)
 		data     = m.metadata.Load()
 		existing = data.indexElement(h)
 	)
 	// try to get the element if present
 	for elem := existing; elem != nil && elem.keyHash <= h; elem = elem.nextPtr.Load() {
-		if elem.key == key && !elem.isDeleted() {
-			actual, loaded = *elem.value.Load(), true
+		if elem.keyHash == h && keyEquals(m.equal, elem.key, key) && !elem.isDeleted() && !m.expireIfDue(elem) {
+			actual, loaded = elem.load(m.storage), true
+			if m.capacity != 0 {
+				elem.touch()
+			}
+			if m.metrics != nil {
+				m.metrics.Get(true)
+			}
 			return
 		}
 	}
 	// Get() failed because element is absent
 	// store the value given by user
+	// a concurrent insertion of the same key wins, its value is returned instead
 	actual, loaded = value, false
 
-	var (
-		alloc   *element[K, V]
-		created = false
-		valPtr  = &value
-	)
-	if existing == nil || existing.keyHash > h {
-		existing = m.listHead
-	}
-	if alloc, created = existing.inject(h, key, valPtr); alloc != nil {
-		if created {
-			m.numItems.Add(1)
-		}
-	} else {
-		for existing = m.listHead; alloc == nil; alloc, created = existing.inject(h, key, valPtr) {
-		}
-		if created {
-			m.numItems.Add(1)
-		}
-	}
-
-	count := data.addItemToIndex(alloc)
-	if resizeNeeded(uintptr(len(data.index)), count) && m.resizing.CompareAndSwap(notResizing, resizingInProgress) {
-		m.grow(0) // double in size
+	if elem, created := m.insert(h, key, value, data, existing, false); !created {
+		actual, loaded = elem.load(m.storage), true
 	}
 	return
 }
@@ -232,113 +297,225 @@ func (m *Map[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
 // GetOrCompute is similar to GetOrSet but the value to be set is obtained from a constructor
 // the value constructor is called only once
 func (m *Map[K, V]) GetOrCompute(key K, valueFn func() V) (actual V, loaded bool) {
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
 	var (
-		h        = m.hasher(key)
 		data     = m.metadata.Load()
 		existing = data.indexElement(h)
 	)
 	// try to get the element if present
 	for elem := existing; elem != nil && elem.keyHash <= h; elem = elem.nextPtr.Load() {
-		if elem.key == key && !elem.isDeleted() {
-			actual, loaded = *elem.value.Load(), true
+		if elem.keyHash == h && keyEquals(m.equal, elem.key, key) && !elem.isDeleted() && !m.expireIfDue(elem) {
+			actual, loaded = elem.load(m.storage), true
+			if m.capacity != 0 {
+				elem.touch()
+			}
+			if m.metrics != nil {
+				m.metrics.Get(true)
+			}
 			return
 		}
 	}
 	// Get() failed because element is absent
 	// compute the value from the constructor and store it
 	value := valueFn()
+	// a concurrent insertion of the same key wins, its value is returned instead
 	actual, loaded = value, false
 
-	var (
-		alloc   *element[K, V]
-		created = false
-		valPtr  = &value
-	)
-	if existing == nil || existing.keyHash > h {
-		existing = m.listHead
-	}
-	if alloc, created = existing.inject(h, key, valPtr); alloc != nil {
-		if created {
-			m.numItems.Add(1)
-		}
-	} else {
-		for existing = m.listHead; alloc == nil; alloc, created = existing.inject(h, key, valPtr) {
-		}
-		if created {
-			m.numItems.Add(1)
-		}
-	}
-
-	count := data.addItemToIndex(alloc)
-	if resizeNeeded(uintptr(len(data.index)), count) && m.resizing.CompareAndSwap(notResizing, resizingInProgress) {
-		m.grow(0) // double in size
+	if elem, created := m.insert(h, key, value, data, existing, false); !created {
+		actual, loaded = elem.load(m.storage), true
 	}
 	return
 }
 
 // GetAndDel deletes the key from the map, returning the previous value if any.
 func (m *Map[K, V]) GetAndDel(key K) (value V, ok bool) {
-	var (
-		h        = m.hasher(key)
-		existing = m.metadata.Load().indexElement(h)
-	)
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	existing := m.metadata.Load().indexElement(h)
 	if existing == nil || existing.keyHash > h {
 		existing = m.listHead.next()
 	}
 	for ; existing != nil && existing.keyHash <= h; existing = existing.next() {
-		if existing.key == key {
-			value, ok = *existing.value.Load(), !existing.isDeleted()
-			if existing.remove() {
-				m.removeItemFromIndex(existing)
+		if existing.keyHash == h && keyEquals(m.equal, existing.key, key) {
+			if m.discardIfStale(existing) {
+				continue
 			}
-			return
+			value, ok = existing.load(m.storage), !existing.isDeleted()
+			if !m.removeElement(existing) {
+				ok = false
+			}
+			break
 		}
 	}
+	if m.metrics != nil {
+		m.metrics.Del(boolToInt(ok))
+	}
 	return
 }
 
 // CompareAndSwap atomically updates a map entry given its key by comparing current value to `oldValue`
 // and setting it to `newValue` if the above comparison is successful
 // It returns a boolean indicating whether the CompareAndSwap was successful or not
-func (m *Map[K, V]) CompareAndSwap(key K, oldValue, newValue V) bool {
-	var (
-		h        = m.hasher(key)
-		existing = m.metadata.Load().indexElement(h)
-	)
+func (m *Map[K, V]) CompareAndSwap(key K, oldValue, newValue V) (swapped bool) {
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	existing := m.metadata.Load().indexElement(h)
 	if existing == nil || existing.keyHash > h {
 		existing = m.listHead
 	}
-	if _, current, _ := existing.search(h, key); current != nil {
-		if oldPtr := current.value.Load(); reflect.DeepEqual(*oldPtr, oldValue) {
-			return current.value.CompareAndSwap(oldPtr, &newValue)
+	if _, current, _ := m.search(existing, h, key); current != nil {
+		if c := m.cow; c != nil {
+			defer c.exit(c.enter(h))
+			c.save(m, current, true)
 		}
+		_, swapped = current.modify(m.storage, func(value V, _ uintptr) (V, bool) {
+			return newValue, reflect.DeepEqual(value, oldValue)
+		})
 	}
-	return false
+	if swapped {
+		m.updated(key, oldValue, newValue)
+	}
+	return swapped
 }
 
 // Swap atomically swaps the value of a map entry given its key
 // It returns the old value if swap was successful and a boolean `swapped` indicating whether the swap was successful or not
 func (m *Map[K, V]) Swap(key K, newValue V) (oldValue V, swapped bool) {
-	var (
-		h        = m.hasher(key)
-		existing = m.metadata.Load().indexElement(h)
-	)
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	existing := m.metadata.Load().indexElement(h)
 	if existing == nil || existing.keyHash > h {
 		existing = m.listHead
 	}
-	if _, current, _ := existing.search(h, key); current != nil {
-		oldValue, swapped = *current.value.Swap(&newValue), true
+	if _, current, _ := m.search(existing, h, key); current != nil {
+		if c := m.cow; c != nil {
+			defer c.exit(c.enter(h))
+			c.save(m, current, true)
+		}
+		if oldValue, swapped = current.swap(m.storage, newValue); !swapped {
+			return *new(V), false // deleted in the meantime
+		}
+		m.updated(key, oldValue, newValue)
 	} else {
 		swapped = false
 	}
 	return
 }
 
+// SwapIf atomically replaces the value of a map entry given its key with `newValue` if cond holds on the current value
+// the value is replaced with a compare-and-swap, cond runs again on the latest value whenever another update of the key got in between,
+// so it must be quick, free of side effects and must not modify the map
+// It returns the value held before the call and a boolean `swapped` indicating whether the value was replaced, the value is the zero value if the key is absent
+func (m *Map[K, V]) SwapIf(key K, newValue V, cond func(oldValue V) bool) (oldValue V, swapped bool) {
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	existing := m.metadata.Load().indexElement(h)
+	if existing == nil || existing.keyHash > h {
+		existing = m.listHead
+	}
+	if _, current, _ := m.search(existing, h, key); current != nil {
+		if c := m.cow; c != nil {
+			defer c.exit(c.enter(h))
+			c.save(m, current, true)
+		}
+		oldValue, swapped = current.modify(m.storage, func(value V, _ uintptr) (V, bool) {
+			return newValue, cond(value)
+		})
+	}
+	if swapped {
+		m.updated(key, oldValue, newValue)
+	}
+	return
+}
+
 // ForEach iterates over key-value pairs and executes the lambda provided for each such pair
 // lambda must return `true` to continue iteration and `false` to break iteration
 func (m *Map[K, V]) ForEach(lambda func(K, V) bool) {
-	for item := m.listHead.next(); item != nil && lambda(item.key, *item.value.Load()); item = item.next() {
+	m.init()
+	lambda = m.debug.iteration(lambda)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	m.walk(func(item *element[K, V]) bool {
+		return lambda(item.key, item.load(m.storage))
+	})
+}
+
+// ForEachCtx is like ForEach but stops early once the context is done, returning its error
+// the context is checked every few hundred elements, so cancelling it aborts even a scan over a huge map promptly
+func (m *Map[K, V]) ForEachCtx(ctx context.Context, lambda func(K, V) bool) error {
+	m.init()
+	lambda = m.debug.iteration(lambda)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	var (
+		err error
+		n   int
+	)
+	m.walk(func(item *element[K, V]) bool {
+		if n++; n%ctxCheckInterval == 1 { // checked before the first element as well
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		return lambda(item.key, item.load(m.storage))
+	})
+	return err
+}
+
+// walk passes the live elements to fn in iteration order until it returns false
+// elements are ordered by hash, with a deterministic order elements sharing a hash are ordered by their printed key instead of their insertion order
+func (m *Map[K, V]) walk(fn func(item *element[K, V]) bool) {
+	if !m.deterministic {
+		for item := m.listHead.next(); item != nil; item = item.next() {
+			if !m.expireIfDue(item) && !fn(item) {
+				return
+			}
+		}
+		return
+	}
+	var run []*element[K, V] // elements sharing the hash of the first one
+	flush := func() bool {
+		if len(run) > 1 {
+			sort.SliceStable(run, func(i, j int) bool {
+				return fmt.Sprint(run[i].key) < fmt.Sprint(run[j].key)
+			})
+		}
+		for _, item := range run {
+			if !fn(item) {
+				return false
+			}
+		}
+		run = run[:0]
+		return true
+	}
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		if m.expireIfDue(item) {
+			continue
+		}
+		if len(run) > 0 && run[0].keyHash != item.keyHash && !flush() {
+			return
+		}
+		run = append(run, item)
 	}
+	flush()
 }
 
 // Grow resizes the hashmap to a new size, gets rounded up to next power of 2
@@ -346,61 +523,110 @@ func (m *Map[K, V]) ForEach(lambda func(K, V) bool) {
 // No resizing is done in case of another resize operation already being in progress
 // Growth and map bucket policy is inspired from https://github.com/cornelk/hashmap
 func (m *Map[K, V]) Grow(newSize uintptr) {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	if m.incremental {
+		m.finishRehash()
+	}
 	if m.resizing.CompareAndSwap(notResizing, resizingInProgress) {
 		m.grow(newSize)
 	}
 }
 
+// Compact physically unlinks all elements marked for deletion or left behind by ClearLazy and rebuilds the index at the smallest size suited to the current number of elements
+// this releases the memory held by a map after mass deletions, the index is left untouched if a resize is already in progress
+func (m *Map[K, V]) Compact() {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	// traversing the list unlinks deleted elements as a side effect, stale elements are discarded on the way
+	g := m.gen.Load()
+	for item := m.listHead; item != nil; item = item.next() {
+		m.discardIfStale(item)
+	}
+	g.pruning.Store(0)
+	if m.incremental {
+		m.finishRehash()
+	}
+	if !m.resizing.CompareAndSwap(notResizing, resizingInProgress) {
+		return
+	}
+	m.grow(m.fittingSize())
+}
+
 // Clear the map by removing all entries in the map.
 // This operation resets the underlying metadata to its initial state.
 func (m *Map[K, V]) Clear() {
-	index := make([]*element[K, V], m.defaultSize)
-	header := (*reflect.SliceHeader)(unsafe.Pointer(&index))
-	newdata := &metadata[K, V]{
-		keyshifts: strconv.IntSize - log2(m.defaultSize),
-		data:      unsafe.Pointer(header.Data),
-		index:     index,
+	m.init()
+	if c := m.cow; c != nil {
+		defer c.exit(c.enter(0))
+		for item := m.listHead.next(); item != nil; item = item.next() {
+			c.save(m, item, true)
+		}
+	}
+	if m.rehash.Swap(nil) != nil { // drop the index of a pending incremental resize
+		m.resizing.Store(notResizing)
+	}
+	if m.storage == versionedValues {
+		// versions of the dropped elements must not be handed out again
+		for item := m.listHead.next(); item != nil; item = item.next() {
+			m.retireVersion(item, anyVersion)
+		}
 	}
 	m.listHead.nextPtr.Store(nil)
-	m.metadata.Store(newdata)
-	m.numItems.Store(0)
+	m.metadata.Store(newMetadata[K, V](m.defaultSize))
+	m.gen.Store(m.newGeneration())
+	if b := m.budget; b != nil {
+		atomic.StoreInt64(&b.used, 0)
+	}
 }
 
 // SetHasher sets the hash function to the one provided by the user
 func (m *Map[K, V]) SetHasher(hs func(K) uintptr) {
+	m.init()
+	m.debug.setHasher(m.Len())
 	m.hasher = hs
 }
 
 // Len returns the number of key-value pairs within the map
 func (m *Map[K, V]) Len() uintptr {
-	return m.numItems.Load()
+	if g := m.gen.Load(); g != nil {
+		return g.numItems.Load()
+	}
+	return 0
+}
+
+// Cap returns the size of the map index, the map grows once the number of used index slots exceeds the max fill rate of it
+func (m *Map[K, V]) Cap() uintptr {
+	m.init()
+	return uintptr(len(m.metadata.Load().index))
 }
 
 // Fillrate returns the fill rate of the map as an percentage integer
 func (m *Map[K, V]) Fillrate() uintptr {
+	m.init()
 	data := m.metadata.Load()
 	return (data.count.Load() * 100) / uintptr(len(data.index))
 }
 
 // MarshalJSON implements the json.Marshaler interface.
+// The map is encoded as a JSON object like a Go map, so keys must be strings, integers or implement encoding.TextMarshaler
 func (m *Map[K, V]) MarshalJSON() ([]byte, error) {
-	gomap := make(map[K]V)
-	for i := m.listHead.next(); i != nil; i = i.next() {
-		gomap[i.key] = *i.value.Load()
-	}
-	return json.Marshal(gomap)
+	return json.Marshal(m.ToMap())
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
+// The entries of the JSON object are added to the map, which is sized for all of them up front
 func (m *Map[K, V]) UnmarshalJSON(i []byte) error {
 	gomap := make(map[K]V)
 	err := json.Unmarshal(i, &gomap)
 	if err != nil {
 		return err
 	}
-	for k, v := range gomap {
-		m.Set(k, v)
-	}
+	m.InsertMap(gomap)
 	return nil
 }
 
@@ -411,40 +637,238 @@ func (m *Map[K, V]) allocate(newSize uintptr) {
 	}
 }
 
+// insert stores the value for the key searching from the existing element onwards and grows the map if needed
+// the value of an element already holding the key is only replaced if overwrite is set
+// it returns the element holding the key and whether it was newly created
+func (m *Map[K, V]) insert(h uintptr, key K, value V, data *metadata[K, V], existing *element[K, V], overwrite bool) (*element[K, V], bool) {
+	if existing == nil || existing.keyHash > h {
+		existing = m.listHead
+	}
+	if m.sketch != nil {
+		m.sketch.increment(h)
+	}
+	var (
+		alloc    *element[K, V]
+		gen      *generation
+		created  bool
+		reserved bool
+	)
+	if m.strict {
+		// update an existing element in place, only a new key has to make room first
+		if _, curr, _ := m.search(existing, h, key); curr != nil {
+			if overwrite {
+				m.update(curr, value)
+			}
+			alloc = curr
+		} else {
+			gen, reserved = m.reserve(), true
+		}
+	}
+	if alloc == nil {
+		if gen == nil {
+			gen = m.gen.Load()
+		}
+		alloc, created = m.inject(existing, h, key, value, gen, overwrite)
+		for existing = m.listHead; alloc == nil; alloc, created = m.inject(existing, h, key, value, gen, overwrite) {
+		}
+	}
+	m.debug.insert(key, h, created)
+	if created {
+		if !reserved {
+			gen.numItems.Add(1)
+		}
+		m.inserted(key, value)
+		if gen.pruning.Load() != 0 {
+			m.prune(gen)
+		}
+	} else if reserved {
+		gen.numItems.Add(^uintptr(0)) // the key was added concurrently, release the reserved room
+	}
+	if !created && overwrite && alloc.expiry() != 0 {
+		alloc.setExpiry(0) // a plain store replaces the value set with a TTL
+	}
+	if m.capacity != 0 {
+		alloc.touch()
+	}
+
+	count := data.addItemToIndex(alloc)
+	if m.resizeNeeded(uintptr(len(data.index)), count) && m.resizing.CompareAndSwap(notResizing, resizingInProgress) {
+		if m.incremental {
+			m.startRehash(0)
+		} else {
+			m.grow(0) // grow by the growth factor
+		}
+	}
+	if m.incremental {
+		m.stepRehash()
+	}
+	if created && m.capacity != 0 {
+		for m.Len() > m.capacity && m.evict(alloc) {
+		}
+	}
+	if b := m.budget; b != nil && (created || overwrite) {
+		for b.exceeded() && m.evict(alloc) {
+		}
+	}
+	if m.metrics != nil {
+		if created || overwrite {
+			m.metrics.Set(created)
+		} else {
+			m.metrics.Get(true)
+		}
+	}
+	return alloc, created
+}
+
+// inject updates an existing value in the list if present and overwrite is set or adds a new entry after the start element
+func (m *Map[K, V]) inject(start *element[K, V], c uintptr, key K, value V, gen *generation, overwrite bool) (*element[K, V], bool) {
+	var (
+		alloc             *element[K, V]
+		left, curr, right = m.search(start, c, key)
+	)
+	if curr != nil {
+		if overwrite {
+			m.update(curr, value)
+		}
+		return curr, false
+	}
+	if left != nil {
+		alloc = m.newElement()
+		alloc.keyHash, alloc.key, alloc.gen = c, m.internKey(key), gen.seq
+		m.initValue(alloc, value)
+		if m.link(left, alloc, right) {
+			return alloc, true
+		}
+	}
+	return nil, false
+}
+
+// update replaces the value of an existing element and reports the change to the hooks
+func (m *Map[K, V]) update(elem *element[K, V], value V) {
+	m.updateIfVersion(elem, value, anyVersion)
+}
+
+// updateIfVersion replaces the value of an existing element if it still has the given version and reports the change to the hooks
+// it returns false if the version did not match or the element was deleted
+func (m *Map[K, V]) updateIfVersion(elem *element[K, V], value V, version uintptr) bool {
+	if c := m.cow; c != nil {
+		defer c.exit(c.enter(elem.keyHash)) // entered before the update, snapshots wait for writers
+		c.save(m, elem, true)
+	}
+	if m.storage != versionedValues && !m.observed() {
+		elem.store(m.storage, value)
+		return true
+	}
+	old, ok := elem.modify(m.storage, func(_ V, current uintptr) (V, bool) {
+		return value, version == anyVersion || version == current
+	})
+	if ok {
+		m.updated(elem.key, old, value)
+	}
+	return ok
+}
+
+// link adds a new element between left and right, open snapshots record its key as absent first
+func (m *Map[K, V]) link(left, alloc, right *element[K, V]) bool {
+	if c := m.cow; c != nil {
+		defer c.exit(c.enter(alloc.keyHash))
+		if left.nextPtr.Load() != right {
+			return false // the key may have been added in the meantime
+		}
+		c.save(m, alloc, false)
+	}
+	return left.addBefore(alloc, right)
+}
+
 // fillIndexItems re-indexes the map given the latest state of the linked list
-func (m *Map[K, V]) fillIndexItems(mapData *metadata[K, V]) {
+// it returns the number of elements walked
+func (m *Map[K, V]) fillIndexItems(mapData *metadata[K, V]) (migrated int) {
 	var (
 		first     = m.listHead.next()
 		item      = first
 		lastIndex = uintptr(0)
 	)
-	for item != nil {
-		index := item.keyHash >> mapData.keyshifts
+	for ; item != nil; migrated++ {
+		index := mapData.position(item.keyHash)
 		if item == first || index != lastIndex {
 			mapData.addItemToIndex(item)
 			lastIndex = index
 		}
 		item = item.next()
 	}
+	return
 }
 
-// removeItemFromIndex removes an item from the map index
-func (m *Map[K, V]) removeItemFromIndex(item *element[K, V]) {
-	for {
-		data := m.metadata.Load()
-		index := item.keyHash >> data.keyshifts
-		ptr := (*unsafe.Pointer)(unsafe.Pointer(uintptr(data.data) + index*intSizeBytes))
+// apply replaces the value of an existing element with the result of fn on its current value and reports the change to the hooks
+// fn runs again on the latest value whenever another update of the element got in between
+// it returns the new value, or false if the element was deleted
+func (m *Map[K, V]) apply(elem *element[K, V], fn func(V) V) (value V, ok bool) {
+	if c := m.cow; c != nil {
+		defer c.exit(c.enter(elem.keyHash))
+		c.save(m, elem, true)
+	}
+	old, ok := elem.modify(m.storage, func(current V, _ uintptr) (V, bool) {
+		value = fn(current)
+		return value, true
+	})
+	if !ok {
+		return *new(V), false
+	}
+	if m.observed() {
+		m.updated(elem.key, old, value)
+	}
+	return value, true
+}
+
+// removeElement marks an element as deleted and removes it from the index
+// it returns false if the element was already deleted by another operation
+func (m *Map[K, V]) removeElement(elem *element[K, V]) bool {
+	return m.removeElementIfVersion(elem, anyVersion)
+}
 
-		next := item.next()
-		if next != nil && next.keyHash>>data.keyshifts != index {
-			next = nil // do not set index to next item if it's not the same slice index
+// removeElementIfVersion is like removeElement for an element which still has the given version
+func (m *Map[K, V]) removeElementIfVersion(elem *element[K, V], version uintptr) bool {
+	var counter *paddedCounter
+	if c := m.cow; c != nil {
+		counter = c.enter(elem.keyHash)
+	}
+	// the value and version of a versioned element are final from here on
+	removed := m.retireVersion(elem, version)
+	var value V
+	if removed && m.observed() {
+		value = elem.load(m.storage) // loaded before the element may be recycled
+	}
+	if c := m.cow; c != nil {
+		if removed {
+			c.save(m, elem, true)
 		}
-		swappedToNil := atomic.CompareAndSwapPointer(ptr, unsafe.Pointer(item), unsafe.Pointer(next)) && next == nil
+		c.exit(counter)
+	}
+	if !removed || !elem.remove() { // mark node for lazy removal on next pass
+		return false
+	}
+	m.removeItemFromIndex(elem) // remove node from map index
+	if m.reclaimer != nil {
+		m.reclaimer.retire(m, elem)
+	}
+	if m.incremental {
+		m.stepRehash()
+	}
+	m.deleted(elem.key, value)
+	return true
+}
 
+// removeItemFromIndex removes an item from the map index and from the index of a pending incremental resize
+func (m *Map[K, V]) removeItemFromIndex(item *element[K, V]) {
+	if state := m.rehash.Load(); state != nil {
+		state.data.removeItem(item)
+	}
+	for {
+		data := m.metadata.Load()
+		data.removeItem(item)
 		if data == m.metadata.Load() { // check that no resize happened
-			m.numItems.Add(^uintptr(0)) // decrement counter
-			if swappedToNil {           // decrement the metadata count if the index is set to nil
-				data.count.Add(^uintptr(0))
+			if g := m.gen.Load(); g.seq == item.gen {
+				g.numItems.Add(^uintptr(0)) // decrement counter, elements of an earlier generation are not counted anymore
 			}
 			return
 		}
@@ -456,34 +880,60 @@ func (m *Map[K, V]) grow(newSize uintptr) {
 	for {
 		currentStore := m.metadata.Load()
 		if newSize == 0 {
-			newSize = uintptr(len(currentStore.index)) << 1
+			newSize = m.nextSize(uintptr(len(currentStore.index)))
 		} else {
 			newSize = roundUpPower2(newSize)
 		}
 
-		index := make([]*element[K, V], newSize)
-		header := (*reflect.SliceHeader)(unsafe.Pointer(&index))
-
-		newdata := &metadata[K, V]{
-			keyshifts: strconv.IntSize - log2(newSize),
-			data:      unsafe.Pointer(header.Data),
-			index:     index,
-		}
-
-		m.fillIndexItems(newdata) // re-index with longer and more widespread keys
+		start := time.Now()
+		newdata := newMetadata[K, V](newSize)
+		migrated := m.fillIndexItems(newdata) // re-index with longer and more widespread keys
 		m.metadata.Store(newdata)
+		if currentStore != nil { // the initial allocation is not a resize
+			m.resizes.Add(1)
+		}
+		if m.metrics != nil {
+			m.metrics.Resize(uintptr(len(currentStore.index)), newSize)
+		}
+		if m.onResize != nil {
+			m.onResize(uintptr(len(currentStore.index)), newSize, migrated, time.Since(start))
+		}
 
-		if !resizeNeeded(newSize, uintptr(m.Len())) {
+		if !m.resizeNeeded(newSize, uintptr(m.Len())) {
 			m.resizing.Store(notResizing)
 			return
 		}
-		newSize = 0 // 0 means double the current size
+		newSize = 0 // 0 means grow the current size by the growth factor
+	}
+}
+
+// newMetadata allocates an empty index of the given size
+func newMetadata[K comparable, V any](size uintptr) *metadata[K, V] {
+	index := make([]*element[K, V], size)
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&index))
+	md := &metadata[K, V]{
+		data:  unsafe.Pointer(header.Data),
+		index: index,
+	}
+	if size&(size-1) == 0 {
+		md.keyshifts = strconv.IntSize - log2(size)
+	}
+	return md
+}
+
+// position returns the index slot of a hash, slots grow with the hash so that the index follows the order of the list
+// power of 2 sizes take the top bits of the hash, other sizes scale the hash down to the size
+func (md *metadata[K, V]) position(hashedKey uintptr) uintptr {
+	if md.keyshifts != 0 {
+		return hashedKey >> md.keyshifts
 	}
+	hi, _ := bits.Mul(uint(hashedKey), uint(len(md.index)))
+	return uintptr(hi)
 }
 
 // indexElement returns the index of a hash key, returns `nil` if absent
 func (md *metadata[K, V]) indexElement(hashedKey uintptr) *element[K, V] {
-	index := hashedKey >> md.keyshifts
+	index := md.position(hashedKey)
 	ptr := (*unsafe.Pointer)(unsafe.Pointer(uintptr(md.data) + index*intSizeBytes))
 	item := (*element[K, V])(atomic.LoadPointer(ptr))
 	for (item == nil || hashedKey < item.keyHash || item.isDeleted()) && index > 0 {
@@ -491,12 +941,29 @@ func (md *metadata[K, V]) indexElement(hashedKey uintptr) *element[K, V] {
 		ptr = (*unsafe.Pointer)(unsafe.Pointer(uintptr(md.data) + index*intSizeBytes))
 		item = (*element[K, V])(atomic.LoadPointer(ptr))
 	}
+	if item != nil && item.isDeleted() {
+		return nil // the links of a deleted element may skip elements inserted after it was unlinked, searches start from the list head instead
+	}
 	return item
 }
 
+// removeItem hands the index slot of an item over to the next item of the same slot if the slot refers to it
+func (md *metadata[K, V]) removeItem(item *element[K, V]) {
+	index := md.position(item.keyHash)
+	ptr := (*unsafe.Pointer)(unsafe.Pointer(uintptr(md.data) + index*intSizeBytes))
+
+	next := item.next()
+	if next != nil && md.position(next.keyHash) != index {
+		next = nil // do not set index to next item if it's not the same slice index
+	}
+	if atomic.CompareAndSwapPointer(ptr, unsafe.Pointer(item), unsafe.Pointer(next)) && next == nil {
+		md.count.Add(^uintptr(0)) // decrement the metadata count if the index is set to nil
+	}
+}
+
 // addItemToIndex adds an item to the index if needed and returns the new item counter if it changed, otherwise 0
 func (md *metadata[K, V]) addItemToIndex(item *element[K, V]) uintptr {
-	index := item.keyHash >> md.keyshifts
+	index := md.position(item.keyHash)
 	ptr := (*unsafe.Pointer)(unsafe.Pointer(uintptr(md.data) + index*intSizeBytes))
 	for {
 		elem := (*element[K, V])(atomic.LoadPointer(ptr))
@@ -515,22 +982,37 @@ func (md *metadata[K, V]) addItemToIndex(item *element[K, V]) uintptr {
 	}
 }
 
-// check if resize is needed
-func resizeNeeded(length, count uintptr) bool {
-	return (count*100)/length > maxFillRate
+// nextSize returns the size the index grows to once the max fill rate is exceeded
+func (m *Map[K, V]) nextSize(current uintptr) uintptr {
+	if m.resizePolicy == nil {
+		return roundUpPower2(current * m.growthFactor)
+	}
+	// sizes too small for the current elements would trigger another growth right away
+	newSize := m.resizePolicy(current, m.Len())
+	if fitting := m.fittingSize(); newSize < fitting {
+		newSize = fitting
+	}
+	return newSize
+}
+
+// check if resize is needed, never the case if automatic growth is disabled
+func (m *Map[K, V]) resizeNeeded(length, count uintptr) bool {
+	if m.manualGrow {
+		return false
+	}
+	return (count*100)/length > m.maxFillRate
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 // roundUpPower2 rounds a number to the next power of 2
 func roundUpPower2(i uintptr) uintptr {
-	i--
-	i |= i >> 1
-	i |= i >> 2
-	i |= i >> 4
-	i |= i >> 8
-	i |= i >> 16
-	i |= i >> 32
-	i++
-	return i
+	return 1 << bits.Len(uint(i-1))
 }
 
 // log2 computes the binary logarithm of x, rounded up to the next integer
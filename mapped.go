@@ -0,0 +1,330 @@
+package haxmap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// mappedMagic starts every mapped file, the last byte is the format version
+const mappedMagic = "haxmmap\x01"
+
+// layout of a mapped file, all offsets are multiples of 8 so that the words can be accessed atomically
+const (
+	mappedHeaderSize = 64 // magic, key size, value size, number of slots, length, used slots, clean flag
+	mappedSlotHeader = 8  // state and sequence word of a slot
+	mappedMaxFill    = 75 // percentage of slots which can be used before the map is full
+)
+
+// states of a slot of a mapped map
+const (
+	slotEmpty uint32 = iota
+	slotWriting
+	slotFull
+	slotDeleted
+)
+
+var (
+	// ErrMappedFull is returned by MappedMap.Set when the file has no room left for a new key
+	ErrMappedFull = errors.New("haxmap: mapped map is full")
+	// ErrInvalidMappedFile is returned by OpenMapped when the file was not created for the same key and value types
+	ErrInvalidMappedFile = errors.New("haxmap: invalid mapped file")
+)
+
+// MappedMap is a concurrent hash table living in a memory mapped file, so that it can be reopened after a restart without rebuilding it
+// keys and values must be of fixed size types without pointers, they are stored by their memory representation and keys are compared by it,
+// so the file can only be opened on machines with the same byte order and word size
+// the table is an open addressing table with a fixed number of slots chosen on creation, deleted keys leave their slot unusable
+// lookups are lock-free, writers of the same slot take turns
+type MappedMap[K comparable, V any] struct {
+	file      *os.File
+	data      []byte // the mapped file
+	slots     uintptr
+	slotSize  uintptr
+	keySize   uintptr
+	valueSize uintptr
+}
+
+// OpenMapped opens the mapped map stored in the file at path, creating it with room for capacity keys if it does not exist
+// a file which was not closed properly is checked and interrupted writes are rolled back on open
+func OpenMapped[K comparable, V any](path string, capacity int) (*MappedMap[K, V], error) {
+	kt, vt := typeOf[K](), typeOf[V]()
+	if hasPointers(kt) || hasPointers(vt) {
+		return nil, fmt.Errorf("haxmap: mapped maps only hold types without pointers, got %v and %v", kt, vt)
+	}
+	mm := &MappedMap[K, V]{keySize: kt.Size(), valueSize: vt.Size()}
+	mm.slotSize = mappedSlotHeader + align8(mm.keySize) + align8(mm.valueSize)
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	created := info.Size() == 0
+	size := info.Size()
+	if created {
+		if capacity <= 0 {
+			file.Close()
+			return nil, fmt.Errorf("haxmap: capacity of a mapped map must be positive, got %d", capacity)
+		}
+		mm.slots = roundUpPower2(uintptr(capacity)*100/mappedMaxFill + 1)
+		size = int64(mappedHeaderSize + mm.slots*mm.slotSize)
+		if err = file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else if size < mappedHeaderSize {
+		file.Close()
+		return nil, ErrInvalidMappedFile
+	}
+	if mm.data, err = mmapFile(file, int(size)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	mm.file = file
+
+	if created {
+		copy(mm.data, mappedMagic)
+		*mm.word(8) = uint64(mm.keySize)<<32 | uint64(mm.valueSize)
+		*mm.word(16) = uint64(mm.slots)
+	} else if err = mm.check(size); err != nil {
+		mm.unmap()
+		return nil, err
+	}
+	if atomic.SwapUint64(mm.word(48), 0) == 0 && !created {
+		mm.recover() // not closed properly
+	}
+	return mm, nil
+}
+
+// Get retrieves the value of the key
+func (mm *MappedMap[K, V]) Get(key K) (value V, ok bool) {
+	k := bytesOf(&key, mm.keySize)
+	for i, n := mm.start(k), uintptr(0); n < mm.slots; i, n = (i+1)&(mm.slots-1), n+1 {
+		switch mm.waitState(i) {
+		case slotEmpty:
+			return
+		case slotFull:
+			if bytes.Equal(mm.key(i), k) {
+				return mm.load(i), true
+			}
+		}
+	}
+	return
+}
+
+// Set sets the value of the key, it returns ErrMappedFull if the key is new and the map has no room left
+func (mm *MappedMap[K, V]) Set(key K, value V) error {
+	k := bytesOf(&key, mm.keySize)
+	for i, n := mm.start(k), uintptr(0); n < mm.slots; {
+		switch mm.waitState(i) {
+		case slotEmpty:
+			if used := atomic.AddUint64(mm.word(32), 1); used > uint64(mm.slots*mappedMaxFill/100) {
+				atomic.AddUint64(mm.word(32), ^uint64(0))
+				return ErrMappedFull
+			}
+			if !atomic.CompareAndSwapUint32(mm.state(i), slotEmpty, slotWriting) {
+				atomic.AddUint64(mm.word(32), ^uint64(0))
+				continue // claimed concurrently, check the slot again
+			}
+			// the key is written while the slot is claimed, writers of the same key wait for it instead of claiming another slot
+			copy(mm.key(i), k)
+			copy(mm.value(i), bytesOf(&value, mm.valueSize))
+			atomic.StoreUint32(mm.state(i), slotFull)
+			atomic.AddUint64(mm.word(24), 1)
+			return nil
+		case slotFull:
+			if bytes.Equal(mm.key(i), k) {
+				mm.store(i, value)
+				return nil
+			}
+		}
+		i, n = (i+1)&(mm.slots-1), n+1
+	}
+	return ErrMappedFull
+}
+
+// Del deletes the key and reports whether it was present
+func (mm *MappedMap[K, V]) Del(key K) bool {
+	k := bytesOf(&key, mm.keySize)
+	for i, n := mm.start(k), uintptr(0); n < mm.slots; i, n = (i+1)&(mm.slots-1), n+1 {
+		switch mm.waitState(i) {
+		case slotEmpty:
+			return false
+		case slotFull:
+			if bytes.Equal(mm.key(i), k) {
+				if !atomic.CompareAndSwapUint32(mm.state(i), slotFull, slotDeleted) {
+					return false // deleted concurrently
+				}
+				atomic.AddUint64(mm.word(24), ^uint64(0))
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Len returns the number of key-value pairs
+func (mm *MappedMap[K, V]) Len() uintptr {
+	return uintptr(atomic.LoadUint64(mm.word(24)))
+}
+
+// ForEach iterates over the key-value pairs in slot order
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (mm *MappedMap[K, V]) ForEach(lambda func(K, V) bool) {
+	for i := uintptr(0); i < mm.slots; i++ {
+		if atomic.LoadUint32(mm.state(i)) != slotFull {
+			continue
+		}
+		var key K
+		copy(bytesOf(&key, mm.keySize), mm.key(i))
+		if !lambda(key, mm.load(i)) {
+			return
+		}
+	}
+}
+
+// Sync flushes the changes to the file
+func (mm *MappedMap[K, V]) Sync() error {
+	return msync(mm.data)
+}
+
+// Close flushes the changes, marks the file as properly closed and unmaps it
+// the map must not be used afterwards
+func (mm *MappedMap[K, V]) Close() error {
+	if err := mm.Sync(); err != nil {
+		return err
+	}
+	atomic.StoreUint64(mm.word(48), 1)
+	if err := msync(mm.data[:mappedHeaderSize]); err != nil {
+		return err
+	}
+	return mm.unmap()
+}
+
+// check validates the header of an existing file against the key and value types
+func (mm *MappedMap[K, V]) check(size int64) error {
+	if string(mm.data[:len(mappedMagic)]) != mappedMagic || *mm.word(8) != uint64(mm.keySize)<<32|uint64(mm.valueSize) {
+		return ErrInvalidMappedFile
+	}
+	mm.slots = uintptr(*mm.word(16))
+	if mm.slots == 0 || mm.slots&(mm.slots-1) != 0 || size != int64(mappedHeaderSize+mm.slots*mm.slotSize) {
+		return ErrInvalidMappedFile
+	}
+	return nil
+}
+
+// recover rolls back the writes interrupted by a crash and recounts the keys
+func (mm *MappedMap[K, V]) recover() {
+	var count, used uint64
+	for i := uintptr(0); i < mm.slots; i++ {
+		state := mm.state(i)
+		if *state == slotWriting {
+			*state = slotDeleted // the key may be incomplete, its slot stays claimed so that probing continues past it
+		}
+		*mm.seq(i) &^= 1
+		if *state == slotFull {
+			count++
+		}
+		if *state != slotEmpty {
+			used++
+		}
+	}
+	*mm.word(24), *mm.word(32) = count, used
+}
+
+// unmap releases the mapping and closes the file
+func (mm *MappedMap[K, V]) unmap() error {
+	err := munmap(mm.data)
+	if cerr := mm.file.Close(); err == nil {
+		err = cerr
+	}
+	mm.data = nil
+	return err
+}
+
+// start returns the first slot probed for the key
+func (mm *MappedMap[K, V]) start(key []byte) uintptr {
+	return uintptr(xxHash(key, 0)) & (mm.slots - 1)
+}
+
+// waitState returns the state of the slot once its key is complete
+func (mm *MappedMap[K, V]) waitState(i uintptr) uint32 {
+	for {
+		if state := atomic.LoadUint32(mm.state(i)); state != slotWriting {
+			return state
+		}
+		runtime.Gosched()
+	}
+}
+
+// load reads the value of the slot, retrying while a writer replaces it
+func (mm *MappedMap[K, V]) load(i uintptr) (value V) {
+	seq := mm.seq(i)
+	for {
+		before := atomic.LoadUint32(seq)
+		if before&1 == 0 {
+			copy(bytesOf(&value, mm.valueSize), mm.value(i))
+			if atomic.LoadUint32(seq) == before {
+				return
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// store replaces the value of the slot, writers of the same slot take turns through its sequence word
+func (mm *MappedMap[K, V]) store(i uintptr, value V) {
+	seq := mm.seq(i)
+	for {
+		current := atomic.LoadUint32(seq)
+		if current&1 == 0 && atomic.CompareAndSwapUint32(seq, current, current+1) {
+			copy(mm.value(i), bytesOf(&value, mm.valueSize))
+			atomic.StoreUint32(seq, current+2)
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+// word returns a header word
+func (mm *MappedMap[K, V]) word(offset uintptr) *uint64 {
+	return (*uint64)(unsafe.Pointer(&mm.data[offset]))
+}
+
+func (mm *MappedMap[K, V]) slot(i uintptr) uintptr { return mappedHeaderSize + i*mm.slotSize }
+func (mm *MappedMap[K, V]) state(i uintptr) *uint32 {
+	return (*uint32)(unsafe.Pointer(&mm.data[mm.slot(i)]))
+}
+func (mm *MappedMap[K, V]) seq(i uintptr) *uint32 {
+	return (*uint32)(unsafe.Pointer(&mm.data[mm.slot(i)+4]))
+}
+func (mm *MappedMap[K, V]) key(i uintptr) []byte {
+	offset := mm.slot(i) + mappedSlotHeader
+	return mm.data[offset : offset+mm.keySize]
+}
+func (mm *MappedMap[K, V]) value(i uintptr) []byte {
+	offset := mm.slot(i) + mappedSlotHeader + align8(mm.keySize)
+	return mm.data[offset : offset+mm.valueSize]
+}
+
+// bytesOf returns the memory of a value of a type without pointers
+func bytesOf[T any](p *T, size uintptr) []byte {
+	if size == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), size)
+}
+
+// align8 rounds n up to a multiple of 8
+func align8(n uintptr) uintptr {
+	return (n + 7) &^ 7
+}
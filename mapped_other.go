@@ -0,0 +1,23 @@
+//go:build (!linux && !darwin) || haxmap_purego
+
+package haxmap
+
+import (
+	"errors"
+	"os"
+)
+
+// errMmapUnsupported is returned by OpenMapped on platforms without memory mapped files
+var errMmapUnsupported = errors.New("haxmap: mapped maps are not supported on this platform")
+
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap(data []byte) error {
+	return errMmapUnsupported
+}
+
+func msync(data []byte) error {
+	return errMmapUnsupported
+}
@@ -0,0 +1,90 @@
+//go:build (linux || darwin) && !haxmap_purego
+
+package haxmap
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type mappedPoint struct {
+	X, Y int32
+}
+
+func TestMappedMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "points.haxmap")
+	mm, err := OpenMapped[uint64, mappedPoint](path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < 1000; i += 4 {
+				if err := mm.Set(uint64(i), mappedPoint{int32(i), -int32(i)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	// the capacity is a lower bound, the map fills up once its slots are used up to the max fill rate
+	size := uint64(1000)
+	for ; err == nil; size++ {
+		err = mm.Set(size, mappedPoint{})
+	}
+	if !errors.Is(err, ErrMappedFull) || mm.Len() != uintptr(size-1) {
+		t.Errorf("map should be full, got: %v, length: %d", err, mm.Len())
+	}
+	size--
+	if !mm.Del(1) || mm.Del(1) || mm.Len() != uintptr(size-1) {
+		t.Error("deleted key should be gone")
+	}
+	mm.Set(2, mappedPoint{7, 7})
+	if err := mm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopened with the stored contents
+	mm, err = OpenMapped[uint64, mappedPoint](path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := mm.Get(2); !ok || p != (mappedPoint{7, 7}) {
+		t.Errorf("unexpected value after reopening: %v", p)
+	}
+	if p, ok := mm.Get(999); !ok || p != (mappedPoint{999, -999}) {
+		t.Errorf("unexpected value after reopening: %v", p)
+	}
+	if _, ok := mm.Get(1); ok || mm.Len() != uintptr(size-1) {
+		t.Errorf("deleted key should stay deleted, length: %d", mm.Len())
+	}
+
+	// a file which was not closed properly is recounted on open
+	*mm.state(0) = slotWriting
+	mm.unmap()
+	mm, err = OpenMapped[uint64, mappedPoint](path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := uintptr(0)
+	mm.ForEach(func(uint64, mappedPoint) bool {
+		n++
+		return true
+	})
+	if n != mm.Len() || *mm.state(0) == slotWriting {
+		t.Errorf("interrupted write should be rolled back, length: %d, pairs: %d", mm.Len(), n)
+	}
+	mm.Close()
+
+	if _, err := OpenMapped[uint32, mappedPoint](path, 0); !errors.Is(err, ErrInvalidMappedFile) {
+		t.Errorf("file of other types should be rejected, got: %v", err)
+	}
+	if _, err := OpenMapped[string, int](filepath.Join(t.TempDir(), "strings"), 10); err == nil {
+		t.Error("types with pointers should be rejected")
+	}
+}
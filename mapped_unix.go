@@ -0,0 +1,30 @@
+//go:build (linux || darwin) && !haxmap_purego
+
+package haxmap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mmapFile maps the file into memory for reading and writing, changes are written back to the file
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// munmap releases a mapping created by mmapFile
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
+
+// msync writes the changes of the mapped memory back to the file
+func msync(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), syscall.MS_SYNC); errno != 0 {
+		return errno
+	}
+	return nil
+}
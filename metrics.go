@@ -0,0 +1,14 @@
+package haxmap
+
+// Metrics receives notifications about the operations performed on a map
+// the hooks are called synchronously on the hot path, so implementations must be fast and safe for concurrent use
+type Metrics interface {
+	// Get is called after every lookup with whether the key was found
+	Get(found bool)
+	// Set is called after every store with whether a new element was inserted
+	Set(inserted bool)
+	// Del is called after every deletion with the number of elements removed
+	Del(removed int)
+	// Resize is called after the index of the map is resized
+	Resize(oldSize, newSize uintptr)
+}
@@ -0,0 +1,114 @@
+package haxmap
+
+import "reflect"
+
+// MultiMap is a concurrent map holding a list of values per key
+// the lists are replaced as a whole on every modification, so concurrent appends and removals of the same key never lose a value
+// the zero value is an empty map ready to use with the default settings
+type MultiMap[K comparable, V any] struct {
+	m Map[K, []V]
+}
+
+// NewMultiMap returns a new multimap with an optional specific initialization size
+// It panics if the key type has no default hasher, use NewMultiMapWithOptions with WithHasher to provide one
+func NewMultiMap[K comparable, V any](size ...uintptr) *MultiMap[K, V] {
+	var cfg config
+	if len(size) > 0 {
+		cfg.size = size[0]
+	}
+	return newMultiMap[K, V](&cfg)
+}
+
+// NewMultiMapWithOptions returns a new multimap configured with the given options, typed options concerning values apply to the lists of values
+// It panics if the configuration is invalid
+func NewMultiMapWithOptions[K comparable, V any](opts ...Option) *MultiMap[K, V] {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return newMultiMap[K, V](&cfg)
+}
+
+// newMultiMap allocates a multimap and applies the given configuration to it
+func newMultiMap[K comparable, V any](cfg *config) *MultiMap[K, V] {
+	mm := &MultiMap[K, V]{}
+	cfg.versions = true // updates are built on GetVersioned
+	if err := mm.m.configure(cfg); err != nil {
+		panic(err)
+	}
+	return mm
+}
+
+// Append adds the value to the end of the list of the key
+// the list is copied on every append, so keys with long lists are better served by a Map with a concurrent container as value
+func (mm *MultiMap[K, V]) Append(key K, value V) {
+	mm.m.initVersioned()
+	for {
+		values, version, _ := mm.m.GetVersioned(key)
+		updated := make([]V, len(values), len(values)+1)
+		copy(updated, values)
+		if mm.m.SetIfVersion(key, append(updated, value), version) {
+			return
+		}
+	}
+}
+
+// GetAll returns a copy of the values of the key in the order they were appended, nil if the key has none
+func (mm *MultiMap[K, V]) GetAll(key K) []V {
+	mm.m.initVersioned()
+	values, _ := mm.m.Get(key)
+	if len(values) == 0 {
+		return nil
+	}
+	return append([]V(nil), values...)
+}
+
+// RemoveValue removes the first value of the key which is deeply equal to the given one and reports whether there was one
+// the key is deleted together with its last value
+func (mm *MultiMap[K, V]) RemoveValue(key K, value V) bool {
+	mm.m.initVersioned()
+	for {
+		values, version, ok := mm.m.GetVersioned(key)
+		if !ok {
+			return false
+		}
+		i := 0
+		for i < len(values) && !reflect.DeepEqual(values[i], value) {
+			i++
+		}
+		if i == len(values) {
+			return false
+		}
+		if len(values) == 1 {
+			if mm.m.delIfVersion(key, version) {
+				return true
+			}
+			continue
+		}
+		updated := make([]V, 0, len(values)-1)
+		updated = append(append(updated, values[:i]...), values[i+1:]...)
+		if mm.m.SetIfVersion(key, updated, version) {
+			return true
+		}
+	}
+}
+
+// Del deletes the keys together with all their values
+func (mm *MultiMap[K, V]) Del(keys ...K) {
+	mm.m.initVersioned()
+	mm.m.Del(keys...)
+}
+
+// Len returns the number of keys holding at least one value
+func (mm *MultiMap[K, V]) Len() uintptr {
+	mm.m.initVersioned()
+	return mm.m.Len()
+}
+
+// ForEach iterates over the keys and their values
+// the slices passed to lambda must not be modified
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (mm *MultiMap[K, V]) ForEach(lambda func(K, []V) bool) {
+	mm.m.initVersioned()
+	mm.m.ForEach(lambda)
+}
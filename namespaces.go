@@ -0,0 +1,76 @@
+package haxmap
+
+// Namespaces is a concurrent collection of maps identified by name, such as the data of every tenant of a service
+// the namespaces are held in a Map themselves, so looking them up is lock-free and does not contend between namespaces
+type Namespaces[N comparable, K comparable, V any] struct {
+	spaces Map[N, *Map[K, V]]
+	opts   []Option
+}
+
+// NewNamespaces returns an empty collection of namespaces, the options configure the map of every namespace
+// It panics if the options are invalid
+func NewNamespaces[N comparable, K comparable, V any](opts ...Option) *Namespaces[N, K, V] {
+	if _, err := TryNew[K, V](opts...); err != nil {
+		panic(err)
+	}
+	return &Namespaces[N, K, V]{opts: opts}
+}
+
+// Ns returns the map of the namespace, creating it on first use
+func (ns *Namespaces[N, K, V]) Ns(name N) *Map[K, V] {
+	ns.spaces.initVersioned()
+	if m, ok := ns.spaces.Get(name); ok {
+		return m
+	}
+	m, _ := ns.spaces.GetOrCompute(name, func() *Map[K, V] {
+		return NewWithOptions[K, V](ns.opts...)
+	})
+	return m
+}
+
+// Get returns the map of the namespace without creating it
+func (ns *Namespaces[N, K, V]) Get(name N) (*Map[K, V], bool) {
+	ns.spaces.initVersioned()
+	return ns.spaces.Get(name)
+}
+
+// Drop deletes the namespace with all its elements in a single step and returns its map, the next Ns call for the name starts with an empty map
+// the returned map and earlier references to it are detached from the namespaces, elements set through them are not visible anymore
+func (ns *Namespaces[N, K, V]) Drop(name N) (*Map[K, V], bool) {
+	ns.spaces.initVersioned()
+	return ns.spaces.GetAndDel(name)
+}
+
+// DropEmpty deletes the namespaces whose maps are empty and returns their number
+// a namespace receiving its first element concurrently may be dropped with it
+func (ns *Namespaces[N, K, V]) DropEmpty() int {
+	ns.spaces.initVersioned()
+	var empty []N
+	ns.spaces.ForEach(func(name N, m *Map[K, V]) bool {
+		if m.Len() == 0 {
+			empty = append(empty, name)
+		}
+		return true
+	})
+	dropped := 0
+	for _, name := range empty {
+		// the version makes sure a namespace dropped and created again in the meantime is left alone
+		if m, version, ok := ns.spaces.GetVersioned(name); ok && m.Len() == 0 && ns.spaces.delIfVersion(name, version) {
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Len returns the number of namespaces
+func (ns *Namespaces[N, K, V]) Len() uintptr {
+	ns.spaces.initVersioned()
+	return ns.spaces.Len()
+}
+
+// ForEach iterates over the namespaces and their maps
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (ns *Namespaces[N, K, V]) ForEach(lambda func(N, *Map[K, V]) bool) {
+	ns.spaces.initVersioned()
+	ns.spaces.ForEach(lambda)
+}
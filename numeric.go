@@ -0,0 +1,40 @@
+package haxmap
+
+import "golang.org/x/exp/constraints"
+
+// Number is the set of value types supported by Add, Inc and Dec
+type Number interface {
+	constraints.Integer | constraints.Float
+}
+
+// Add atomically adds delta to the value of the key and returns the new value, a missing key is created with delta as its value
+// the value is updated with a compare-and-swap loop, so concurrent increments are never lost and values stored inline are counted without allocating
+func Add[K comparable, V Number](m *Map[K, V], key K, delta V) V {
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	for {
+		data := m.metadata.Load()
+		elem, created := m.insert(h, key, delta, data, data.indexElement(h), false)
+		if created {
+			return delta
+		}
+		if value, ok := m.apply(elem, func(value V) V { return value + delta }); ok {
+			return value
+		}
+		// the element was deleted in the meantime, the key is created again
+	}
+}
+
+// Inc atomically increments the value of the key by one and returns the new value
+func Inc[K comparable, V Number](m *Map[K, V], key K) V {
+	return Add(m, key, 1)
+}
+
+// Dec atomically decrements the value of the key by one and returns the new value
+func Dec[K comparable, V Number](m *Map[K, V], key K) V {
+	var one V = 1
+	return Add(m, key, -one)
+}
@@ -0,0 +1,479 @@
+package haxmap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+type (
+	// Option configures a map created with NewWithOptions
+	Option func(*config)
+
+	// config holds the settings of a map under construction
+	// typed settings are stored as `any` so that options do not need the map's type parameters
+	// and are checked against the key type when the map is created
+	config struct {
+		hasher        any
+		equal         any
+		normalize     any
+		algorithm     HashAlgorithm
+		size          uintptr
+		fillRate      uintptr
+		growth        uintptr
+		seed          uint64
+		orderSeed     uint64
+		metrics       Metrics
+		reclaim       bool
+		incremental   bool
+		manualGrow    bool
+		arena         bool
+		onExpire      any
+		capacity      uintptr
+		tinyLFU       bool
+		strict        bool
+		maxEntries    int
+		onEvict       any
+		onInsert      any
+		onUpdate      any
+		onDelete      any
+		hookQueue     int
+		snapshots     bool
+		versions      bool
+		deterministic bool
+		onResize      func(oldSize, newSize uintptr, migrated int, took time.Duration)
+		interner      *Interner
+		resizePolicy  func(current, length uintptr) uintptr
+		maxBytes      int64
+		sizeOf        any
+	}
+)
+
+// WithSize sets the initial size of the map index, same as the size argument of New
+func WithSize(size uintptr) Option {
+	return func(c *config) {
+		c.size = size
+	}
+}
+
+// WithHasher sets the hash function used for keys in place of the default xxHash algorithm
+// keys which are equal must always produce the same hash
+func WithHasher[K comparable](hs func(K) uintptr) Option {
+	return func(c *config) {
+		c.hasher = hs
+	}
+}
+
+// WithEqual sets the function used to compare keys in place of `==`
+// it must be paired with a hasher which returns the same hash for all keys it considers equal
+func WithEqual[K comparable](eq func(a, b K) bool) Option {
+	return func(c *config) {
+		c.equal = eq
+	}
+}
+
+// WithHashAlgorithm selects the default hash algorithm used for keys, it has no effect if a hasher is provided with WithHasher
+func WithHashAlgorithm(alg HashAlgorithm) Option {
+	return func(c *config) {
+		c.algorithm = alg
+	}
+}
+
+// WithMaxFillRate sets the fill rate percentage of the index above which the map grows, the default is 50
+// lower values trade memory for shorter searches while higher values make the map denser
+// the rate must be between 1 and 100
+func WithMaxFillRate(rate uintptr) Option {
+	return func(c *config) {
+		c.fillRate = rate
+	}
+}
+
+// WithGrowthFactor sets the factor by which the index grows once the max fill rate is exceeded, the default is 2
+// the resulting size is rounded up to the next power of 2
+func WithGrowthFactor(factor uintptr) Option {
+	return func(c *config) {
+		c.growth = factor
+	}
+}
+
+// WithResizePolicy sets the function choosing the size of the index whenever it grows automatically, in place of the growth factor
+// it is called with the current size of the index and the number of elements, the returned size is used as is without rounding to a power of 2,
+// example growing by 1.5 instead of doubling
+//
+//	haxmap.WithResizePolicy(func(current, length uintptr) uintptr { return current + current/2 })
+//
+// sizes too small to keep the fill rate of the current elements below its maximum are raised to the smallest size which does
+func WithResizePolicy(fn func(current, length uintptr) uintptr) Option {
+	return func(c *config) {
+		c.resizePolicy = fn
+	}
+}
+
+// WithSeed seeds the default hash algorithm, maps with different seeds distribute the same keys differently
+// the AESHash algorithm is always randomly seeded and ignores the seed
+func WithSeed(seed uint64) Option {
+	return func(c *config) {
+		c.seed = seed
+	}
+}
+
+// WithMetrics registers hooks which are notified of the operations performed on the map
+func WithMetrics(mt Metrics) Option {
+	return func(c *config) {
+		c.metrics = mt
+	}
+}
+
+// WithKeyNormalizer maps every key to a canonical form before it is hashed or compared
+// example strings.ToLower makes the map case-insensitive, so "Foo" and "foo" refer to the same element
+// the key stored in the map and passed to ForEach is the one given on insertion, not its normalized form
+func WithKeyNormalizer[K comparable](fn func(K) K) Option {
+	return func(c *config) {
+		c.normalize = fn
+	}
+}
+
+// WithNodeReclamation recycles the elements of deleted keys for new insertions instead of leaving them to the garbage collector
+// this smooths out memory usage and GC pressure under heavy insert/delete churn at the cost of some bookkeeping on every operation
+func WithNodeReclamation() Option {
+	return func(c *config) {
+		c.reclaim = true
+	}
+}
+
+// WithIncrementalResize spreads the work of growing the map over the write operations following the growth trigger
+// instead of re-indexing all elements at once in the operation which triggered it
+// lookups keep using the current index until the larger one is complete, so no single operation stalls on a resize
+func WithIncrementalResize() Option {
+	return func(c *config) {
+		c.incremental = true
+	}
+}
+
+// WithAutoGrow enables or disables growing the index once the max fill rate is exceeded, it is enabled by default
+// with automatic growth disabled the index is only resized by Grow, Rehash, Reserve and Compact,
+// lookups get slower as the fill rate rises but no write operation ever pays for a resize
+func WithAutoGrow(enabled bool) Option {
+	return func(c *config) {
+		c.manualGrow = !enabled
+	}
+}
+
+// WithArena allocates elements in slabs of many elements instead of one by one and recycles the elements of deleted keys,
+// this is WithNodeReclamation combined with slab allocation
+// it cuts down allocator and GC work for insert/delete heavy workloads, a slab is only released once all of its elements are gone
+func WithArena() Option {
+	return func(c *config) {
+		c.arena = true
+	}
+}
+
+// WithOnExpire registers a callback notified of every element removed because its TTL passed
+// it is called from the goroutine which noticed the expiration, either an operation accessing the element or the background sweeper
+func WithOnExpire[K comparable, V any](fn func(K, V)) Option {
+	return func(c *config) {
+		c.onExpire = fn
+	}
+}
+
+// WithTinyLFU adds a TinyLFU admission filter to a bounded map created with NewLRU
+// the access frequencies of all keys, including missed lookups, are estimated with a compact sketch
+// and a new element is only admitted if its key was accessed more often than the element it would evict,
+// so keys which are seen only once cannot push out frequently used ones
+// it has no effect on unbounded maps
+func WithTinyLFU() Option {
+	return func(c *config) {
+		c.tinyLFU = true
+	}
+}
+
+// WithMaxEntries bounds the map to at most n elements like NewLRU, but as a hard ceiling which also holds under concurrent insertions
+// an insertion of a new key into a full map evicts an element which was not accessed recently before the new element is added
+// onEvict is notified of every evicted pair from the goroutine which evicted it, it may be nil
+// n must be positive
+func WithMaxEntries[K comparable, V any](n int, onEvict func(K, V)) Option {
+	return func(c *config) {
+		c.strict, c.maxEntries = true, n
+		if onEvict != nil {
+			c.onEvict = onEvict
+		}
+	}
+}
+
+// WithOnInsert registers a hook notified after a new key was added to the map
+func WithOnInsert[K comparable, V any](fn func(key K, value V)) Option {
+	return func(c *config) {
+		c.onInsert = fn
+	}
+}
+
+// WithOnUpdate registers a hook notified after the value of an existing key was replaced by Set, Swap or CompareAndSwap
+func WithOnUpdate[K comparable, V any](fn func(key K, oldValue, newValue V)) Option {
+	return func(c *config) {
+		c.onUpdate = fn
+	}
+}
+
+// WithOnDelete registers a hook notified after a key was removed from the map,
+// this covers deletions as well as evictions and expirations but not Clear
+func WithOnDelete[K comparable, V any](fn func(key K, value V)) Option {
+	return func(c *config) {
+		c.onDelete = fn
+	}
+}
+
+// WithAsyncHooks runs the lifecycle hooks in a background goroutine instead of the goroutine performing the mutation
+// mutations are queued and reported in the order they were queued, a mutation waits for room if the queue of queueSize events is full
+// the goroutine only runs while events are queued
+func WithAsyncHooks(queueSize int) Option {
+	return func(c *config) {
+		c.hookQueue = queueSize
+	}
+}
+
+// WithSnapshots enables Snapshot for taking consistent point-in-time views of the map
+// every modification registers itself so that a snapshot can wait for the ones in progress, which adds a little overhead to writes
+func WithSnapshots() Option {
+	return func(c *config) {
+		c.snapshots = true
+	}
+}
+
+// WithVersions enables GetVersioned and SetIfVersion for optimistic updates of a key over several steps
+// every value is held in a record together with its version, which costs an allocation on every store even for values which would be stored inline
+func WithVersions() Option {
+	return func(c *config) {
+		c.versions = true
+	}
+}
+
+// WithDeterministicOrder makes the iteration order of ForEach and EncodeFunc depend only on the keys of the map and the seed,
+// so golden files and reproductions of tests are stable across runs regardless of the order in which the keys were inserted
+// elements are iterated in ascending order of their hash seeded with the given seed, keys sharing a hash are ordered by their printed form
+// the seed is also the seed of the hash algorithm, a different one given with WithSeed is rejected
+// it cannot be combined with AESHash, which is seeded randomly on startup
+func WithDeterministicOrder(seed uint64) Option {
+	return func(c *config) {
+		c.deterministic, c.orderSeed = true, seed
+	}
+}
+
+// WithOnResize sets a callback called after every resize of the map index with the old and new index size,
+// the number of elements indexed and the time the resize took, for incremental resizes the time since the resize was started
+// it is called synchronously by the operation completing the resize
+func WithOnResize(fn func(oldSize, newSize uintptr, migrated int, took time.Duration)) Option {
+	return func(c *config) {
+		c.onResize = fn
+	}
+}
+
+// WithInterner stores a single copy of equal string keys across all maps sharing the interner, see Interner
+// it is only valid for maps with keys of a string type
+func WithInterner(in *Interner) Option {
+	return func(c *config) {
+		c.interner = in
+	}
+}
+
+// ErrUnsupportedKeyType is returned when the key type of a map has no default hasher and none was provided
+var ErrUnsupportedKeyType = errors.New("haxmap: unsupported key type")
+
+// NewWithOptions returns a new HashMap instance configured with the given options
+// It panics if the key type cannot be hashed or an option does not match the key type of the map, use TryNew to get an error instead
+func NewWithOptions[K comparable, V any](opts ...Option) *Map[K, V] {
+	m, err := TryNew[K, V](opts...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// TryNew returns a new HashMap instance configured with the given options
+// It returns an error wrapping ErrUnsupportedKeyType if the key type has no default hasher and none was provided with WithHasher
+func TryNew[K comparable, V any](opts ...Option) (*Map[K, V], error) {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return newMap[K, V](&cfg)
+}
+
+// newMap allocates a map and applies the given configuration to it
+func newMap[K comparable, V any](cfg *config) (*Map[K, V], error) {
+	m := &Map[K, V]{}
+	if err := m.configure(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// configure applies the configuration to a zero map and allocates its index
+// the index is published last, so that a map whose metadata is visible is always fully set up
+func (m *Map[K, V]) configure(cfg *config) error {
+	m.storage = storageOf(typeOf[V]())
+	if cfg.versions {
+		m.storage = versionedValues
+	}
+	m.listHead = newListHead[K, V](m.storage)
+	m.gen.Store(m.newGeneration())
+	m.defaultSize = defaultSize
+	if cfg.size > 0 {
+		m.defaultSize = cfg.size
+	}
+	m.maxFillRate = defaultMaxFillRate
+	if cfg.fillRate > 100 {
+		return fmt.Errorf("haxmap: max fill rate must be between 1 and 100, got %d", cfg.fillRate)
+	} else if cfg.fillRate > 0 {
+		m.maxFillRate = cfg.fillRate
+	}
+	m.growthFactor = defaultGrowthFactor
+	if cfg.growth == 1 {
+		return errors.New("haxmap: growth factor must be at least 2")
+	} else if cfg.growth > 1 {
+		m.growthFactor = cfg.growth
+	}
+	if cfg.reclaim || cfg.arena {
+		m.reclaimer = &reclaimer[K, V]{}
+	}
+	m.arena = cfg.arena
+	if cfg.snapshots {
+		m.cow = &cowState[K, V]{}
+	}
+	m.incremental, m.manualGrow = cfg.incremental, cfg.manualGrow
+	m.capacity = cfg.capacity
+	if cfg.strict {
+		if cfg.maxEntries <= 0 {
+			return fmt.Errorf("haxmap: max entries must be positive, got %d", cfg.maxEntries)
+		}
+		m.capacity, m.strict = uintptr(cfg.maxEntries), true
+	}
+	if cfg.tinyLFU && m.capacity != 0 {
+		m.sketch = newFrequencySketch(m.capacity)
+	}
+	if cfg.sizeOf != nil {
+		sizeOf, ok := cfg.sizeOf.(func(K, V) int)
+		if !ok {
+			return fmt.Errorf("haxmap: size estimator of type %T does not match map type %v", cfg.sizeOf, typeOf[*Map[K, V]]())
+		}
+		if cfg.maxBytes <= 0 {
+			return fmt.Errorf("haxmap: max bytes must be positive, got %d", cfg.maxBytes)
+		}
+		m.budget = &byteBudget[K, V]{limit: cfg.maxBytes, sizeOf: sizeOf}
+		if m.capacity == 0 {
+			m.capacity = ^uintptr(0) // track accesses for the eviction like a map bounded in elements, with a bound which is never reached
+		}
+	}
+	if cfg.deterministic && cfg.algorithm == AESHash {
+		return errors.New("haxmap: deterministic order cannot be combined with the randomly seeded AESHash algorithm")
+	}
+	seed := cfg.seed
+	if cfg.deterministic {
+		if seed != 0 && seed != cfg.orderSeed {
+			return fmt.Errorf("haxmap: deterministic order seed %d conflicts with hash seed %d", cfg.orderSeed, seed)
+		}
+		seed = cfg.orderSeed
+	}
+	m.deterministic = cfg.deterministic
+	m.setDefaultHasher()
+	m.setHashAlgorithm(cfg.algorithm, seed)
+
+	if cfg.hasher != nil {
+		hs, ok := cfg.hasher.(func(K) uintptr)
+		if !ok {
+			return fmt.Errorf("haxmap: hasher of type %T does not match key type %v", cfg.hasher, typeOf[K]())
+		}
+		m.hasher = hs
+	}
+	if m.hasher == nil {
+		return fmt.Errorf("%w %v, provide a hasher with WithHasher", ErrUnsupportedKeyType, typeOf[K]())
+	}
+	if cfg.equal != nil {
+		eq, ok := cfg.equal.(func(a, b K) bool)
+		if !ok {
+			return fmt.Errorf("haxmap: equality function of type %T does not match key type %v", cfg.equal, typeOf[K]())
+		}
+		m.equal = eq
+	}
+	if cfg.normalize != nil {
+		normalize, ok := cfg.normalize.(func(K) K)
+		if !ok {
+			return fmt.Errorf("haxmap: key normalizer of type %T does not match key type %v", cfg.normalize, typeOf[K]())
+		}
+		// wrap the hasher and equality so that both always agree on the normalized key
+		hasher, equal := m.hasher, m.equal
+		m.hasher = func(key K) uintptr {
+			return hasher(normalize(key))
+		}
+		m.equal = func(a, b K) bool {
+			return keyEquals(equal, normalize(a), normalize(b))
+		}
+	}
+	if cfg.onExpire != nil {
+		onExpire, ok := cfg.onExpire.(func(K, V))
+		if !ok {
+			return fmt.Errorf("haxmap: expiration callback of type %T does not match map type %v", cfg.onExpire, typeOf[*Map[K, V]]())
+		}
+		m.onExpire = onExpire
+	}
+	if cfg.onEvict != nil {
+		onEvict, ok := cfg.onEvict.(func(K, V))
+		if !ok {
+			return fmt.Errorf("haxmap: eviction callback of type %T does not match map type %v", cfg.onEvict, typeOf[*Map[K, V]]())
+		}
+		m.onEvict = onEvict
+	}
+	if cfg.interner != nil {
+		if typeOf[K]().Kind() != reflect.String {
+			return fmt.Errorf("haxmap: only string keys can be interned, got %v", typeOf[K]())
+		}
+		m.interner = cfg.interner
+	}
+	if err := m.configureHooks(cfg); err != nil {
+		return err
+	}
+	m.allocate(m.defaultSize)
+	if cfg.metrics != nil {
+		m.metrics = cfg.metrics // set after the initial allocation which is not reported as a resize
+	}
+	m.onResize = cfg.onResize
+	m.resizePolicy = cfg.resizePolicy
+	return nil
+}
+
+// configureHooks sets up the lifecycle hooks of the map, the map has no hooks if none is registered
+func (m *Map[K, V]) configureHooks(cfg *config) error {
+	if cfg.hookQueue < 0 {
+		return fmt.Errorf("haxmap: hook queue size must not be negative, got %d", cfg.hookQueue)
+	}
+	if cfg.onInsert == nil && cfg.onUpdate == nil && cfg.onDelete == nil {
+		return nil
+	}
+	h := &hooks[K, V]{}
+	if cfg.onInsert != nil {
+		fn, ok := cfg.onInsert.(func(K, V))
+		if !ok {
+			return fmt.Errorf("haxmap: insert hook of type %T does not match map type %v", cfg.onInsert, typeOf[*Map[K, V]]())
+		}
+		h.onInsert = fn
+	}
+	if cfg.onUpdate != nil {
+		fn, ok := cfg.onUpdate.(func(K, V, V))
+		if !ok {
+			return fmt.Errorf("haxmap: update hook of type %T does not match map type %v", cfg.onUpdate, typeOf[*Map[K, V]]())
+		}
+		h.onUpdate = fn
+	}
+	if cfg.onDelete != nil {
+		fn, ok := cfg.onDelete.(func(K, V))
+		if !ok {
+			return fmt.Errorf("haxmap: delete hook of type %T does not match map type %v", cfg.onDelete, typeOf[*Map[K, V]]())
+		}
+		h.onDelete = fn
+	}
+	if cfg.hookQueue > 0 {
+		h.queue = make(chan hookEvent[K, V], cfg.hookQueue)
+	}
+	m.hooks = h
+	return nil
+}
@@ -0,0 +1,46 @@
+package haxmap
+
+import (
+	"sort"
+
+	"golang.org/x/exp/constraints"
+)
+
+// ForEachOrdered iterates over the key-value pairs of the map in ascending key order
+// lambda must return `true` to continue iteration and `false` to break iteration
+// elements are kept in hash order, so the keys are collected and sorted first, elements deleted in the meantime are skipped
+func ForEachOrdered[K constraints.Ordered, V any](m *Map[K, V], lambda func(K, V) bool) {
+	m.ascend(func(K) bool { return true }, func(a, b K) bool { return a < b }, lambda)
+}
+
+// AscendRange iterates over the key-value pairs with keys in the range [from, to) in ascending key order
+// lambda must return `true` to continue iteration and `false` to break iteration
+// only the elements within the range are collected and sorted, but finding them takes a pass over all elements
+func AscendRange[K constraints.Ordered, V any](m *Map[K, V], from, to K, lambda func(K, V) bool) {
+	m.ascend(func(key K) bool { return key >= from && key < to }, func(a, b K) bool { return a < b }, lambda)
+}
+
+// ascend collects the elements whose keys match and passes them to lambda in the order given by less
+func (m *Map[K, V]) ascend(match func(K) bool, less func(a, b K) bool, lambda func(K, V) bool) {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	var items []*element[K, V]
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		if match(item.key) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return less(items[i].key, items[j].key)
+	})
+	for _, item := range items {
+		if item.isDeleted() || m.expireIfDue(item) {
+			continue
+		}
+		if !lambda(item.key, item.load(m.storage)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package haxmap
+
+import "sort"
+
+type (
+	// OrderedMap is a concurrent map whose iteration yields the elements in the order their keys were first inserted
+	// replacing the value of a key keeps its position, deleting the key and setting it again moves it to the end
+	// the zero value is an empty map ready to use with the default settings
+	OrderedMap[K comparable, V any] struct {
+		m   Map[K, orderedEntry[V]]
+		seq atomicUintptr // source of insertion sequence numbers
+	}
+
+	// orderedEntry is a value of an OrderedMap together with the insertion sequence number of its key
+	orderedEntry[V any] struct {
+		seq   uintptr
+		value V
+	}
+)
+
+// NewOrderedMap returns a new insertion ordered map with an optional specific initialization size
+func NewOrderedMap[K comparable, V any](size ...uintptr) *OrderedMap[K, V] {
+	cfg := config{versions: true} // updates are built on GetVersioned
+	if len(size) > 0 {
+		cfg.size = size[0]
+	}
+	om := &OrderedMap[K, V]{}
+	if err := om.m.configure(&cfg); err != nil {
+		panic(err)
+	}
+	return om
+}
+
+// Get retrieves the value of the key
+func (om *OrderedMap[K, V]) Get(key K) (value V, ok bool) {
+	om.m.initVersioned()
+	entry, ok := om.m.Get(key)
+	return entry.value, ok
+}
+
+// Set sets the value of the key, a new key is placed after all present ones
+func (om *OrderedMap[K, V]) Set(key K, value V) {
+	om.m.initVersioned()
+	for {
+		entry, version, ok := om.m.GetVersioned(key)
+		if !ok {
+			entry.seq = om.seq.Add(1)
+		}
+		entry.value = value
+		if om.m.SetIfVersion(key, entry, version) {
+			return
+		}
+	}
+}
+
+// Del deletes the keys
+func (om *OrderedMap[K, V]) Del(keys ...K) {
+	om.m.initVersioned()
+	om.m.Del(keys...)
+}
+
+// Len returns the number of key-value pairs
+func (om *OrderedMap[K, V]) Len() uintptr {
+	om.m.initVersioned()
+	return om.m.Len()
+}
+
+// ForEach iterates over the key-value pairs in insertion order
+// lambda must return `true` to continue iteration and `false` to break iteration
+// the elements are kept in hash order, so they are collected and sorted first, each iteration costs O(n log n)
+func (om *OrderedMap[K, V]) ForEach(lambda func(K, V) bool) {
+	om.m.initVersioned()
+	var (
+		keys    []K
+		entries []orderedEntry[V]
+	)
+	om.m.ForEach(func(key K, entry orderedEntry[V]) bool {
+		keys, entries = append(keys, key), append(entries, entry)
+		return true
+	})
+	sort.Sort(orderedEntries[K, V]{keys, entries})
+	for i := range keys {
+		if !lambda(keys[i], entries[i].value) {
+			return
+		}
+	}
+}
+
+// orderedEntries sorts keys and their entries by insertion sequence number
+type orderedEntries[K comparable, V any] struct {
+	keys    []K
+	entries []orderedEntry[V]
+}
+
+func (o orderedEntries[K, V]) Len() int           { return len(o.keys) }
+func (o orderedEntries[K, V]) Less(i, j int) bool { return o.entries[i].seq < o.entries[j].seq }
+func (o orderedEntries[K, V]) Swap(i, j int) {
+	o.keys[i], o.keys[j] = o.keys[j], o.keys[i]
+	o.entries[i], o.entries[j] = o.entries[j], o.entries[i]
+}
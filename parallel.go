@@ -0,0 +1,61 @@
+package haxmap
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ParallelForEach iterates over the key-value pairs with a pool of goroutines, each of them covering a separate range of hashes
+// lambda is called concurrently and must be safe for concurrent use, workers below 1 use GOMAXPROCS goroutines
+// lambda must return `true` to continue iteration and `false` to stop all workers, pairs being processed by other workers are still completed
+func (m *Map[K, V]) ParallelForEach(workers int, lambda func(K, V) bool) {
+	m.parallel(poolSize(workers), func(_ int, key K, value V) bool {
+		return lambda(key, value)
+	})
+}
+
+// poolSize returns the number of goroutines of a parallel iteration, GOMAXPROCS if workers is below 1
+func poolSize(workers int) int {
+	if workers < 1 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return workers
+}
+
+// parallel iterates over the key-value pairs with the given number of goroutines, lambda also receives the number of the goroutine calling it
+func (m *Map[K, V]) parallel(workers int, lambda func(worker int, key K, value V) bool) {
+	m.init()
+	var (
+		wg      sync.WaitGroup
+		stopped atomicUint32
+		step    = ^uintptr(0) / uintptr(workers)
+	)
+	for i := 0; i < workers; i++ {
+		start, end := uintptr(i)*step, uintptr(i+1)*step-1 // inclusive, so that the last range ends at the largest hash
+		if i == workers-1 {
+			end = ^uintptr(0)
+		}
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			if r := m.reclaimer; r != nil {
+				defer r.exit(r.enter(start))
+			}
+			// start behind the last indexed element before the range, every element of the range follows it in the list
+			item := m.metadata.Load().indexElement(start)
+			if item == nil || item.keyHash > start {
+				item = m.listHead.next()
+			}
+			for ; item != nil && item.keyHash <= end; item = item.next() {
+				if item.keyHash < start || m.expireIfDue(item) {
+					continue
+				}
+				if stopped.Load() != 0 || !lambda(worker, item.key, item.load(m.storage)) {
+					stopped.Store(1)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,46 @@
+package haxmap
+
+// rapidhash secrets
+const (
+	rapidSecret0 uint64 = 0x2d358dccaa6c78a5
+	rapidSecret1 uint64 = 0x8bb84b93962eacc9
+	rapidSecret2 uint64 = 0x4b33a62ed433d4a3
+)
+
+// rapidhash implements https://github.com/Nicoshev/rapidhash, the successor of wyhash
+// it has better throughput than wyhash for medium and long inputs
+func rapidhash(b []byte, seed uint64) uint64 {
+	var (
+		n    = len(b)
+		a, c uint64
+	)
+	seed ^= mix(seed^rapidSecret0, rapidSecret1) ^ uint64(n)
+	switch {
+	case n > 16:
+		p, i := b, n
+		if i > 48 {
+			see1, see2 := seed, seed
+			for ; i >= 48; i, p = i-48, p[48:] {
+				seed = mix(u64(p[0:8])^rapidSecret0, u64(p[8:16])^seed)
+				see1 = mix(u64(p[16:24])^rapidSecret1, u64(p[24:32])^see1)
+				see2 = mix(u64(p[32:40])^rapidSecret2, u64(p[40:48])^see2)
+			}
+			seed ^= see1 ^ see2
+		}
+		if i > 16 {
+			seed = mix(u64(p[0:8])^rapidSecret2, u64(p[8:16])^seed^rapidSecret1)
+			if i > 32 {
+				seed = mix(u64(p[16:24])^rapidSecret2, u64(p[24:32])^seed)
+			}
+		}
+		a, c = u64(b[n-16:n-8]), u64(b[n-8:n])
+	case n >= 4:
+		delta := (n & 24) >> (n >> 3)
+		a = uint64(u32(b[0:4]))<<32 | uint64(u32(b[n-4:n]))
+		c = uint64(u32(b[delta:delta+4]))<<32 | uint64(u32(b[n-4-delta:n-delta]))
+	case n > 0:
+		a = uint64(b[0])<<56 | uint64(b[n>>1])<<32 | uint64(b[n-1])
+	}
+	a, c = mum(a^rapidSecret1, c^seed)
+	return mix(a^rapidSecret0^uint64(n), c^rapidSecret1)
+}
@@ -0,0 +1,228 @@
+package haxmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	// number of reader counters per epoch, concurrent operations spread their updates over them by key hash
+	reclaimStripes = 8
+
+	// minimum number of deleted elements gathered before a reclamation pass walks the list
+	reclaimBatch = 64
+
+	// size of a cache line, counters are padded to it so that stripes do not share one
+	cacheLineSize = 64
+)
+
+type (
+	// paddedCounter is a counter occupying a whole cache line
+	paddedCounter struct {
+		atomicUintptr
+		_ [cacheLineSize - unsafe.Sizeof(uintptr(0))]byte
+	}
+
+	// retiredElement is a deleted element waiting for a grace period to pass
+	retiredElement[K comparable, V any] struct {
+		elem  *element[K, V]
+		epoch uintptr // global epoch at the time the element was retired
+	}
+
+	// reclaimer recycles deleted list elements once no operation can reference them anymore
+	// every map operation pins the global epoch for its duration, the epoch only advances when no operation is pinned to the one before it
+	// so an element retired at epoch e is unreachable for all operations once the epoch reaches e+2
+	// elements go through two grace periods, the first one until no operation can link them into the list or the index again,
+	// the second one after they have been verified to be unlinked, until no operation still holds a pointer to them
+	reclaimer[K comparable, V any] struct {
+		epoch    atomicUintptr
+		active   [2][reclaimStripes]paddedCounter // number of operations pinned to even and odd epochs
+		mu       sync.Mutex                       // guards retired and unlinked
+		retired  []retiredElement[K, V]           // deleted elements which may still be linked
+		unlinked []retiredElement[K, V]           // elements verified to be unlinked from the list and the index
+		pending  atomicUintptr                    // number of elements retired since the last pass
+		passing  atomicUint32                     // a reclamation pass is in progress
+		pool     sync.Pool                        // recycled elements ready for reuse
+		recycled atomicUintptr                    // total number of elements recycled into the pool
+	}
+)
+
+// enter pins the current epoch for an operation and returns the token to pass to exit
+func (r *reclaimer[K, V]) enter(h uintptr) uintptr {
+	stripe := h & (reclaimStripes - 1)
+	for {
+		epoch := r.epoch.Load()
+		counter := &r.active[epoch&1][stripe]
+		counter.Add(1)
+		if r.epoch.Load() == epoch {
+			return (epoch&1)*reclaimStripes + stripe
+		}
+		counter.Add(^uintptr(0)) // the epoch advanced in between, pin the new one
+	}
+}
+
+// exit unpins the epoch pinned by enter
+func (r *reclaimer[K, V]) exit(token uintptr) {
+	r.active[token/reclaimStripes][token%reclaimStripes].Add(^uintptr(0))
+}
+
+// tryAdvance moves the global epoch forward if no operation is pinned to the previous one
+func (r *reclaimer[K, V]) tryAdvance() {
+	epoch := r.epoch.Load()
+	previous := &r.active[(epoch+1)&1]
+	for i := range previous {
+		if previous[i].Load() != 0 {
+			return
+		}
+	}
+	r.epoch.CompareAndSwap(epoch, epoch+1)
+}
+
+// retire queues an element which was just marked as deleted for recycling
+func (r *reclaimer[K, V]) retire(m *Map[K, V], elem *element[K, V]) {
+	r.mu.Lock()
+	r.retired = append(r.retired, retiredElement[K, V]{elem: elem, epoch: r.epoch.Load()})
+	r.mu.Unlock()
+
+	// amortize the list walk of a pass over a number of deletions proportional to the map size
+	if pending := r.pending.Add(1); pending >= reclaimBatch && pending >= m.Len()/4 && r.passing.CompareAndSwap(0, 1) {
+		r.pending.Store(0)
+		r.reclaim(m)
+		r.passing.Store(0)
+	}
+}
+
+// get returns a recycled element if one is available
+func (r *reclaimer[K, V]) get() *element[K, V] {
+	if elem, ok := r.pool.Get().(*element[K, V]); ok {
+		return elem
+	}
+	return nil
+}
+
+// reclaim runs a reclamation pass
+// retired elements past their first grace period are checked against the list and the index and move on to the unlinked stage,
+// unlinked elements past their second grace period are reset and put into the pool
+func (r *reclaimer[K, V]) reclaim(m *Map[K, V]) {
+	r.tryAdvance()
+	epoch := r.epoch.Load()
+
+	r.mu.Lock()
+	var candidates []retiredElement[K, V]
+	r.retired, candidates = splitRipe(r.retired, epoch)
+	unlinked, ripe := splitRipe(r.unlinked, epoch)
+	r.unlinked = unlinked
+	r.mu.Unlock()
+
+	for _, item := range ripe {
+		item.elem.reset(m.storage)
+		r.pool.Put(item.elem)
+	}
+	r.recycled.Add(uintptr(len(ripe)))
+	if len(candidates) == 0 {
+		return
+	}
+
+	token := r.enter(0)
+	defer r.exit(token)
+
+	// traversing the list unlinks deleted elements as a side effect, then the raw links are checked for any still reachable ones
+	for item := m.listHead; item != nil; item = item.next() {
+	}
+	linked := make(map[*element[K, V]]struct{}, len(candidates))
+	for _, item := range candidates {
+		linked[item.elem] = struct{}{}
+	}
+	reachable := make(map[*element[K, V]]struct{})
+	for item := m.listHead.nextPtr.Load(); item != nil; item = item.nextPtr.Load() {
+		if _, ok := linked[item]; ok {
+			reachable[item] = struct{}{}
+		}
+	}
+	// index slots may still point to deleted elements which are no longer linked but whose links lead to candidates,
+	// the index of a pending incremental resize is filled over many operations and may refer to them as well
+	indexes := []*metadata[K, V]{m.metadata.Load()}
+	if state := m.rehash.Load(); state != nil {
+		indexes = append(indexes, state.data)
+	}
+	for _, data := range indexes {
+		for i := range data.index {
+			ptr := (*unsafe.Pointer)(unsafe.Pointer(uintptr(data.data) + uintptr(i)*intSizeBytes))
+			for item := (*element[K, V])(atomic.LoadPointer(ptr)); item != nil && item.isDeleted(); item = item.nextPtr.Load() {
+				if _, ok := linked[item]; ok {
+					reachable[item] = struct{}{}
+				}
+			}
+		}
+	}
+
+	var (
+		keep  []retiredElement[K, V]
+		ready []retiredElement[K, V]
+		now   = r.epoch.Load()
+	)
+	for _, item := range candidates {
+		if _, ok := reachable[item.elem]; ok {
+			keep = append(keep, item)
+			continue
+		}
+		// a stale index slot still pointing to the element is cleared and handed to the first element of its bucket,
+		// the element is checked again after another grace period
+		stale := false
+		for _, data := range indexes {
+			if m.clearStaleSlot(data, item.elem) {
+				stale = true
+			}
+		}
+		if stale {
+			keep = append(keep, retiredElement[K, V]{elem: item.elem, epoch: now})
+			continue
+		}
+		ready = append(ready, retiredElement[K, V]{elem: item.elem, epoch: now})
+	}
+
+	r.mu.Lock()
+	r.retired = append(r.retired, keep...)
+	r.unlinked = append(r.unlinked, ready...)
+	r.mu.Unlock()
+}
+
+// clearStaleSlot clears the slot of the index if it still points to the unlinked element and reports whether it did
+// the slot is handed to the first element of its bucket
+func (m *Map[K, V]) clearStaleSlot(data *metadata[K, V], elem *element[K, V]) bool {
+	index := data.position(elem.keyHash)
+	ptr := (*unsafe.Pointer)(unsafe.Pointer(uintptr(data.data) + index*intSizeBytes))
+	if atomic.LoadPointer(ptr) != unsafe.Pointer(elem) {
+		return false
+	}
+	if atomic.CompareAndSwapPointer(ptr, unsafe.Pointer(elem), nil) {
+		data.count.Add(^uintptr(0))
+		// elements inserted into the bucket from now on index themselves, look for the ones inserted before
+		first := data.indexElement(elem.keyHash)
+		if first == nil || first.keyHash > elem.keyHash {
+			first = m.listHead
+		}
+		for first != nil && data.position(first.keyHash) <= index {
+			if first != m.listHead && data.position(first.keyHash) == index {
+				data.addItemToIndex(first)
+				break
+			}
+			first = first.next()
+		}
+	}
+	return true
+}
+
+// splitRipe separates the elements whose grace period has passed at the given epoch from the rest
+func splitRipe[K comparable, V any](items []retiredElement[K, V], epoch uintptr) (pending, ripe []retiredElement[K, V]) {
+	pending = items[:0]
+	for _, item := range items {
+		if epoch-item.epoch >= 2 {
+			ripe = append(ripe, item)
+		} else {
+			pending = append(pending, item)
+		}
+	}
+	return
+}
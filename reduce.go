@@ -0,0 +1,49 @@
+package haxmap
+
+// Reduce folds the key-value pairs of the map into an accumulator starting from init
+// pairs added or removed during the call may or may not be folded
+func Reduce[K comparable, V, A any](m *Map[K, V], init A, fn func(acc A, key K, value V) A) A {
+	acc := init
+	m.ForEach(func(key K, value V) bool {
+		acc = fn(acc, key, value)
+		return true
+	})
+	return acc
+}
+
+// ParallelReduce is like Reduce with a pool of goroutines, each of them folding a separate range of hashes into its own accumulator
+// every accumulator starts from init, which must therefore be neutral for merge, and the accumulators are combined with merge once all goroutines finished
+// fn is called concurrently but never for the same accumulator, workers below 1 use GOMAXPROCS goroutines
+func ParallelReduce[K comparable, V, A any](m *Map[K, V], workers int, init A, fn func(acc A, key K, value V) A, merge func(a, b A) A) A {
+	workers = poolSize(workers)
+	accs := make([]A, workers)
+	for i := range accs {
+		accs[i] = init
+	}
+	m.parallel(workers, func(worker int, key K, value V) bool {
+		accs[worker] = fn(accs[worker], key, value)
+		return true
+	})
+	acc := accs[0]
+	for _, other := range accs[1:] {
+		acc = merge(acc, other)
+	}
+	return acc
+}
+
+// Count returns the number of key-value pairs for which pred holds
+func Count[K comparable, V any](m *Map[K, V], pred func(key K, value V) bool) int {
+	return Reduce(m, 0, func(n int, key K, value V) int {
+		if pred(key, value) {
+			n++
+		}
+		return n
+	})
+}
+
+// Sum returns the sum of the values of the map
+func Sum[K comparable, V Number](m *Map[K, V]) V {
+	return Reduce(m, 0, func(sum V, _ K, value V) V {
+		return sum + value
+	})
+}
@@ -0,0 +1,57 @@
+package haxmap
+
+// GetRef returns a pointer to the value stored for the key, so that large values can be modified in place instead of being copied out and set again
+// the pointer aliases the storage of the map, which comes with a few rules
+//   - modifications through the pointer are not synchronized, goroutines reading or modifying the same value must coordinate on their own,
+//     example with a mutex or atomic fields within the value, this includes Get, ForEach and every other operation copying the value out
+//   - storing a new value for the key, with Set or any other update, replaces the storage, the pointer keeps referring to the previous value
+//     and modifications through it are not visible in the map anymore
+//   - the pointer must not be used once the key was deleted
+//   - modifications through the pointer are invisible to hooks, watchers and snapshots
+//
+// returns `false` if the key is absent
+// It panics on maps whose values are not held behind a pointer of their own, values of at most a machine word without pointers are stored inline
+// in the elements and maps created with WithVersions hand the same value records to all readers
+func (m *Map[K, V]) GetRef(key K) (ref *V, ok bool) {
+	m.init()
+	switch m.storage {
+	case inlineValues:
+		panic("haxmap: GetRef called on a map storing its values inline")
+	case versionedValues:
+		panic("haxmap: GetRef called on a map created with WithVersions")
+	}
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	if m.sketch != nil {
+		m.sketch.increment(h)
+	}
+	elem := m.metadata.Load().indexElement(h)
+	if elem == nil || elem.keyHash > h {
+		elem = m.listHead.nextPtr.Load()
+	}
+	for ; elem != nil && elem.keyHash <= h; elem = elem.nextPtr.Load() {
+		if elem.keyHash == h && keyEquals(m.equal, elem.key, key) {
+			if elem.isDeleted() {
+				continue
+			}
+			if m.expireIfDue(elem) {
+				break
+			} else if m.capacity != 0 {
+				elem.touch()
+			}
+			if m.storage == noValues {
+				ref = new(V) // zero-size values have no storage to refer to
+			} else {
+				ref = elem.pointer().Load()
+			}
+			ok = true
+			break
+		}
+	}
+	if m.metrics != nil {
+		m.metrics.Get(ok)
+	}
+	return
+}
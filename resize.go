@@ -0,0 +1,128 @@
+package haxmap
+
+import (
+	"runtime"
+	"time"
+)
+
+// number of elements a write operation indexes while an incremental resize is in progress
+const rehashStep = 64
+
+// rehashState is a larger index being filled in steps alongside regular operations
+// its progress is only accessed by the operation holding the stepping flag of the map,
+// deletions and the reclaimer clear slots of the index like they do in the current one
+type rehashState[K comparable, V any] struct {
+	data      *metadata[K, V]
+	started   bool      // at least one element has been indexed
+	position  uintptr   // hash of the last element indexed
+	lastIndex uintptr   // index slot of the last element indexed
+	migrated  int       // number of elements indexed
+	start     time.Time // time the resize was started
+}
+
+// Rehash rebuilds the index at the given size rounded up to the next power of 2, the index may also shrink
+// a size of 0 picks the smallest size keeping the fill rate below its maximum
+// unlike Grow it waits for a resize in progress to finish instead of skipping, so resizes can be scheduled at a convenient time
+func (m *Map[K, V]) Rehash(newSize uintptr) {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	if newSize == 0 {
+		newSize = m.fittingSize()
+	}
+	for {
+		if m.incremental {
+			m.finishRehash()
+		}
+		if m.resizing.CompareAndSwap(notResizing, resizingInProgress) {
+			break
+		}
+		runtime.Gosched()
+	}
+	m.grow(newSize)
+}
+
+// fittingSize returns the smallest index size keeping the fill rate of the current elements below its maximum
+func (m *Map[K, V]) fittingSize() uintptr {
+	newSize := m.defaultSize
+	if needed := m.Len()*100/m.maxFillRate + 1; needed > newSize {
+		newSize = needed
+	}
+	return newSize
+}
+
+// startRehash prepares a larger index to be filled by subsequent write operations, the resizing flag must be held
+func (m *Map[K, V]) startRehash(newSize uintptr) {
+	if newSize == 0 {
+		newSize = m.nextSize(uintptr(len(m.metadata.Load().index)))
+	} else {
+		newSize = roundUpPower2(newSize)
+	}
+	m.rehash.Store(&rehashState[K, V]{data: newMetadata[K, V](newSize), start: time.Now()})
+}
+
+// stepRehash indexes the next batch of elements into the pending index and publishes it once all elements are indexed
+// it returns false if there is no pending index or another operation is already working on it
+func (m *Map[K, V]) stepRehash() bool {
+	state := m.rehash.Load()
+	if state == nil || !m.stepping.CompareAndSwap(0, 1) {
+		return false
+	}
+	defer m.stepping.Store(0)
+	if m.rehash.Load() != state {
+		return false // published or cancelled in the meantime
+	}
+
+	// resume after the last indexed element, looking it up through the current index
+	item := m.listHead.next()
+	if state.started {
+		if start := m.metadata.Load().indexElement(state.position); start != nil && start.keyHash <= state.position {
+			item = start
+		}
+		for item != nil && item.keyHash <= state.position {
+			item = item.next()
+		}
+	}
+	for n := 0; item != nil && n < rehashStep; n++ {
+		index := state.data.position(item.keyHash)
+		if !state.started || index != state.lastIndex {
+			state.data.addItemToIndex(item)
+			state.lastIndex = index
+		}
+		state.started, state.position = true, item.keyHash
+		state.migrated++
+		item = item.next()
+	}
+	if item != nil {
+		return true
+	}
+
+	// all elements are indexed, elements inserted behind the position in the meantime are found by walking from their predecessors
+	if !m.rehash.CompareAndSwap(state, nil) {
+		return false
+	}
+	old := m.metadata.Swap(state.data)
+	m.resizes.Add(1)
+	if m.metrics != nil {
+		m.metrics.Resize(uintptr(len(old.index)), uintptr(len(state.data.index)))
+	}
+	if m.onResize != nil {
+		m.onResize(uintptr(len(old.index)), uintptr(len(state.data.index)), state.migrated, time.Since(state.start))
+	}
+	if m.resizeNeeded(uintptr(len(state.data.index)), m.Len()) {
+		m.startRehash(0)
+	} else {
+		m.resizing.Store(notResizing)
+	}
+	return true
+}
+
+// finishRehash completes a pending incremental resize in the calling goroutine
+func (m *Map[K, V]) finishRehash() {
+	for m.rehash.Load() != nil {
+		if !m.stepRehash() {
+			runtime.Gosched() // another operation is working on the current step
+		}
+	}
+}
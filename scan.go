@@ -0,0 +1,46 @@
+package haxmap
+
+type (
+	// Cursor is the position of a paginated iteration with Scan, it can be stored and passed between processes
+	// the zero cursor starts an iteration and Scan returns it once the iteration is complete
+	Cursor uint64
+
+	// Pair is a key-value pair returned by Scan
+	Pair[K comparable, V any] struct {
+		Key   K
+		Value V
+	}
+)
+
+// Scan returns the next page of at least limit key-value pairs starting at the cursor, along with the cursor of the following page
+// pages never stop inside a run of keys sharing a hash, so they may be slightly larger than limit
+// the cursor is the hash the next page starts at, elements are ordered by hash and never move, so no iterator has to be kept open between calls:
+// every element present during the whole iteration is returned exactly once, elements added or removed meanwhile may or may not be returned
+func (m *Map[K, V]) Scan(cursor Cursor, limit int) ([]Pair[K, V], Cursor) {
+	m.init()
+	if limit < 1 {
+		limit = 1
+	}
+	start := uintptr(cursor)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(start))
+	}
+	item := m.metadata.Load().indexElement(start)
+	if item == nil || item.keyHash > start {
+		item = m.listHead.next()
+	}
+	var (
+		pairs    = make([]Pair[K, V], 0, limit)
+		lastHash uintptr
+	)
+	for ; item != nil; item = item.next() {
+		if item.keyHash < start || m.expireIfDue(item) {
+			continue
+		}
+		if len(pairs) >= limit && item.keyHash != lastHash {
+			return pairs, Cursor(item.keyHash)
+		}
+		pairs, lastHash = append(pairs, Pair[K, V]{Key: item.key, Value: item.load(m.storage)}), item.keyHash
+	}
+	return pairs, 0
+}
@@ -0,0 +1,117 @@
+package haxmap
+
+// Set is a concurrent set of keys built on the same lock-free list and index as Map
+// the empty values take no space in the elements, so keys cost no allocation beyond their element
+// the zero value is an empty set ready to use with the default settings
+type Set[K comparable] struct {
+	m Map[K, struct{}]
+}
+
+// NewSet returns a new set with an optional specific initialization size
+// It panics if the key type has no default hasher, use NewSetWithOptions with WithHasher to provide one
+func NewSet[K comparable](size ...uintptr) *Set[K] {
+	var cfg config
+	if len(size) > 0 {
+		cfg.size = size[0]
+	}
+	return newSet[K](&cfg)
+}
+
+// NewSetWithOptions returns a new set configured with the given options, options concerning values do not apply to sets
+// It panics if the configuration is invalid
+func NewSetWithOptions[K comparable](opts ...Option) *Set[K] {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return newSet[K](&cfg)
+}
+
+// newSet allocates a set and applies the given configuration to it
+func newSet[K comparable](cfg *config) *Set[K] {
+	s := &Set[K]{}
+	if err := s.m.configure(cfg); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Add adds the key to the set and reports whether it was missing
+func (s *Set[K]) Add(key K) bool {
+	_, loaded := s.m.GetOrSet(key, struct{}{})
+	return !loaded
+}
+
+// Has reports whether the key is in the set
+func (s *Set[K]) Has(key K) bool {
+	_, ok := s.m.Get(key)
+	return ok
+}
+
+// Remove removes the key from the set and reports whether it was present
+func (s *Set[K]) Remove(key K) bool {
+	_, ok := s.m.GetAndDel(key)
+	return ok
+}
+
+// Len returns the number of keys in the set
+func (s *Set[K]) Len() uintptr {
+	return s.m.Len()
+}
+
+// ForEach iterates over the keys of the set
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (s *Set[K]) ForEach(lambda func(K) bool) {
+	s.m.ForEach(func(key K, _ struct{}) bool {
+		return lambda(key)
+	})
+}
+
+// Union returns a new set of the keys which are in either set
+func (s *Set[K]) Union(other *Set[K]) *Set[K] {
+	result := s.empty(s.Len() + other.Len())
+	s.ForEach(func(key K) bool {
+		result.Add(key)
+		return true
+	})
+	other.ForEach(func(key K) bool {
+		result.Add(key)
+		return true
+	})
+	return result
+}
+
+// Intersect returns a new set of the keys which are in both sets
+func (s *Set[K]) Intersect(other *Set[K]) *Set[K] {
+	small, large := s, other
+	if small.Len() > large.Len() {
+		small, large = large, small
+	}
+	result := s.empty(small.Len())
+	small.ForEach(func(key K) bool {
+		if large.Has(key) {
+			result.Add(key)
+		}
+		return true
+	})
+	return result
+}
+
+// Difference returns a new set of the keys which are in this set but not in the other one
+func (s *Set[K]) Difference(other *Set[K]) *Set[K] {
+	result := s.empty(s.Len())
+	s.ForEach(func(key K) bool {
+		if !other.Has(key) {
+			result.Add(key)
+		}
+		return true
+	})
+	return result
+}
+
+// empty returns a new set hashing and comparing keys like this one, with an index sized for the given number of keys
+func (s *Set[K]) empty(hint uintptr) *Set[K] {
+	result := &Set[K]{}
+	result.m.configureLike(&s.m, hint)
+	return result
+}
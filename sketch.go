@@ -0,0 +1,91 @@
+package haxmap
+
+import "sync/atomic"
+
+const (
+	// number of rows of the frequency sketch, each row counts with an independent hash
+	sketchDepth = 4
+
+	// number of 4 bit counters packed into a word of the frequency sketch
+	countersPerWord = 16
+
+	// number of recorded accesses per element of the capacity after which all counters are halved
+	sketchSampleFactor = 10
+)
+
+// frequencySketch is a count-min sketch with 4 bit counters estimating how often keys were accessed recently
+// counters are halved periodically so that the estimates follow changes in popularity
+// the sketch works on the key hashes of the map, so keys are never hashed a second time
+type frequencySketch struct {
+	table      []uint64
+	rowWords   uintptr // words per row
+	mask       uintptr // counters per row minus 1
+	additions  atomicUintptr
+	sampleSize uintptr
+	resetting  atomicUint32
+}
+
+// newFrequencySketch returns a sketch sized for a map holding capacity elements
+func newFrequencySketch(capacity uintptr) *frequencySketch {
+	// a word per element and row keeps collisions rare while the counters are halved every sampleSize accesses
+	rowWords := roundUpPower2(capacity)
+	return &frequencySketch{
+		table:      make([]uint64, sketchDepth*rowWords),
+		rowWords:   rowWords,
+		mask:       rowWords*countersPerWord - 1,
+		sampleSize: sketchSampleFactor * rowWords,
+	}
+}
+
+// counter returns the word and the bit offset of the counter of the hash in the given row
+func (s *frequencySketch) counter(h uintptr, row uintptr) (*uint64, uint64) {
+	// spread the hash differently for every row
+	x := uint64(h) + uint64(row)*0x9e3779b97f4a7c15
+	x ^= x >> 32
+	x *= 0xd6e8feb86659fd93
+	x ^= x >> 32
+	slot := uintptr(x) & s.mask
+	return &s.table[row*s.rowWords+slot/countersPerWord], uint64(slot%countersPerWord) * 4
+}
+
+// increment records an access of the hash, counters saturate at 15
+func (s *frequencySketch) increment(h uintptr) {
+	for row := uintptr(0); row < sketchDepth; row++ {
+		word, shift := s.counter(h, row)
+		for {
+			old := atomic.LoadUint64(word)
+			if (old>>shift)&0xf == 0xf || atomic.CompareAndSwapUint64(word, old, old+1<<shift) {
+				break
+			}
+		}
+	}
+	if s.additions.Add(1) >= s.sampleSize && s.resetting.CompareAndSwap(0, 1) {
+		s.reset()
+		s.resetting.Store(0)
+	}
+}
+
+// frequency returns the estimated number of recent accesses of the hash
+func (s *frequencySketch) frequency(h uintptr) uint64 {
+	min := uint64(0xf)
+	for row := uintptr(0); row < sketchDepth; row++ {
+		word, shift := s.counter(h, row)
+		if count := (atomic.LoadUint64(word) >> shift) & 0xf; count < min {
+			min = count
+		}
+	}
+	return min
+}
+
+// reset halves all counters
+func (s *frequencySketch) reset() {
+	for i := range s.table {
+		for {
+			old := atomic.LoadUint64(&s.table[i])
+			if atomic.CompareAndSwapUint64(&s.table[i], old, (old>>1)&0x7777777777777777) {
+				break
+			}
+		}
+	}
+	s.additions.Store(0)
+}
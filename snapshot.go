@@ -0,0 +1,357 @@
+package haxmap
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// snapshotMagic starts every snapshot, the last byte is the format version
+const snapshotMagic = "haxmap\x01"
+
+// ErrInvalidSnapshot is returned by ReadFrom when the data is not a snapshot written by WriteTo or is truncated
+var ErrInvalidSnapshot = errors.New("haxmap: invalid snapshot")
+
+type (
+	// snapshotCodec converts values of one type to and from their snapshot encoding
+	snapshotCodec struct {
+		encode func(buf []byte, p unsafe.Pointer) ([]byte, error)
+		decode func(data []byte, p unsafe.Pointer) error
+	}
+
+	// snapshotReader reads a snapshot counting the bytes consumed
+	snapshotReader struct {
+		r   io.Reader
+		br  io.ByteReader
+		n   int64
+		buf []byte
+	}
+
+	// countingWriter counts the bytes written to the underlying writer
+	countingWriter struct {
+		w io.Writer
+		n int64
+	}
+)
+
+// WriteTo implements the io.WriterTo interface.
+// It writes a compact binary snapshot of the map which ReadFrom restores, keys and values are converted without reflection
+// supported types are strings, byte slices, booleans, integers, floats and types implementing both encoding.BinaryMarshaler and encoding.BinaryUnmarshaler
+// the snapshot starts with the number of elements so that a restored map can be sized up front, followed by the length prefixed key and value of every element
+// and the number of elements actually written, which differs from the first one if the map is modified or elements expire meanwhile
+func (m *Map[K, V]) WriteTo(w io.Writer) (int64, error) {
+	m.init()
+	keyCodec, err := newSnapshotCodec[K]()
+	if err != nil {
+		return 0, err
+	}
+	valueCodec, err := newSnapshotCodec[V]()
+	if err != nil {
+		return 0, err
+	}
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+
+	var (
+		cw    = &countingWriter{w: w}
+		bw    = bufio.NewWriter(cw)
+		buf   = appendUvarint([]byte(snapshotMagic), uint64(m.Len()))
+		data  []byte
+		count uint64
+	)
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		if m.expireIfDue(item) {
+			continue
+		}
+		key, value := item.key, item.load(m.storage)
+		if data, err = keyCodec.encode(data[:0], unsafe.Pointer(&key)); err != nil {
+			return cw.n, err
+		}
+		// key lengths are stored plus one, a zero terminates the snapshot
+		buf = append(appendUvarint(buf, uint64(len(data))+1), data...)
+		if data, err = valueCodec.encode(data[:0], unsafe.Pointer(&value)); err != nil {
+			return cw.n, err
+		}
+		buf = append(appendUvarint(buf, uint64(len(data))), data...)
+		if _, err := bw.Write(buf); err != nil {
+			return cw.n, err
+		}
+		buf = buf[:0]
+		count++
+	}
+	if _, err := bw.Write(appendUvarint(append(buf, 0), count)); err != nil {
+		return cw.n, err
+	}
+	err = bw.Flush()
+	return cw.n, err
+}
+
+// ReadFrom implements the io.ReaderFrom interface.
+// It adds the elements of a snapshot written by WriteTo to the map, which is sized up front for up to maxSizeHint of them
+// r is buffered if it does not implement io.ByteReader, so it may be read past the end of the snapshot
+func (m *Map[K, V]) ReadFrom(r io.Reader) (int64, error) {
+	m.init()
+	keyCodec, err := newSnapshotCodec[K]()
+	if err != nil {
+		return 0, err
+	}
+	valueCodec, err := newSnapshotCodec[V]()
+	if err != nil {
+		return 0, err
+	}
+
+	sr := &snapshotReader{r: r}
+	if br, ok := r.(io.ByteReader); ok {
+		sr.br = br
+	} else {
+		b := bufio.NewReader(r)
+		sr.r, sr.br = b, b
+	}
+	magic, err := sr.read(uint64(len(snapshotMagic)))
+	if err != nil {
+		return sr.n, err
+	}
+	if string(magic) != snapshotMagic {
+		return sr.n, fmt.Errorf("%w: unknown header", ErrInvalidSnapshot)
+	}
+	size, err := sr.uvarint()
+	if err != nil {
+		return sr.n, err
+	}
+	m.Reserve(sizeHint(size))
+	for count := uint64(0); ; count++ {
+		var (
+			key   K
+			value V
+		)
+		length, err := sr.uvarint()
+		if err != nil {
+			return sr.n, err
+		}
+		if length == 0 {
+			written, err := sr.uvarint()
+			if err == nil && written != count {
+				err = fmt.Errorf("%w: %d elements read, %d written", ErrInvalidSnapshot, count, written)
+			}
+			return sr.n, err
+		}
+		data, err := sr.read(length - 1)
+		if err != nil {
+			return sr.n, err
+		}
+		if err := keyCodec.decode(data, unsafe.Pointer(&key)); err != nil {
+			return sr.n, err
+		}
+		if length, err = sr.uvarint(); err != nil {
+			return sr.n, err
+		}
+		if data, err = sr.read(length); err != nil {
+			return sr.n, err
+		}
+		if err := valueCodec.decode(data, unsafe.Pointer(&value)); err != nil {
+			return sr.n, err
+		}
+		m.Set(key, value)
+	}
+}
+
+// ReadByte implements io.ByteReader
+func (s *snapshotReader) ReadByte() (byte, error) {
+	b, err := s.br.ReadByte()
+	if err == nil {
+		s.n++
+	}
+	return b, err
+}
+
+// uvarint reads a varint encoded length or count
+func (s *snapshotReader) uvarint() (uint64, error) {
+	x, err := binary.ReadUvarint(s)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSnapshot, io.ErrUnexpectedEOF)
+	} else if err != nil {
+		return 0, err
+	}
+	if x > math.MaxInt32 {
+		return 0, fmt.Errorf("%w: length %d out of range", ErrInvalidSnapshot, x)
+	}
+	return x, nil
+}
+
+// read reads the next n bytes into a buffer which is reused by the following read
+func (s *snapshotReader) read(n uint64) ([]byte, error) {
+	if uint64(cap(s.buf)) < n {
+		s.buf = make([]byte, n)
+	}
+	read, err := io.ReadFull(s.r, s.buf[:n])
+	s.n += int64(read)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, io.ErrUnexpectedEOF)
+	}
+	return s.buf[:n], err
+}
+
+// Write implements io.Writer
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// newSnapshotCodec picks the snapshot encoding of T once, so that the elements are converted without reflection
+func newSnapshotCodec[T any]() (snapshotCodec, error) {
+	_, marshaler := any(new(T)).(encoding.BinaryMarshaler)
+	_, unmarshaler := any(new(T)).(encoding.BinaryUnmarshaler)
+	if marshaler && unmarshaler {
+		return snapshotCodec{
+			encode: func(buf []byte, p unsafe.Pointer) ([]byte, error) {
+				data, err := any((*T)(p)).(encoding.BinaryMarshaler).MarshalBinary()
+				return append(buf, data...), err
+			},
+			decode: func(data []byte, p unsafe.Pointer) error {
+				return any((*T)(p)).(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+			},
+		}, nil
+	}
+
+	t := typeOf[T]()
+	malformed := fmt.Errorf("%w: malformed %v", ErrInvalidSnapshot, t)
+	switch t.Kind() {
+	case reflect.String:
+		return snapshotCodec{
+			encode: func(buf []byte, p unsafe.Pointer) ([]byte, error) {
+				return append(buf, *(*string)(p)...), nil
+			},
+			decode: func(data []byte, p unsafe.Pointer) error {
+				*(*string)(p) = string(data)
+				return nil
+			},
+		}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		return snapshotCodec{
+			encode: func(buf []byte, p unsafe.Pointer) ([]byte, error) {
+				return append(buf, *(*[]byte)(p)...), nil
+			},
+			decode: func(data []byte, p unsafe.Pointer) error {
+				*(*[]byte)(p) = append([]byte(nil), data...)
+				return nil
+			},
+		}, nil
+	case reflect.Bool, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		size, max := t.Size(), uint64(math.MaxUint64)>>(64-8*t.Size())
+		if t.Kind() == reflect.Bool {
+			max = 1
+		}
+		return snapshotCodec{
+			encode: func(buf []byte, p unsafe.Pointer) ([]byte, error) {
+				return appendUvarint(buf, loadUint(p, size)), nil
+			},
+			decode: func(data []byte, p unsafe.Pointer) error {
+				x, n := binary.Uvarint(data)
+				if n != len(data) || x > max {
+					return malformed
+				}
+				storeUint(p, size, x)
+				return nil
+			},
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size, max := t.Size(), int64(math.MaxInt64>>(64-8*t.Size()))
+		return snapshotCodec{
+			encode: func(buf []byte, p unsafe.Pointer) ([]byte, error) {
+				return appendVarint(buf, loadInt(p, size)), nil
+			},
+			decode: func(data []byte, p unsafe.Pointer) error {
+				x, n := binary.Varint(data)
+				if n != len(data) || x > max || x < -max-1 {
+					return malformed
+				}
+				storeUint(p, size, uint64(x))
+				return nil
+			},
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		size := t.Size()
+		return snapshotCodec{
+			encode: func(buf []byte, p unsafe.Pointer) ([]byte, error) {
+				var b [8]byte
+				binary.LittleEndian.PutUint64(b[:], loadUint(p, size))
+				return append(buf, b[:size]...), nil
+			},
+			decode: func(data []byte, p unsafe.Pointer) error {
+				if uintptr(len(data)) != size {
+					return malformed
+				}
+				var b [8]byte
+				copy(b[:], data)
+				storeUint(p, size, binary.LittleEndian.Uint64(b[:]))
+				return nil
+			},
+		}, nil
+	}
+	return snapshotCodec{}, fmt.Errorf("haxmap: type %v is not supported by snapshots, it must implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler", t)
+}
+
+// appendUvarint appends the varint encoding of x
+func appendUvarint(buf []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], x)]...)
+}
+
+// appendVarint appends the zigzag varint encoding of x
+func appendVarint(buf []byte, x int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], x)]...)
+}
+
+// loadUint reads an unsigned integer of the given size in bytes
+func loadUint(p unsafe.Pointer, size uintptr) uint64 {
+	switch size {
+	case 1:
+		return uint64(*(*uint8)(p))
+	case 2:
+		return uint64(*(*uint16)(p))
+	case 4:
+		return uint64(*(*uint32)(p))
+	default:
+		return *(*uint64)(p)
+	}
+}
+
+// loadInt reads a signed integer of the given size in bytes
+func loadInt(p unsafe.Pointer, size uintptr) int64 {
+	switch size {
+	case 1:
+		return int64(*(*int8)(p))
+	case 2:
+		return int64(*(*int16)(p))
+	case 4:
+		return int64(*(*int32)(p))
+	default:
+		return *(*int64)(p)
+	}
+}
+
+// storeUint writes the low bytes of x as an integer of the given size in bytes
+func storeUint(p unsafe.Pointer, size uintptr, x uint64) {
+	switch size {
+	case 1:
+		*(*uint8)(p) = uint8(x)
+	case 2:
+		*(*uint16)(p) = uint16(x)
+	case 4:
+		*(*uint32)(p) = uint32(x)
+	default:
+		*(*uint64)(p) = x
+	}
+}
@@ -0,0 +1,186 @@
+package haxmap
+
+import (
+	"strconv"
+	"unsafe"
+)
+
+// number of bins in the hash distribution histogram
+const histogramBins = 16
+
+// HashStats describes how evenly the hash function spreads the keys of a map
+type HashStats struct {
+	// Buckets is the size of the map index
+	Buckets uintptr
+	// UsedBuckets is the number of index buckets holding at least one element
+	UsedBuckets uintptr
+	// MaxChainLength is the largest number of elements sharing an index bucket
+	MaxChainLength uintptr
+	// MeanChainLength is the average number of elements in the used buckets
+	MeanChainLength float64
+	// MaxProbeDistance is the largest number of empty buckets a lookup has to step back over to find its starting element
+	MaxProbeDistance uintptr
+	// Collisions is the number of elements whose full hash is the same as that of the element before them
+	Collisions uintptr
+	// Histogram counts the elements falling into each 1/16th of the hash space
+	Histogram [histogramBins]uintptr
+}
+
+// HashStats computes the hash diagnostics of the map
+// the stats are gathered on demand by walking all elements so regular map operations carry no tracking overhead
+// a custom hasher returning poorly distributed values shows up as long chains, high probe distances or a skewed histogram
+func (m *Map[K, V]) HashStats() HashStats {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	var (
+		data       = m.metadata.Load()
+		stats      = HashStats{Buckets: uintptr(len(data.index))}
+		chain      uintptr
+		lastBucket uintptr
+		first      = true
+		prev       *element[K, V]
+	)
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		bucket := data.position(item.keyHash)
+		stats.Histogram[item.keyHash>>(strconv.IntSize-4)]++
+		if prev != nil && prev.keyHash == item.keyHash {
+			stats.Collisions++
+		}
+		prev = item
+
+		if !first && bucket == lastBucket {
+			chain++
+			continue
+		}
+		// a new bucket starts, every empty bucket in between steps back to the last used one
+		if first {
+			stats.MaxProbeDistance = bucket
+		} else if gap := bucket - lastBucket - 1; gap > stats.MaxProbeDistance {
+			stats.MaxProbeDistance = gap
+		}
+		if chain > stats.MaxChainLength {
+			stats.MaxChainLength = chain
+		}
+		stats.UsedBuckets++
+		first, lastBucket, chain = false, bucket, 1
+	}
+	if chain > stats.MaxChainLength {
+		stats.MaxChainLength = chain
+	}
+	if !first {
+		if gap := stats.Buckets - lastBucket - 1; gap > stats.MaxProbeDistance {
+			stats.MaxProbeDistance = gap
+		}
+	}
+
+	var total uintptr
+	for _, n := range stats.Histogram {
+		total += n
+	}
+	if stats.UsedBuckets > 0 {
+		stats.MeanChainLength = float64(total) / float64(stats.UsedBuckets)
+	}
+	return stats
+}
+
+// MemStats describes the memory held by a map
+type MemStats struct {
+	// IndexSize is the number of buckets in the map index
+	IndexSize uintptr
+	// Nodes is the number of list elements including the ones awaiting unlinking
+	Nodes uintptr
+	// DeletedNodes is the number of list elements which are logically deleted but still linked, Compact unlinks them
+	DeletedNodes uintptr
+	// ReservedNodes is the number of preallocated elements not yet in use
+	ReservedNodes uintptr
+	// EstimatedBytes is the approximate memory held by the index, the elements and their values
+	// memory referenced from within keys and values such as string contents is not accounted for
+	EstimatedBytes uintptr
+}
+
+// MemStats estimates the memory footprint of the map by walking all its elements
+func (m *Map[K, V]) MemStats() MemStats {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	var (
+		data  = m.metadata.Load()
+		stats = MemStats{IndexSize: uintptr(len(data.index))}
+	)
+	// walk the raw links so that elements marked for deletion are neither skipped nor unlinked
+	for item := m.listHead.nextPtr.Load(); item != nil; item = item.nextPtr.Load() {
+		stats.Nodes++
+		if item.isDeleted() {
+			stats.DeletedNodes++
+		}
+	}
+	if slab := m.slab.Load(); slab != nil {
+		if used := slab.next.Load(); used < slab.len {
+			stats.ReservedNodes = slab.len - used
+		}
+	}
+	var (
+		elemSize  = elementSize[K, V](m.storage)
+		valueSize = unsafe.Sizeof(*new(V))
+	)
+	stats.EstimatedBytes = stats.IndexSize*unsafe.Sizeof(uintptr(0)) + (stats.Nodes+stats.ReservedNodes)*elemSize
+	switch m.storage {
+	case pointerValues:
+		stats.EstimatedBytes += stats.Nodes * valueSize // values are allocated separately unless stored inline
+	case versionedValues:
+		stats.EstimatedBytes += stats.Nodes * unsafe.Sizeof(versionedValue[V]{})
+	}
+	return stats
+}
+
+// Stats summarizes the state of a map for tuning its initial size and spotting a poorly distributed hash
+type Stats struct {
+	// Len is the number of elements in the map
+	Len uintptr
+	// Capacity is the size of the map index
+	Capacity uintptr
+	// FillRate is the percentage of used index buckets
+	FillRate uintptr
+	// Resizes is the number of index resizes since the map was created
+	Resizes uintptr
+	// MaxChainLength is the largest number of elements sharing an index bucket
+	MaxChainLength uintptr
+	// DeletedNodes is the number of list elements which are logically deleted but still linked
+	DeletedNodes uintptr
+}
+
+// Stats gathers the current statistics of the map, the collision chains are measured by walking all elements
+func (m *Map[K, V]) Stats() Stats {
+	m.init()
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	var (
+		data  = m.metadata.Load()
+		stats = Stats{
+			Len:      m.Len(),
+			Capacity: uintptr(len(data.index)),
+			FillRate: data.count.Load() * 100 / uintptr(len(data.index)),
+			Resizes:  m.resizes.Load(),
+		}
+		chain      uintptr
+		lastBucket uintptr
+	)
+	// walk the raw links so that elements marked for deletion are neither skipped nor unlinked
+	for item := m.listHead.nextPtr.Load(); item != nil; item = item.nextPtr.Load() {
+		if item.isDeleted() {
+			stats.DeletedNodes++
+			continue
+		}
+		if bucket := data.position(item.keyHash); chain == 0 || bucket != lastBucket {
+			chain, lastBucket = 0, bucket
+		}
+		if chain++; chain > stats.MaxChainLength {
+			stats.MaxChainLength = chain
+		}
+	}
+	return stats
+}
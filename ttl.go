@@ -0,0 +1,99 @@
+package haxmap
+
+import "time"
+
+// interval between the passes of the background sweeper removing expired elements
+const expirySweepInterval = time.Second
+
+// clockBase is the reference point of deadlines, durations since it are read from the monotonic clock
+var clockBase = time.Now()
+
+// nanotime returns the current monotonic time in nanoseconds
+func nanotime() int64 {
+	return int64(time.Since(clockBase))
+}
+
+// SetWithTTL sets the value of the key like Set, the element expires once the ttl has passed
+// expired elements are removed lazily when they are accessed and by a background sweeper,
+// the sweeper goroutine only runs while the map holds elements with a TTL
+// a later Set of the key without a TTL makes the element permanent again
+func (m *Map[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	data := m.metadata.Load()
+	elem, _ := m.insert(h, key, value, data, data.indexElement(h), true)
+	elem.setExpiry(nanotime() + int64(ttl))
+
+	m.ttlAdded.Store(1)
+	if m.sweeping.CompareAndSwap(0, 1) {
+		go m.sweep()
+	}
+}
+
+// TTL returns the remaining time until the element of the key expires
+// ok is false if the key is absent, a remaining time of 0 means the element never expires
+func (m *Map[K, V]) TTL(key K) (remaining time.Duration, ok bool) {
+	m.init()
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	elem := m.metadata.Load().indexElement(h)
+	if elem == nil || elem.keyHash > h {
+		elem = m.listHead
+	}
+	if _, current, _ := m.search(elem, h, key); current != nil && !m.expireIfDue(current) {
+		if deadline := current.expiry(); deadline != 0 {
+			return time.Duration(deadline - nanotime()), true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// expireIfDue removes the element if its TTL has passed or it is stale and reports whether it did expire
+func (m *Map[K, V]) expireIfDue(elem *element[K, V]) bool {
+	if m.discardIfStale(elem) {
+		return true
+	}
+	if deadline := elem.expiry(); deadline == 0 || deadline > nanotime() {
+		return false
+	}
+	value := elem.load(m.storage)
+	if m.removeElement(elem) && m.onExpire != nil {
+		m.onExpire(elem.key, value)
+	}
+	return true
+}
+
+// sweep periodically removes expired elements until no element with a TTL is left
+func (m *Map[K, V]) sweep() {
+	for {
+		time.Sleep(expirySweepInterval)
+		m.ttlAdded.Store(0)
+		if m.sweepExpired() {
+			continue
+		}
+		m.sweeping.Store(0)
+		// an element with a TTL set during the last pass may have missed the running sweeper
+		if m.ttlAdded.Load() == 0 || !m.sweeping.CompareAndSwap(0, 1) {
+			return
+		}
+	}
+}
+
+// sweepExpired removes all expired elements and reports whether any element with a TTL is left
+func (m *Map[K, V]) sweepExpired() (pending bool) {
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(0))
+	}
+	for item := m.listHead.next(); item != nil; item = item.next() {
+		if item.expiry() != 0 && !m.expireIfDue(item) {
+			pending = true
+		}
+	}
+	return
+}
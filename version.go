@@ -0,0 +1,143 @@
+package haxmap
+
+// anyVersion makes updateIfVersion replace the value regardless of the version of the element
+const anyVersion = ^uintptr(0)
+
+// GetVersioned retrieves the value of the key together with its version
+// the version grows with every modification of the value and never repeats for the key, not even after it was deleted and added again
+// a missing key has version 0
+// It panics if the map was not created with WithVersions
+func (m *Map[K, V]) GetVersioned(key K) (value V, version uint64, ok bool) {
+	m.init()
+	m.checkVersions("GetVersioned")
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	existing := m.metadata.Load().indexElement(h)
+	if existing == nil || existing.keyHash > h {
+		existing = m.listHead
+	}
+	_, current, _ := m.search(existing, h, key)
+	if current == nil {
+		return
+	}
+	record := current.record().Load()
+	if record.final || m.expireIfDue(current) {
+		return // deleted in the meantime
+	}
+	return record.value, uint64(record.version), true
+}
+
+// SetIfVersion sets the value of the key only if its version still is the one returned by GetVersioned
+// a version of 0 only adds the key if it is missing
+// it reports whether the value was set, which enables optimistic concurrency over a sequence of steps without holding any lock
+// It panics if the map was not created with WithVersions
+func (m *Map[K, V]) SetIfVersion(key K, value V, version uint64) bool {
+	m.init()
+	m.checkVersions("SetIfVersion")
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	data := m.metadata.Load()
+	if version == 0 {
+		_, created := m.insert(h, key, value, data, data.indexElement(h), false)
+		return created
+	}
+	existing := data.indexElement(h)
+	if existing == nil || existing.keyHash > h {
+		existing = m.listHead
+	}
+	_, current, _ := m.search(existing, h, key)
+	if current == nil || !m.updateIfVersion(current, value, uintptr(version)) {
+		return false
+	}
+	if current.expiry() != 0 {
+		current.setExpiry(0) // like a plain store it replaces a value set with a TTL
+	}
+	if m.capacity != 0 {
+		current.touch()
+	}
+	if m.metrics != nil {
+		m.metrics.Set(false)
+	}
+	return true
+}
+
+// delIfVersion deletes the key only if its version still is the given one and reports whether it was deleted
+func (m *Map[K, V]) delIfVersion(key K, version uint64) bool {
+	m.init()
+	m.checkVersions("delIfVersion")
+	h := m.hasher(key)
+	if r := m.reclaimer; r != nil {
+		defer r.exit(r.enter(h))
+	}
+	existing := m.metadata.Load().indexElement(h)
+	if existing == nil || existing.keyHash > h {
+		existing = m.listHead
+	}
+	_, current, _ := m.search(existing, h, key)
+	removed := current != nil && m.removeElementIfVersion(current, uintptr(version))
+	if m.metrics != nil {
+		m.metrics.Del(boolToInt(removed))
+	}
+	return removed
+}
+
+// initVersioned sets up a zero value map with versions on its first use, for the types built on top of GetVersioned
+func (m *Map[K, V]) initVersioned() {
+	if m.metadata.Load() == nil {
+		m.initOnce.Do(func() {
+			if err := m.configure(&config{versions: true}); err != nil {
+				panic(err)
+			}
+		})
+	}
+}
+
+// checkVersions panics if the map keeps no versions, naming the method called
+func (m *Map[K, V]) checkVersions(method string) {
+	if m.storage != versionedValues {
+		panic("haxmap: " + method + " called on a map created without WithVersions")
+	}
+}
+
+// initValue sets the value of a new element before it is linked into the list
+// versions of new elements start above the final versions of all deleted elements, so that the version of a key never repeats
+func (m *Map[K, V]) initValue(elem *element[K, V], value V) {
+	if m.storage != versionedValues {
+		elem.store(m.storage, value)
+		return
+	}
+	elem.record().Store(&versionedValue[V]{value: value, version: m.versions.Load() + 1})
+}
+
+// retireVersion makes the value and version of a versioned element about to be deleted final and raises the map version clock to its version
+// it returns false if the element was deleted by another operation in the meantime or no longer has the given version,
+// elements of a map without versions are always retired
+func (m *Map[K, V]) retireVersion(elem *element[K, V], version uintptr) bool {
+	if m.storage != versionedValues {
+		return true
+	}
+	for {
+		current := elem.record().Load()
+		if current.final || version != anyVersion && version != current.version {
+			return false
+		}
+		if elem.record().CompareAndSwap(current, &versionedValue[V]{value: current.value, version: current.version, final: true}) {
+			m.raiseVersions(current.version)
+			return true
+		}
+	}
+}
+
+// raiseVersions raises the version clock of the map to at least the given version
+func (m *Map[K, V]) raiseVersions(version uintptr) {
+	for {
+		current := m.versions.Load()
+		if current >= version || m.versions.CompareAndSwap(current, version) {
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package haxmap
+
+import (
+	"context"
+	"sync"
+)
+
+type (
+	// keyWaiter is a GetWait call blocked on a missing key
+	keyWaiter[K comparable, V any] struct {
+		key K
+		ch  chan V // receives the value the key was added with, buffered so that waking never blocks
+	}
+
+	// waitLists holds the GetWait calls of a map blocked on missing keys, it is created by the first wait and kept afterwards
+	waitLists[K comparable, V any] struct {
+		mu     sync.Mutex
+		hashes map[uintptr][]*keyWaiter[K, V] // waiters by hash of their key
+		active atomicUint32                   // number of blocked calls, insertions skip the wake up if there are none
+	}
+)
+
+// GetWait retrieves the value of the key, if the key is absent it blocks until another goroutine adds it
+// waiting calls are kept in per-key lists and woken up by the insertion of their key, so that the map can serve as a rendezvous point between producers and consumers
+// it returns the error of the context if the context is done before the key is added
+func (m *Map[K, V]) GetWait(ctx context.Context, key K) (V, error) {
+	if value, ok := m.Get(key); ok {
+		return value, nil
+	}
+	w := m.waiters.Load()
+	if w == nil {
+		m.waiters.CompareAndSwap(nil, &waitLists[K, V]{hashes: make(map[uintptr][]*keyWaiter[K, V])})
+		w = m.waiters.Load()
+	}
+	var (
+		h      = m.hasher(key)
+		waiter = &keyWaiter[K, V]{key: key, ch: make(chan V, 1)}
+	)
+	w.add(h, waiter)
+	// the key may have been added before the waiter was registered
+	if value, ok := m.Get(key); ok {
+		w.remove(h, waiter)
+		return value, nil
+	}
+	select {
+	case value := <-waiter.ch:
+		return value, nil
+	case <-ctx.Done():
+		w.remove(h, waiter)
+		// the key may have been added concurrently with the end of the context
+		select {
+		case value := <-waiter.ch:
+			return value, nil
+		default:
+			return *new(V), ctx.Err()
+		}
+	}
+}
+
+// add registers a waiter of a key with the given hash
+func (w *waitLists[K, V]) add(h uintptr, waiter *keyWaiter[K, V]) {
+	w.mu.Lock()
+	w.hashes[h] = append(w.hashes[h], waiter)
+	w.active.Add(1)
+	w.mu.Unlock()
+}
+
+// remove unregisters a waiter, removing a waiter which was already woken up has no effect
+func (w *waitLists[K, V]) remove(h uintptr, waiter *keyWaiter[K, V]) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := w.hashes[h]
+	for i := range list {
+		if list[i] == waiter {
+			list = append(list[:i], list[i+1:]...)
+			w.active.Add(^uint32(0))
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(w.hashes, h)
+	} else {
+		w.hashes[h] = list
+	}
+}
+
+// wake hands the value of a newly added key to the waiters of the key and unregisters them
+func (w *waitLists[K, V]) wake(h uintptr, key K, value V, equal func(a, b K) bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := w.hashes[h]
+	kept := list[:0]
+	for _, waiter := range list {
+		if keyEquals(equal, waiter.key, key) {
+			waiter.ch <- value
+			w.active.Add(^uint32(0))
+		} else {
+			kept = append(kept, waiter)
+		}
+	}
+	if len(kept) == 0 {
+		delete(w.hashes, h)
+	} else {
+		w.hashes[h] = kept
+	}
+}
@@ -0,0 +1,168 @@
+package haxmap
+
+import (
+	"strings"
+	"sync"
+)
+
+// capacity of the channel of a watch, events are dropped while it is full
+const watchBuffer = 64
+
+// kinds of modifications reported to watches
+const (
+	EventInsert EventType = iota
+	EventUpdate
+	EventDelete
+)
+
+type (
+	// EventType is the kind of modification reported by an Event
+	EventType uint8
+
+	// Event is a modification of a watched key
+	Event[K comparable, V any] struct {
+		Type     EventType
+		Key      K
+		Value    V      // the new value, or the removed value of a deletion
+		OldValue V      // the replaced value of an update
+		Missed   uint64 // number of events dropped before this one because the channel was full
+	}
+
+	// watcher is the channel of a single watch
+	watcher[K comparable, V any] struct {
+		ch     chan Event[K, V]
+		match  func(K) bool // selects the keys of a watch which is not bound to a single key
+		mu     sync.Mutex   // guards sending against closing the channel
+		closed bool
+		missed uint64
+	}
+
+	// watchers holds the watches of a map, it is created by the first watch and kept afterwards
+	watchers[K comparable, V any] struct {
+		mu     sync.RWMutex
+		keys   map[K][]*watcher[K, V] // watches of a single key
+		others []*watcher[K, V]       // watches selecting keys with a match function
+		active atomicUint32           // number of open watches, mutations skip the notification if there are none
+	}
+)
+
+// Watch returns a channel receiving the insertion, updates and deletion of the key, along with a function which ends the watch and closes the channel
+// events are sent without blocking the modification, if the receiver falls behind the channel fills up and events are dropped,
+// the next delivered event reports how many were missed so that the receiver can reload the key
+func (m *Map[K, V]) Watch(key K) (<-chan Event[K, V], func()) {
+	m.init()
+	if equal := m.equal; equal != nil {
+		// keys of a custom equality cannot be looked up in a Go map
+		return m.watch(func(k K) bool {
+			return equal(k, key)
+		}, key)
+	}
+	return m.watch(nil, key)
+}
+
+// WatchAll is like Watch for the modifications of every key
+func (m *Map[K, V]) WatchAll() (<-chan Event[K, V], func()) {
+	m.init()
+	return m.watch(func(K) bool {
+		return true
+	}, *new(K))
+}
+
+// WatchPrefix is like Watch for the modifications of all keys starting with the prefix
+func WatchPrefix[K ~string, V any](m *Map[K, V], prefix string) (<-chan Event[K, V], func()) {
+	m.init()
+	return m.watch(func(key K) bool {
+		return strings.HasPrefix(string(key), prefix)
+	}, "")
+}
+
+// watch registers a watcher of the keys selected by match, or of the given key if match is nil
+func (m *Map[K, V]) watch(match func(K) bool, key K) (<-chan Event[K, V], func()) {
+	w := m.watchers.Load()
+	if w == nil {
+		m.watchers.CompareAndSwap(nil, &watchers[K, V]{keys: make(map[K][]*watcher[K, V])})
+		w = m.watchers.Load()
+	}
+	s := &watcher[K, V]{ch: make(chan Event[K, V], watchBuffer), match: match}
+	w.mu.Lock()
+	if match == nil {
+		w.keys[key] = append(w.keys[key], s)
+	} else {
+		w.others = append(w.others, s)
+	}
+	w.active.Add(1)
+	w.mu.Unlock()
+	return s.ch, func() {
+		w.remove(s, key)
+	}
+}
+
+// watching reports whether the map has open watches
+func (m *Map[K, V]) watching() bool {
+	w := m.watchers.Load()
+	return w != nil && w.active.Load() != 0
+}
+
+// notify sends the event to the watches of its key
+func (w *watchers[K, V]) notify(ev Event[K, V]) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if len(w.keys) != 0 {
+		for _, s := range w.keys[ev.Key] {
+			s.send(ev)
+		}
+	}
+	for _, s := range w.others {
+		if s.match(ev.Key) {
+			s.send(ev)
+		}
+	}
+}
+
+// remove ends a watch and closes its channel, removing a watch twice has no effect
+func (w *watchers[K, V]) remove(s *watcher[K, V], key K) {
+	w.mu.Lock()
+	list := &w.others
+	if s.match == nil {
+		keyed := w.keys[key]
+		list = &keyed
+	}
+	for i := range *list {
+		if (*list)[i] == s {
+			*list = append((*list)[:i], (*list)[i+1:]...)
+			w.active.Add(^uint32(0))
+			break
+		}
+	}
+	if s.match == nil {
+		if len(*list) == 0 {
+			delete(w.keys, key)
+		} else {
+			w.keys[key] = *list
+		}
+	}
+	w.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// send delivers the event without blocking, it is dropped if the channel is full
+func (s *watcher[K, V]) send(ev Event[K, V]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	ev.Missed = s.missed
+	select {
+	case s.ch <- ev:
+		s.missed = 0
+	default:
+		s.missed++
+	}
+}
@@ -0,0 +1,100 @@
+//go:build go1.24 && !haxmap_purego
+
+package haxmap
+
+import (
+	"runtime"
+	"weak"
+)
+
+// WeakMap is a concurrent map holding its values weakly, an element is deleted automatically once its value is garbage collected
+// it suits canonicalizing and interning caches which must not keep otherwise unused values alive
+// the zero value is an empty map ready to use with the default settings
+type WeakMap[K comparable, T any] struct {
+	m Map[K, weak.Pointer[T]]
+}
+
+// NewWeakMap returns a new weak map with an optional specific initialization size
+func NewWeakMap[K comparable, T any](size ...uintptr) *WeakMap[K, T] {
+	cfg := config{versions: true} // updates are built on GetVersioned
+	if len(size) > 0 {
+		cfg.size = size[0]
+	}
+	wm := &WeakMap[K, T]{}
+	if err := wm.m.configure(&cfg); err != nil {
+		panic(err)
+	}
+	return wm
+}
+
+// Get returns the value of the key if it was not garbage collected yet
+func (wm *WeakMap[K, T]) Get(key K) (*T, bool) {
+	wm.m.initVersioned()
+	if wp, ok := wm.m.Get(key); ok {
+		if value := wp.Value(); value != nil {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Set sets the value of the key without keeping it alive, the value must not be nil
+func (wm *WeakMap[K, T]) Set(key K, value *T) {
+	wm.m.initVersioned()
+	wp := weak.Make(value)
+	wm.m.Set(key, wp)
+	wm.cleanup(key, value, wp)
+}
+
+// GetOrSet returns the live value of the key if present, else it sets the given non-nil value and returns it
+// the loaded result is true if the value was present, which makes the map usable for interning values
+func (wm *WeakMap[K, T]) GetOrSet(key K, value *T) (actual *T, loaded bool) {
+	wm.m.initVersioned()
+	wp := weak.Make(value)
+	for {
+		current, version, ok := wm.m.GetVersioned(key)
+		if ok {
+			if actual = current.Value(); actual != nil {
+				return actual, true
+			}
+		}
+		// absent or only holding a collected value whose cleanup did not run yet
+		if wm.m.SetIfVersion(key, wp, version) {
+			wm.cleanup(key, value, wp)
+			return value, false
+		}
+	}
+}
+
+// Del deletes the keys
+func (wm *WeakMap[K, T]) Del(keys ...K) {
+	wm.m.initVersioned()
+	wm.m.Del(keys...)
+}
+
+// Len returns the number of elements, including those whose values were collected but not cleaned up yet
+func (wm *WeakMap[K, T]) Len() uintptr {
+	wm.m.initVersioned()
+	return wm.m.Len()
+}
+
+// ForEach iterates over the keys and their live values
+// lambda must return `true` to continue iteration and `false` to break iteration
+func (wm *WeakMap[K, T]) ForEach(lambda func(K, *T) bool) {
+	wm.m.initVersioned()
+	wm.m.ForEach(func(key K, wp weak.Pointer[T]) bool {
+		if value := wp.Value(); value != nil {
+			return lambda(key, value)
+		}
+		return true
+	})
+}
+
+// cleanup deletes the element once the value is collected, unless the key was set to another value in the meantime
+func (wm *WeakMap[K, T]) cleanup(key K, value *T, wp weak.Pointer[T]) {
+	runtime.AddCleanup(value, func(key K) {
+		if current, version, ok := wm.m.GetVersioned(key); ok && current == wp {
+			wm.m.delIfVersion(key, version)
+		}
+	}, key)
+}
@@ -0,0 +1,34 @@
+//go:build go1.24 && !haxmap_purego
+
+package haxmap
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWeakMap(t *testing.T) {
+	wm := NewWeakMap[string, [64]byte]()
+	kept := &[64]byte{1}
+	wm.Set("kept", kept)
+	wm.Set("dropped", &[64]byte{2})
+
+	interned, loaded := wm.GetOrSet("kept", &[64]byte{3})
+	if loaded != true || interned != kept {
+		t.Error("live value should be returned by GetOrSet")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for wm.Len() != 1 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := wm.Get("dropped"); ok || wm.Len() != 1 {
+		t.Errorf("collected value should be deleted, length: %d", wm.Len())
+	}
+	if value, ok := wm.Get("kept"); !ok || value != kept {
+		t.Error("value which is still referenced should be kept")
+	}
+	runtime.KeepAlive(kept)
+}
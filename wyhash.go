@@ -0,0 +1,62 @@
+package haxmap
+
+import "math/bits"
+
+// wyhash secrets
+const (
+	wyp0 uint64 = 0xa0761d6478bd642f
+	wyp1 uint64 = 0xe7037ed1a0b428db
+	wyp2 uint64 = 0x8ebc6af09c88c6e3
+	wyp3 uint64 = 0x589965cc75374cc3
+)
+
+// mum multiplies two 64-bit integers and returns the low and high halves of the 128-bit product
+func mum(a, b uint64) (uint64, uint64) {
+	hi, lo := bits.Mul64(a, b)
+	return lo, hi
+}
+
+// mix folds the 128-bit product of two 64-bit integers into 64 bits
+func mix(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+func u24(b []byte, n int) uint64 {
+	return uint64(b[0])<<16 | uint64(b[n>>1])<<8 | uint64(b[n-1])
+}
+
+// wyhash implements the final version 4 of https://github.com/wangyi-fudan/wyhash
+// it is faster than xxHash for short inputs
+func wyhash(b []byte, seed uint64) uint64 {
+	var (
+		n    = len(b)
+		a, c uint64
+	)
+	seed ^= mix(seed^wyp0, wyp1)
+	switch {
+	case n > 16:
+		p, i := b, n
+		if i >= 48 {
+			see1, see2 := seed, seed
+			for ; i >= 48; i, p = i-48, p[48:] {
+				seed = mix(u64(p[0:8])^wyp1, u64(p[8:16])^seed)
+				see1 = mix(u64(p[16:24])^wyp2, u64(p[24:32])^see1)
+				see2 = mix(u64(p[32:40])^wyp3, u64(p[40:48])^see2)
+			}
+			seed ^= see1 ^ see2
+		}
+		for ; i > 16; i, p = i-16, p[16:] {
+			seed = mix(u64(p[0:8])^wyp1, u64(p[8:16])^seed)
+		}
+		a, c = u64(b[n-16:n-8]), u64(b[n-8:n])
+	case n >= 4:
+		off := (n >> 3) << 2
+		a = uint64(u32(b[0:4]))<<32 | uint64(u32(b[off:off+4]))
+		c = uint64(u32(b[n-4:n]))<<32 | uint64(u32(b[n-4-off:n-off]))
+	case n > 0:
+		a = u24(b, n)
+	}
+	a, c = mum(a^wyp1, c^seed)
+	return mix(a^wyp0^uint64(n), c^wyp1)
+}